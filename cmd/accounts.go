@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+func accountFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "rpc-url", Usage: "rpc of the chain, defaults to the one of the network profile", EnvVars: []string{"CONTINUOUS_TEST_RPC_URL", "STRESS_TEST_RPC_URL"}},
+		pkFileFlag(),
+		&cli.StringFlag{Name: "pk", Usage: "hex encoded key of the main test account, defaults to the one of the network profile", EnvVars: []string{"CONTINUOUS_TEST_PK", "STRESS_TEST_PK"}},
+	}
+}
+
+func accountsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "accounts",
+		Usage: "manage the generated test accounts",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "show the balances of the generated test accounts",
+				Flags:  accountFlags(),
+				Action: listAccounts,
+			},
+			{
+				Name:  "drain",
+				Usage: "send the funds of the generated test accounts back",
+				Flags: append(accountFlags(),
+					&cli.StringFlag{Name: "to", Usage: "recipient of the funds, defaults to the main test account"},
+				),
+				Action: drainAccounts,
+			},
+			{
+				Name:   "fix-nonce",
+				Usage:  "fill the nonce gaps of the main test account in the mempool",
+				Flags:  accountFlags(),
+				Action: fixNonce,
+			},
+		},
+	}
+}
+
+// accountsClient dials the rpc of the accounts commands and returns its signer.
+func accountsClient(c *cli.Context) (*ethclient.Client, types.Signer, error) {
+	rpcURL, err := profileOrFlag(c, "rpc-url", func(p config.Profile) string { return p.RPCURL })
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create client %v", err)
+	}
+	chainID, err := client.ChainID(c.Context)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("could not query chainId %v", err)
+	}
+	return client, types.LatestSignerForChainID(chainID), nil
+}
+
+// mainAccount returns the account of the pk flag or network profile.
+func mainAccount(c *cli.Context, signer types.Signer) (utils.Account, error) {
+	pk, err := profileOrFlag(c, "pk", func(p config.Profile) string { return p.PrivateKey })
+	if err != nil {
+		return utils.Account{}, err
+	}
+	key, err := crypto.HexToECDSA(pk)
+	if err != nil {
+		return utils.Account{}, err
+	}
+	return utils.AccountFromPrivateKey(key, signer)
+}
+
+// generatedAccounts returns the accounts of the pk file.
+func generatedAccounts(c *cli.Context, signer types.Signer) ([]utils.Account, error) {
+	fd, err := os.Open(c.String("pk-file"))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	pks, err := utils.ReadPks(fd)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading private keys: %w", err)
+	}
+	accounts := make([]utils.Account, len(pks))
+	for i := range pks {
+		accounts[i], err = utils.AccountFromPrivateKey(pks[i], signer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return accounts, nil
+}
+
+func listAccounts(c *cli.Context) error {
+	client, signer, err := accountsClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	accounts, err := generatedAccounts(c, signer)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		balance, err := client.BalanceAt(c.Context, account.Address, nil)
+		if err != nil {
+			return err
+		}
+		nonce, err := client.NonceAt(c.Context, account.Address, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v\t%v\tnonce %v\n", account.Address.Hex(), balance, nonce)
+	}
+	return nil
+}
+
+func drainAccounts(c *cli.Context) error {
+	client, signer, err := accountsClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	var target common.Address
+	if c.String("to") != "" {
+		if !common.IsHexAddress(c.String("to")) {
+			return fmt.Errorf("invalid recipient %v", c.String("to"))
+		}
+		target = common.HexToAddress(c.String("to"))
+	} else {
+		main, err := mainAccount(c, signer)
+		if err != nil {
+			return err
+		}
+		target = main.Address
+	}
+	accounts, err := generatedAccounts(c, signer)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		balance, err := client.BalanceAt(c.Context, account.Address, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(account.Address.Hex(), balance)
+		if balance.Uint64() > 0 {
+			utils.Drain(context.Background(), account, balance.Uint64(), target, client)
+		}
+	}
+	return nil
+}
+
+func fixNonce(c *cli.Context) error {
+	client, signer, err := accountsClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	main, err := mainAccount(c, signer)
+	if err != nil {
+		return err
+	}
+	return utils.FixNonce(client, main)
+}
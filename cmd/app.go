@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v2"
+)
+
+// NewApp returns the command tree of the test runner. Every flag falls back to an
+// environment variable, which may also be defined in a `.env` file in the working
+// directory. The rpc endpoints, keys and contracts not given as flags are taken from the
+// network profile selected with the global --config and --network flags.
+func NewApp() *cli.App {
+	return &cli.App{
+		Name:  "nethermind-tests",
+		Usage: "send and analyse (shutterized) test transactions",
+		Before: func(*cli.Context) error {
+			err := godotenv.Load()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		},
+		Commands: []*cli.Command{
+			runCommand(),
+			collectCommand(),
+			accountsCommand(),
+			inspectCommand(),
+			preflightCommand(),
+			stressCommand(),
+		},
+		// without a command, the modes are run like before the command tree existed
+		Flags:     append(configFlags(), runFlags()...),
+		ArgsUsage: "[modes...]",
+		Action:    runModes,
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"math/big"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gotest.tools/assert"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/continuous"
+)
+
+// parse runs command with args, calling action instead of the command's own action.
+func parse(t *testing.T, command *cli.Command, args []string, action cli.ActionFunc) error {
+	t.Helper()
+	command.Action = action
+	app := &cli.App{Name: "test", Commands: []*cli.Command{command}}
+	return app.Run(append([]string{"test", command.Name}, args...))
+}
+
+func TestBlockRange(t *testing.T) {
+	var from, to uint64
+	action := func(c *cli.Context) error {
+		var err error
+		from, to, err = blockRange(c)
+		return err
+	}
+	assert.NilError(t, parse(t, collectCommand(), []string{"--from", "10", "--to", "20"}, action))
+	assert.Equal(t, from, uint64(10))
+	assert.Equal(t, to, uint64(20))
+	assert.NilError(t, parse(t, collectCommand(), []string{"30", "40"}, action))
+	assert.Equal(t, from, uint64(30))
+	assert.Equal(t, to, uint64(40))
+
+	assert.ErrorContains(t, parse(t, collectCommand(), []string{"--from", "10"}, action), "required")
+	assert.ErrorContains(t, parse(t, collectCommand(), []string{"--from", "20", "--to", "10"}, action), "empty block range")
+	assert.ErrorContains(t, parse(t, collectCommand(), []string{"30", "x"}, action), "not a valid block number x")
+	assert.ErrorContains(t, parse(t, collectCommand(), []string{"--from", "1", "30", "40"}, action), "flags and arguments")
+}
+
+func TestSelectedModes(t *testing.T) {
+	var modes []string
+	action := func(c *cli.Context) error {
+		var err error
+		modes, err = selectedModes(c)
+		return err
+	}
+	assert.NilError(t, parse(t, runCommand(), []string{"chiado", "send-wait"}, action))
+	assert.DeepEqual(t, modes, []string{"chiado", "send-wait"})
+
+	t.Setenv("MODE", "gnosis,continuous")
+	assert.NilError(t, parse(t, runCommand(), nil, action))
+	assert.DeepEqual(t, modes, []string{"gnosis", "continuous"})
+
+	assert.ErrorContains(t, parse(t, runCommand(), []string{"collect"}, action), "command of its own")
+	assert.ErrorContains(t, parse(t, runCommand(), []string{"chiado", "mainnet"}, action), "unknown mode mainnet")
+}
+
+func TestConfigFromFlags(t *testing.T) {
+	t.Setenv("CHIADO_SEND_INTERVAL", "30")
+	t.Setenv("TX_VALUE", "1000")
+	action := func(c *cli.Context) error {
+		cfg, err := configFromFlags(c)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, cfg.ChiadoSendInterval, 30*time.Second)
+		assert.Equal(t, cfg.TxValue.Cmp(big.NewInt(1000)), 0)
+		assert.Equal(t, cfg.TxType, "dynamic-fee")
+		assert.Equal(t, cfg.RestartLimit, 5)
+		assert.DeepEqual(t, cfg.TxData, []byte{0xca, 0xfe})
+		return nil
+	}
+	assert.NilError(t, parse(t, runCommand(), []string{"--tx-type", "dynamic-fee", "--tx-data", "0xcafe"}, action))
+	assert.ErrorContains(t, parse(t, runCommand(), []string{"--tx-value", "lots"}, configAction), "invalid tx-value")
+}
+
+func TestContinuousOptionsFromFlags(t *testing.T) {
+	t.Setenv("CONTINUOUS_BLAME_FOLDER", "/tmp/blame")
+	var options continuousOptions
+	action := func(c *cli.Context) error {
+		var err error
+		options, err = continuousOptionsFromFlags(c)
+		return err
+	}
+	assert.NilError(t, parse(t, runCommand(), nil, action))
+	assert.Equal(t, options.files, continuous.Files{PkFile: "pk.hex", BlameFolder: "/tmp/blame"})
+	assert.NilError(t, parse(t, runCommand(), []string{"--pk-file", "keys.hex", "--blame-folder", "reports"}, action))
+	assert.Equal(t, options.files, continuous.Files{PkFile: "keys.hex", BlameFolder: "reports"})
+}
+
+func configAction(c *cli.Context) error {
+	_, err := configFromFlags(c)
+	return err
+}
+
+func TestApplyProfiles(t *testing.T) {
+	file := path.Join(t.TempDir(), "config.yaml")
+	assert.NilError(t, os.WriteFile(file, []byte(`
+network: gnosis
+networks:
+  chiado: {rpcUrl: "http://chiado", privateKey: "aa"}
+  gnosis: {rpcUrl: "http://gnosis", privateKey: "bb"}
+`), 0o600))
+	t.Setenv("CONFIG_FILE", file)
+	var cfg config.Config
+	action := func(c *cli.Context) error {
+		var err error
+		cfg, err = configFromFlags(c)
+		if err != nil {
+			return err
+		}
+		return applyProfiles(c, &cfg)
+	}
+	app := NewApp()
+	app.Action = action
+	assert.NilError(t, app.Run([]string{"test", "--gnosis-url", "http://flag"}))
+	assert.Equal(t, cfg.ChiadoURL, "http://chiado")
+	assert.Equal(t, cfg.GnosisURL, "http://flag")
+	assert.Equal(t, cfg.NodeURL, "http://gnosis")
+	assert.Equal(t, cfg.PrivateKey, "bb")
+
+	assert.NilError(t, app.Run([]string{"test", "--network", "chiado", "--private-key", "cc"}))
+	assert.Equal(t, cfg.NodeURL, "http://chiado")
+	assert.Equal(t, cfg.PrivateKey, "cc")
+
+	assert.ErrorContains(t, app.Run([]string{"test", "--network", "local"}), "unknown network local")
+}
+
+func TestStartServers(t *testing.T) {
+	options := continuousOptions{
+		metricsAddress: "127.0.0.1:0",
+		metrics:        continuous.NewMetrics(),
+		api:            continuous.NewAPI(nil),
+	}
+	servers, err := startServers("127.0.0.1:0", options)
+	assert.NilError(t, err)
+	assert.Equal(t, len(servers), 1, "the api and the metrics share the address")
+	defer servers[0].Close()
+	for _, path := range []string{"/metrics", "/api/modes"} {
+		res, err := http.Get("http://" + servers[0].Addr + path)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK, path)
+	}
+
+	servers, err = startServers("", continuousOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(servers), 0)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/continuous"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+func collectCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "collect",
+		Usage: "write the report of the continuous tests for a block range",
+		Description: "The observer database and chain are taken from the selected network profile, overridden by the\n" +
+			"CONTINUOUS_* environment variables.\n" +
+			"The block range can also be given as two arguments.",
+		ArgsUsage: "[from to]",
+		Flags: []cli.Flag{
+			&cli.Uint64Flag{Name: "from", Usage: "first block of the range"},
+			&cli.Uint64Flag{Name: "to", Usage: "last block of the range"},
+			&cli.StringFlag{Name: "format", Usage: "report format, one of " + fmt.Sprint(continuous.ReportFormats), Value: "text"},
+			&cli.StringFlag{Name: "out", Usage: "report file, - for stdout, defaults to a new file in the blame folder"},
+			blameFolderFlag(),
+			modeFlag(),
+		},
+		Action: collect,
+	}
+}
+
+// blockRange returns the validated block range from the flags or the arguments.
+func blockRange(c *cli.Context) (uint64, uint64, error) {
+	from, to := c.Uint64("from"), c.Uint64("to")
+	switch c.Args().Len() {
+	case 0:
+		if !c.IsSet("from") || !c.IsSet("to") {
+			return 0, 0, fmt.Errorf("--from and --to are required")
+		}
+	case 2:
+		if c.IsSet("from") || c.IsSet("to") {
+			return 0, 0, fmt.Errorf("block range given as flags and arguments")
+		}
+		var err error
+		from, err = strconv.ParseUint(c.Args().Get(0), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("not a valid block number %v", c.Args().Get(0))
+		}
+		to, err = strconv.ParseUint(c.Args().Get(1), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("not a valid block number %v", c.Args().Get(1))
+		}
+	default:
+		return 0, 0, fmt.Errorf("expected two block numbers, got %v arguments", c.Args().Len())
+	}
+	if from >= to {
+		return 0, 0, fmt.Errorf("empty block range [%v:%v]", from, to)
+	}
+	return from, to, nil
+}
+
+func collect(c *cli.Context) error {
+	from, to, err := blockRange(c)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(continuous.ReportFormats, c.String("format")) {
+		return fmt.Errorf("unknown format %v, choose from %v", c.String("format"), continuous.ReportFormats)
+	}
+	network, err := loadProfile(c, config.ContinuousEnv)
+	if err != nil {
+		return err
+	}
+	utils.EnableExtLoggingFile()
+	cfg, err := continuous.SetupReadOnly(c.String("mode"), network, c.String("blame-folder"))
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+	cfg.ReportFormat = c.String("format")
+	cache := continuous.BlockCache{}
+	var out io.Writer
+	switch c.String("out") {
+	case "":
+		return continuous.CollectContinuousTestStats(from, to, &cache, &cfg)
+	case "-":
+		out = os.Stdout
+	default:
+		f, err := os.Create(c.String("out"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return continuous.WriteContinuousTestStats(out, from, to, &cache, &cfg)
+}
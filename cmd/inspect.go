@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/continuous"
+)
+
+func inspectCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "inspect",
+		Usage: "show the state of test transactions",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "journal",
+				Usage: "show the transactions recorded in the journal of the continuous tests",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "file", Usage: "journal file, defaults to " + continuous.JournalFileName("<mode>") + " in CONTINUOUS_BLAME_FOLDER", EnvVars: []string{"CONTINUOUS_JOURNAL_FILE"}},
+					&cli.StringFlag{Name: "blame-folder", Hidden: true, EnvVars: []string{"CONTINUOUS_BLAME_FOLDER"}},
+					modeFlag(),
+					&cli.StringFlag{Name: "status", Usage: "only show transactions with this status"},
+				},
+				Action: inspectJournal,
+			},
+			{
+				Name:  "scoreboard",
+				Usage: "rank the shutter validators by the test transactions they missed",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "file", Usage: "scoreboard file, defaults to " + continuous.ScoreboardFileName("<mode>") + " in CONTINUOUS_BLAME_FOLDER", EnvVars: []string{"CONTINUOUS_SCOREBOARD_FILE"}},
+					&cli.StringFlag{Name: "blame-folder", Hidden: true, EnvVars: []string{"CONTINUOUS_BLAME_FOLDER"}},
+					modeFlag(),
+					&cli.StringSliceFlag{Name: "window", Usage: "rolling windows to rank, e.g. 6h or 7d", Value: cli.NewStringSlice("1d", "7d", "30d")},
+					&cli.IntFlag{Name: "limit", Usage: "number of validators per window, 0 for all", Value: 20},
+					&cli.StringFlag{Name: "format", Usage: "output format, one of " + fmt.Sprint(continuous.ReportFormats), Value: "text"},
+				},
+				Action: inspectScoreboard,
+			},
+			{
+				Name:      "tx",
+				Usage:     "show a transaction and its receipt",
+				ArgsUsage: "<hash>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "rpc-url", Usage: "rpc of the chain, defaults to the one of the network profile", EnvVars: []string{"CONTINUOUS_TEST_RPC_URL", "NODE_URL"}},
+				},
+				Action: inspectTx,
+			},
+		},
+	}
+}
+
+// pkFileFlag is the file with the keys of the generated test accounts.
+func pkFileFlag() cli.Flag {
+	return &cli.StringFlag{Name: "pk-file", Usage: "file with the keys of the generated test accounts", EnvVars: []string{"CONTINUOUS_PK_FILE"}, Value: "pk.hex"}
+}
+
+// blameFolderFlag is the folder of the reports, journals and scoreboards of the continuous modes.
+func blameFolderFlag() cli.Flag {
+	return &cli.StringFlag{Name: "blame-folder", Usage: "folder of the reports, a temporary one is used if empty", EnvVars: []string{"CONTINUOUS_BLAME_FOLDER"}}
+}
+
+// modeFlag selects the continuous mode, whose files are used.
+func modeFlag() cli.Flag {
+	return &cli.StringFlag{Name: "mode", Usage: "continuous mode, standard or graffiti", Value: "standard"}
+}
+
+func inspectJournal(c *cli.Context) error {
+	file := c.String("file")
+	if file == "" {
+		if c.String("blame-folder") == "" {
+			return fmt.Errorf("--file is required")
+		}
+		file = path.Join(c.String("blame-folder"), continuous.JournalFileName(c.String("mode")))
+	}
+	entries, err := continuous.ReadJournal(file)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if c.IsSet("status") && entry.Status != c.String("status") {
+			continue
+		}
+		fmt.Printf("trigger %v\t%v\tsender %v\n", entry.TriggerBlock, entry.Status, entry.Sender.Hex())
+		fmt.Printf("\tsubmit %v include %v cancel %v target slot %v latency %v\n",
+			entry.SubmissionBlock, entry.InclusionBlock, entry.CancelBlock, entry.TargetSlot, entry.Latency)
+		for _, t := range entry.Transitions {
+			fmt.Println("\t" + t.String())
+		}
+	}
+	return nil
+}
+
+func inspectScoreboard(c *cli.Context) error {
+	file := c.String("file")
+	if file == "" {
+		if c.String("blame-folder") == "" {
+			return fmt.Errorf("--file is required")
+		}
+		file = path.Join(c.String("blame-folder"), continuous.ScoreboardFileName(c.String("mode")))
+	}
+	if !slices.Contains(continuous.ReportFormats, c.String("format")) {
+		return fmt.Errorf("unknown format %v, choose from %v", c.String("format"), continuous.ReportFormats)
+	}
+	var windows []time.Duration
+	for _, value := range c.StringSlice("window") {
+		window, err := continuous.ParseWindow(value)
+		if err != nil {
+			return err
+		}
+		windows = append(windows, window)
+	}
+	scores, err := continuous.ReadScoreboard(file)
+	if err != nil {
+		return err
+	}
+	rankings := continuous.RankValidators(scores, time.Now(), windows)
+	if limit := c.Int("limit"); limit > 0 {
+		for i := range rankings {
+			rankings[i].Validators = rankings[i].Validators[:min(limit, len(rankings[i].Validators))]
+		}
+	}
+	return continuous.WriteRankings(os.Stdout, rankings, c.String("format"))
+}
+
+func inspectTx(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("expected a transaction hash")
+	}
+	hash := common.HexToHash(c.Args().First())
+	rpcURL, err := profileOrFlag(c, "rpc-url", func(p config.Profile) string { return p.RPCURL })
+	if err != nil {
+		return err
+	}
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return fmt.Errorf("could not create client %v", err)
+	}
+	defer client.Close()
+	tx, pending, err := client.TransactionByHash(c.Context, hash)
+	if err != nil {
+		return err
+	}
+	chainID, err := client.ChainID(c.Context)
+	if err != nil {
+		return err
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("tx %v\n\tfrom %v nonce %v type %v\n\tto %v value %v gas %v\n",
+		tx.Hash().Hex(), sender.Hex(), tx.Nonce(), tx.Type(), tx.To(), tx.Value(), tx.Gas())
+	if pending {
+		fmt.Println("\tpending")
+		return nil
+	}
+	receipt, err := client.TransactionReceipt(c.Context, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		fmt.Println("\tno receipt")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\tstatus %v block %v index %v gas used %v logs %v\n",
+		receipt.Status, receipt.BlockNumber, receipt.TransactionIndex, receipt.GasUsed, len(receipt.Logs))
+	return nil
+}
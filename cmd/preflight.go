@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/preflight"
+)
+
+func preflightCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "preflight",
+		Usage: "check the selected network and the local setup, before anything is sent",
+		Description: "Checks the rpc and chain ID, the code of the shutter contracts, the current eon key, the funding of\n" +
+			"the submit and test accounts, the tables of the observer database and that the blame and logs folders\n" +
+			"are writable. The network is the selected profile, overridden by the CONTINUOUS_* environment variables.",
+		Flags: []cli.Flag{
+			pkFileFlag(),
+			blameFolderFlag(),
+			&cli.StringFlag{Name: "logs", Usage: "folder of the log files", Value: "./logs"},
+		},
+		Action: runPreflight,
+	}
+}
+
+func runPreflight(c *cli.Context) error {
+	network, err := loadProfile(c, config.ContinuousEnv)
+	if err != nil {
+		return err
+	}
+	results := preflight.Run(c.Context, preflight.Environment{
+		Network:     network,
+		PkFile:      c.String("pk-file"),
+		BlameFolder: c.String("blame-folder"),
+		LogsFolder:  c.String("logs"),
+	})
+	err = preflight.Write(os.Stdout, results)
+	if err != nil {
+		return err
+	}
+	if failed := preflight.Failed(results); failed > 0 {
+		return fmt.Errorf("%v of %v preflight checks failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+)
+
+func configFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "config", Usage: "configuration file with the network profiles", EnvVars: []string{"CONFIG_FILE"}, Value: config.DefaultFile},
+		&cli.StringFlag{Name: "network", Usage: "network profile of the configuration file, defaults to its network entry", EnvVars: []string{"NETWORK"}},
+	}
+}
+
+// loadProfile returns the selected network profile, overridden by the variables in names.
+func loadProfile(c *cli.Context, names config.EnvOverrides) (config.Profile, error) {
+	file, err := config.LoadFile(c.String("config"))
+	if err != nil {
+		return config.Profile{}, err
+	}
+	profile, err := file.Profile(c.String("network"))
+	if err != nil {
+		return config.Profile{}, err
+	}
+	return profile.WithEnv(names), nil
+}
+
+// applyProfiles fills the settings of the chiado, gnosis and send-wait modes, that are not
+// given as flags, from the network profiles. The chiado and gnosis modes use the profiles
+// of the same name, the send-wait mode and the key come from the selected profile.
+func applyProfiles(c *cli.Context, cfg *config.Config) error {
+	file, err := config.LoadFile(c.String("config"))
+	if err != nil {
+		return err
+	}
+	if cfg.ChiadoURL == "" {
+		cfg.ChiadoURL = file.Networks["chiado"].RPCURL
+	}
+	if cfg.GnosisURL == "" {
+		cfg.GnosisURL = file.Networks["gnosis"].RPCURL
+	}
+	if cfg.PrivateKey != "" && cfg.NodeURL != "" {
+		return nil
+	}
+	profile, err := file.Profile(c.String("network"))
+	if err != nil {
+		return err
+	}
+	if cfg.PrivateKey == "" {
+		cfg.PrivateKey = profile.PrivateKey
+	}
+	if cfg.NodeURL == "" {
+		cfg.NodeURL = profile.RPCURL
+	}
+	return nil
+}
+
+// profileOrFlag returns the value of the flag name or else the one of the selected
+// network profile.
+func profileOrFlag(c *cli.Context, name string, field func(config.Profile) string) (string, error) {
+	if c.String(name) != "" {
+		return c.String(name), nil
+	}
+	profile, err := loadProfile(c, config.EnvOverrides{})
+	if err != nil {
+		return "", err
+	}
+	if field(profile) == "" {
+		return "", fmt.Errorf("--%v is required, if the network profile does not set it", name)
+	}
+	return field(profile), nil
+}
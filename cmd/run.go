@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/continuous"
+	"github.com/shutter-network/nethermind-tests/supervisor"
+	"github.com/shutter-network/nethermind-tests/tests"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+var modeNames = []string{"chiado", "gnosis", "send-wait", "continuous", "continuous-graffiti"}
+
+func runCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "run",
+		Usage: "run one or more test modes until they finish or are interrupted",
+		Description: "The modes are " + strings.Join(modeNames, ", ") + ". Without arguments, the modes are read from MODE,\n" +
+			"separated by commas. The chiado and gnosis modes use the rpc of the network profiles of the same name,\n" +
+			"if no url is given. The continuous modes use the selected network profile, overridden by the\n" +
+			"CONTINUOUS_* environment variables.",
+		ArgsUsage: "[modes...]",
+		Flags:     runFlags(),
+		Action:    runModes,
+	}
+}
+
+func runFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "mode", Usage: "comma separated modes, used when no modes are given as arguments", EnvVars: []string{"MODE"}},
+		&cli.StringFlag{Name: "private-key", Usage: "hex encoded key of the sending account", EnvVars: []string{"PRIVATE_KEY"}},
+		&cli.StringFlag{Name: "chiado-url", Usage: "rpc of the chiado mode", EnvVars: []string{"CHIADO_URL"}},
+		&cli.IntFlag{Name: "chiado-interval", Usage: "seconds between the transactions of the chiado mode", EnvVars: []string{"CHIADO_SEND_INTERVAL"}, Value: 60},
+		&cli.StringFlag{Name: "gnosis-url", Usage: "rpc of the gnosis mode", EnvVars: []string{"GNOSIS_URL"}},
+		&cli.IntFlag{Name: "gnosis-interval", Usage: "seconds between the transactions of the gnosis mode", EnvVars: []string{"GNOSIS_SEND_INTERVAL"}, Value: 600},
+		&cli.StringFlag{Name: "node-url", Usage: "rpc of the send-wait mode", EnvVars: []string{"NODE_URL"}},
+		&cli.IntFlag{Name: "wait-timeout", Usage: "seconds the send-wait mode waits for a receipt", EnvVars: []string{"WAIT_TX_TIMEOUT"}, Value: 10},
+		&cli.IntFlag{Name: "duration", Usage: "seconds the send-wait mode runs", EnvVars: []string{"TEST_DURATION"}, Value: 1},
+		&cli.StringFlag{Name: "tx-type", Usage: "legacy, access-list or dynamic-fee", EnvVars: []string{"TX_TYPE"}, Value: "legacy"},
+		&cli.StringFlag{Name: "tx-gas-strategy", Usage: "suggested, default, high-priority or min-tip", EnvVars: []string{"TX_GAS_STRATEGY"}, Value: "suggested"},
+		&cli.StringFlag{Name: "tx-to", Usage: "recipient of the transactions, defaults to the sender", EnvVars: []string{"TX_TO"}},
+		&cli.StringFlag{Name: "tx-value", Usage: "value of the transactions in wei", EnvVars: []string{"TX_VALUE"}, Value: "1"},
+		&cli.StringFlag{Name: "tx-data", Usage: "hex encoded calldata of the transactions", EnvVars: []string{"TX_DATA"}},
+		&cli.Uint64Flag{Name: "tx-gas-limit", Usage: "gas limit of the transactions, estimated if 0 and there is calldata", EnvVars: []string{"TX_GAS_LIMIT"}},
+		&cli.IntFlag{Name: "escalation-steps", Usage: "fee bumps of a stuck send-wait transaction before it is cancelled", EnvVars: []string{"ESCALATION_STEPS"}, Value: 3},
+		&cli.IntFlag{Name: "escalation-bump-percent", Usage: "fee increase of every bump", EnvVars: []string{"ESCALATION_BUMP_PERCENT"}, Value: 20},
+		&cli.StringFlag{Name: "escalation-max-gas-price", Usage: "fees are never bumped above this price in wei", EnvVars: []string{"ESCALATION_MAX_GAS_PRICE"}},
+		&cli.IntFlag{Name: "restart-limit", Usage: "restarts of a failed mode, negative for no limit", EnvVars: []string{"RESTART_LIMIT"}, Value: 5},
+		&cli.IntFlag{Name: "restart-backoff", Usage: "seconds before the first restart of a failed mode", EnvVars: []string{"RESTART_BACKOFF"}, Value: 1},
+		pkFileFlag(),
+		blameFolderFlag(),
+		&cli.StringFlag{Name: "report-format", Usage: "format of the blame files of the continuous modes, one of " + fmt.Sprint(continuous.ReportFormats), EnvVars: []string{"CONTINUOUS_REPORT_FORMAT"}, Value: "text"},
+		&cli.StringFlag{Name: "metrics-address", Usage: "serve prometheus metrics of the continuous modes at /metrics of this address, e.g. :9100", EnvVars: []string{"CONTINUOUS_METRICS_ADDRESS"}},
+		&cli.StringFlag{Name: "api-address", Usage: "serve the read-only status api at /api/ of this address, e.g. :8080", EnvVars: []string{"API_ADDRESS"}},
+		&cli.IntFlag{Name: "restart-max-backoff", Usage: "maximal seconds between restarts", EnvVars: []string{"RESTART_MAX_BACKOFF"}, Value: 60},
+	}
+}
+
+// configFromFlags creates the configuration of the chiado, gnosis and send-wait modes.
+func configFromFlags(c *cli.Context) (config.Config, error) {
+	cfg := config.Config{
+		Mode:                  c.String("mode"),
+		PrivateKey:            c.String("private-key"),
+		ChiadoURL:             c.String("chiado-url"),
+		ChiadoSendInterval:    time.Duration(c.Int("chiado-interval")) * time.Second,
+		GnosisURL:             c.String("gnosis-url"),
+		GnosisSendInterval:    time.Duration(c.Int("gnosis-interval")) * time.Second,
+		Timeout:               time.Duration(c.Int("wait-timeout")) * time.Second,
+		TestDuration:          time.Duration(c.Int("duration")) * time.Second,
+		NodeURL:               c.String("node-url"),
+		TxType:                c.String("tx-type"),
+		TxTo:                  c.String("tx-to"),
+		TxGasLimit:            c.Uint64("tx-gas-limit"),
+		TxGasStrategy:         c.String("tx-gas-strategy"),
+		EscalationSteps:       c.Int("escalation-steps"),
+		EscalationBumpPercent: c.Int("escalation-bump-percent"),
+		RestartLimit:          c.Int("restart-limit"),
+		RestartBackoff:        time.Duration(c.Int("restart-backoff")) * time.Second,
+		RestartMaxBackoff:     time.Duration(c.Int("restart-max-backoff")) * time.Second,
+	}
+	value, ok := new(big.Int).SetString(c.String("tx-value"), 10)
+	if !ok {
+		return cfg, fmt.Errorf("invalid tx-value %v", c.String("tx-value"))
+	}
+	cfg.TxValue = value
+	if c.String("tx-data") != "" {
+		data, err := hexutil.Decode(c.String("tx-data"))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid tx-data: %w", err)
+		}
+		cfg.TxData = data
+	}
+	if c.String("escalation-max-gas-price") != "" {
+		maxGasPrice, ok := new(big.Int).SetString(c.String("escalation-max-gas-price"), 10)
+		if !ok {
+			return cfg, fmt.Errorf("invalid escalation-max-gas-price %v", c.String("escalation-max-gas-price"))
+		}
+		cfg.EscalationMaxGasPrice = maxGasPrice
+	}
+	return cfg, nil
+}
+
+// selectedModes returns the modes given as arguments or else the ones from the mode flag.
+func selectedModes(c *cli.Context) ([]string, error) {
+	modes := c.Args().Slice()
+	if len(modes) == 0 && c.String("mode") != "" {
+		modes = strings.Split(c.String("mode"), ",")
+	}
+	if len(modes) == 0 {
+		return nil, fmt.Errorf("no modes given, choose from %v", strings.Join(modeNames, ", "))
+	}
+	for _, m := range modes {
+		if m == "collect" {
+			return nil, fmt.Errorf("collect is a command of its own, see `collect --help`")
+		}
+		if !slices.Contains(modeNames, m) {
+			return nil, fmt.Errorf("unknown mode %v, choose from %v", m, strings.Join(modeNames, ", "))
+		}
+	}
+	return modes, nil
+}
+
+func runModes(c *cli.Context) error {
+	modes, err := selectedModes(c)
+	if err != nil {
+		return err
+	}
+	cfg, err := configFromFlags(c)
+	if err != nil {
+		return err
+	}
+	err = applyProfiles(c, &cfg)
+	if err != nil {
+		return err
+	}
+	var network config.Profile
+	var options continuousOptions
+	if slices.Contains(modes, "continuous") || slices.Contains(modes, "continuous-graffiti") {
+		network, err = loadProfile(c, config.ContinuousEnv)
+		if err != nil {
+			return err
+		}
+		options, err = continuousOptionsFromFlags(c)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(modes, "continuous") && slices.Contains(modes, "continuous-graffiti") {
+			for _, env := range []string{"CONTINUOUS_JOURNAL_FILE", "CONTINUOUS_SCOREBOARD_FILE"} {
+				if os.Getenv(env) != "" {
+					return fmt.Errorf("%v can not be shared by the continuous modes, use the default file of each mode", env)
+				}
+			}
+		}
+		if len(network.Alerts.Webhooks) > 0 {
+			options.alerts, err = continuous.NewAlerter(network.Alerts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	workers := supervisor.New()
+	if c.String("api-address") != "" {
+		options.api = continuous.NewAPI(workers.Health)
+	}
+	servers, err := startServers(c.String("api-address"), options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}()
+	log.Println(strings.Join(modes, ","))
+	utils.EnableExtLoggingFile()
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Println("shutting down, interrupt again to exit immediately")
+		stop()
+	}()
+
+	policy := supervisor.Policy{
+		MaxRestarts:    cfg.RestartLimit,
+		InitialBackoff: cfg.RestartBackoff,
+		MaxBackoff:     cfg.RestartMaxBackoff,
+	}
+	for _, m := range modes {
+		switch m {
+		case "chiado":
+			workers.Go(ctx, m, policy, func(ctx context.Context) error {
+				return tests.RunChiadoTransactions(ctx, cfg)
+			})
+		case "gnosis":
+			workers.Go(ctx, m, policy, func(ctx context.Context) error {
+				return tests.RunGnosisTransactions(ctx, cfg)
+			})
+		case "send-wait":
+			workers.Go(ctx, m, policy, func(ctx context.Context) error {
+				return tests.RunSendAndWaitTest(ctx, cfg)
+			})
+		case "continuous":
+			workers.Go(ctx, m, policy, func(ctx context.Context) error {
+				return runContinuous(ctx, "standard", network, options)
+			})
+		case "continuous-graffiti":
+			workers.Go(ctx, m, policy, func(ctx context.Context) error {
+				return runContinuous(ctx, "graffiti", network, options)
+			})
+		}
+	}
+	workers.Wait()
+	for _, health := range workers.Health() {
+		log.Println(health)
+	}
+	return nil
+}
+
+// continuousOptions are the settings of the continuous modes, that are not part of the
+// network profile.
+type continuousOptions struct {
+	files          continuous.Files
+	reportFormat   string
+	metricsAddress string
+	// shared by the continuous modes, nil if the metrics are disabled
+	metrics *continuous.Metrics
+	// nil, if the status api is disabled
+	api *continuous.API
+	// shared by the continuous modes, nil if the profile has no alert webhooks
+	alerts *continuous.Alerter
+}
+
+func continuousOptionsFromFlags(c *cli.Context) (continuousOptions, error) {
+	options := continuousOptions{
+		files: continuous.Files{
+			PkFile:      c.String("pk-file"),
+			BlameFolder: c.String("blame-folder"),
+		},
+		reportFormat:   c.String("report-format"),
+		metricsAddress: c.String("metrics-address"),
+	}
+	if !slices.Contains(continuous.ReportFormats, options.reportFormat) {
+		return options, fmt.Errorf("unknown report-format %v, choose from %v", options.reportFormat, continuous.ReportFormats)
+	}
+	if options.metricsAddress != "" {
+		options.metrics = continuous.NewMetrics()
+	}
+	return options, nil
+}
+
+// startServers serves the status api at apiAddress and the metrics of options at their
+// address. Both share a server, if the addresses are the same.
+func startServers(apiAddress string, options continuousOptions) ([]*http.Server, error) {
+	muxes := make(map[string]*http.ServeMux)
+	mount := func(address, pattern string, handler http.Handler) {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+		}
+		muxes[address].Handle(pattern, handler)
+	}
+	if options.api != nil {
+		mount(apiAddress, "/api/", options.api.Handler())
+	}
+	if options.metrics != nil {
+		mount(options.metricsAddress, "/metrics", options.metrics.Handler())
+	}
+	var servers []*http.Server
+	for address, mux := range muxes {
+		server, err := continuous.Serve(address, mux)
+		if err != nil {
+			for _, started := range servers {
+				started.Close()
+			}
+			return nil, fmt.Errorf("could not serve at %v: %w", address, err)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+func runContinuous(ctx context.Context, mode string, network config.Profile, options continuousOptions) error {
+	cfg, err := continuous.Setup(mode, network, options.files)
+	if err != nil {
+		return err
+	}
+	// a restarted run sets up everything again and resumes the transactions in flight
+	defer cfg.Close()
+	cfg.ReportFormat = options.reportFormat
+	cfg.Metrics = options.metrics.Mode(mode)
+	options.api.Attach(mode, &cfg)
+	// the api must not use cfg, once it is closed
+	defer options.api.Detach(mode, &cfg)
+	// stop the helpers of this run, when it fails and is restarted. A panic in one of them
+	// fails the run.
+	helpers := supervisor.NewGroup(ctx)
+	defer helpers.Cancel()
+	cfg.Helpers = helpers
+	runCtx := helpers.Context()
+	continuous.ResumeWatchers(&cfg)
+	fmt.Println("Running continous tx tests...")
+	lastStats := time.Now().Unix()
+	cache := continuous.BlockCache{}
+	if cfg.HasObserver() {
+		helpers.Go(func() { continuous.PrimeBlockCache(runCtx, &cache, &cfg) })
+	}
+	helpers.Go(func() { continuous.RunPipeline(runCtx, &cfg) })
+	helpers.Go(func() { continuous.RunMetrics(runCtx, &cfg) })
+	helpers.Go(func() { options.alerts.Run(runCtx, mode, &cfg) })
+	startBlock := uint64(0)
+	blocks := make(chan continuous.ShutterBlock)
+	helpers.Go(func() { continuous.QueryAllShutterBlocks(runCtx, blocks, &cfg, mode) })
+	for {
+		var block continuous.ShutterBlock
+		select {
+		case <-runCtx.Done():
+			if err := helpers.Err(); err != nil {
+				return err
+			}
+			log.Println("stopping continuous tx tests")
+			return continuous.Shutdown(startBlock, &cache, &cfg, continuous.ShutdownTimeout)
+		case block = <-blocks:
+		}
+		if startBlock == 0 {
+			startBlock = uint64(block.Number)
+		}
+		continuous.CheckTxInFlight(block.Number, &cfg)
+		continuous.SendShutterizedTX(block.Number, block.Ts, block.TargetedSlot, block.DetectedAt, &cfg)
+		now := time.Now().Unix()
+		if cfg.HasObserver() && now-lastStats > 12 {
+			log.Println("running stats")
+			lastStats = now
+			err = continuous.CollectContinuousTestStats(startBlock, uint64(block.Number), &cache, &cfg)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/shutter-network/nethermind-tests/config"
+)
+
+func stressCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "stress",
+		Usage: "run the stress test suite with `go test`",
+		Description: "The stress tests are go tests, so this needs the source tree and a go toolchain. They use the\n" +
+			"selected network profile, overridden by the flags. Without an rpc url, the tests run against the\n" +
+			"in-process shutter simulator.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "run", Usage: "only run the tests matching this regular expression", Value: "Stress"},
+			&cli.StringFlag{Name: "dir", Usage: "directory of the stress test package", Value: "./stress"},
+			&cli.StringFlag{Name: "timeout", Usage: "timeout of the whole suite", Value: "30m"},
+			&cli.StringFlag{Name: "rpc-url", Usage: "rpc of the chain", EnvVars: []string{"STRESS_TEST_RPC_URL"}},
+			&cli.StringFlag{Name: "pk", Usage: "hex encoded key of a funded account", EnvVars: []string{"STRESS_TEST_PK"}},
+			&cli.StringFlag{Name: "key-broadcast-contract", Usage: "address of the key broadcast contract", EnvVars: []string{"STRESS_TEST_KEY_BROADCAST_CONTRACT_ADDRESS"}},
+			&cli.StringFlag{Name: "sequencer-contract", Usage: "address of the sequencer contract", EnvVars: []string{"STRESS_TEST_SEQUENCER_CONTRACT_ADDRESS"}},
+			&cli.StringFlag{Name: "keyper-set-manager-contract", Usage: "address of the keyper set manager contract", EnvVars: []string{"STRESS_TEST_KEYPER_SET_MANAGER_CONTRACT_ADDRESS"}},
+		},
+		Action: runStress,
+	}
+}
+
+func runStress(c *cli.Context) error {
+	// the tests run in their own directory
+	configFile, err := filepath.Abs(c.String("config"))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configFile); err != nil && c.String("config") == config.DefaultFile {
+		configFile = ""
+	}
+	test := exec.CommandContext(c.Context, "go", "test", "-v", "-count=1",
+		"-timeout", c.String("timeout"), "-run", c.String("run"), ".")
+	test.Dir = c.String("dir")
+	test.Stdout = os.Stdout
+	test.Stderr = os.Stderr
+	test.Env = append(os.Environ(),
+		"CONFIG_FILE="+configFile,
+		"NETWORK="+c.String("network"),
+		"STRESS_TEST_RPC_URL="+c.String("rpc-url"),
+		"STRESS_TEST_PK="+c.String("pk"),
+		"STRESS_TEST_KEY_BROADCAST_CONTRACT_ADDRESS="+c.String("key-broadcast-contract"),
+		"STRESS_TEST_SEQUENCER_CONTRACT_ADDRESS="+c.String("sequencer-contract"),
+		"STRESS_TEST_KEYPER_SET_MANAGER_CONTRACT_ADDRESS="+c.String("keyper-set-manager-contract"),
+	)
+	return test.Run()
+}
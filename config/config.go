@@ -1,14 +1,12 @@
 package config
 
 import (
-	"log"
-	"os"
-	"strconv"
+	"math/big"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
+// Config is the configuration of the chiado, gnosis and send-wait modes. It is created
+// from the flags of the run command.
 type Config struct {
 	Mode               string
 	PrivateKey         string
@@ -20,35 +18,19 @@ type Config struct {
 	Timeout            time.Duration
 	TestDuration       time.Duration
 	NodeURL            string
-}
-
-func LoadConfig() Config {
-	// Load the .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	config := Config{
-		Mode:               os.Getenv("MODE"),
-		PrivateKey:         os.Getenv("PRIVATE_KEY"),
-		ChiadoURL:          os.Getenv("CHIADO_URL"),
-		ChiadoSendInterval: time.Duration(GetEnvAsInt("CHIADO_SEND_INTERVAL")) * time.Second,
-		GnosisURL:          os.Getenv("GNOSIS_URL"),
-		GnosisSendInterval: time.Duration(GetEnvAsInt("GNOSIS_SEND_INTERVAL")) * time.Second,
-		Timeout:            time.Duration(GetEnvAsInt("WAIT_TX_TIMEOUT")) * time.Second,
-		TestDuration:       time.Duration(GetEnvAsInt("TEST_DURATION")) * time.Second,
-		NodeURL:            os.Getenv("NODE_URL"),
-	}
-
-	return config
-}
-
-func GetEnvAsInt(name string) int {
-	valueStr := os.Getenv(name)
-	value, err := strconv.Atoi(valueStr)
-	if err != nil {
-		log.Fatalf("Invalid value for %s: %v.", name, err)
-	}
-	return value
+	// transactions sent by the chiado, gnosis and send-wait modes
+	TxType        string
+	TxTo          string
+	TxValue       *big.Int
+	TxData        []byte
+	TxGasLimit    uint64
+	TxGasStrategy string
+	// replace-by-fee escalation of the send-wait mode
+	EscalationSteps       int
+	EscalationBumpPercent int
+	EscalationMaxGasPrice *big.Int
+	// restart policy for failed modes
+	RestartLimit      int
+	RestartBackoff    time.Duration
+	RestartMaxBackoff time.Duration
 }
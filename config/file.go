@@ -0,0 +1,273 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read, when no other configuration file is given. It is optional.
+const DefaultFile = "config.yaml"
+
+// File is the configuration file, that holds the settings of every network the tests
+// can run against.
+type File struct {
+	// profile used, when none is selected
+	Network  string             `yaml:"network"`
+	Networks map[string]Profile `yaml:"networks"`
+	// chains in addition to the KnownPresets, e.g. a local devnet or a new deployment
+	Presets []Preset `yaml:"presets"`
+}
+
+// Profile holds the settings of one network.
+type Profile struct {
+	RPCURL string `yaml:"rpcUrl"`
+	// expected chain ID of the rpc, not checked if 0
+	ChainID uint64 `yaml:"chainId"`
+	// hex encoded key of the funded main test account
+	PrivateKey       string    `yaml:"privateKey"`
+	Contracts        Contracts `yaml:"contracts"`
+	GenesisTimestamp uint64    `yaml:"genesisTimestamp"`
+	SecondsPerSlot   uint64    `yaml:"secondsPerSlot"`
+	SlotsPerEpoch    uint64    `yaml:"slotsPerEpoch"`
+	DB               DB        `yaml:"db"`
+	// where continuous mode detects shutterized blocks: "observer" (default) or "beacon"
+	ShutterBlocks string `yaml:"shutterBlocks"`
+	// beacon node API, that serves the proposer duties for the "beacon" shutter blocks
+	BeaconURL string `yaml:"beaconUrl"`
+	Alerts    Alerts `yaml:"alerts"`
+}
+
+type Contracts struct {
+	Sequencer        string `yaml:"sequencer"`
+	KeyperSetManager string `yaml:"keyperSetManager"`
+	KeyBroadcast     string `yaml:"keyBroadcast"`
+	// looked up by chain ID, if empty
+	DepositContract string `yaml:"depositContract"`
+	// registrations of the shutter validators, read for the "beacon" shutter blocks
+	ValidatorRegistry string `yaml:"validatorRegistry"`
+	// block, from which on the registrations are read, e.g. the deployment of the registry
+	ValidatorRegistryStartBlock uint64 `yaml:"validatorRegistryStartBlock"`
+}
+
+// Alerts are the alert rules of the continuous modes and the webhooks, that are notified
+// when an alert fires and when it is resolved. A rule with a zero threshold is disabled.
+type Alerts struct {
+	Webhooks []Webhook `yaml:"webhooks"`
+	// percentage of failed test transactions of the last FailureWindow shutter blocks
+	MaxFailurePct float64 `yaml:"maxFailurePct"`
+	// number of shutter blocks, 20 if 0
+	FailureWindow int `yaml:"failureWindow"`
+	// time without a detected shutterized block
+	NoTrigger time.Duration `yaml:"noTrigger"`
+	// balance of the submit account in wei
+	MinSubmitBalance string `yaml:"minSubmitBalance"`
+	// time, after which the eon is expected to have changed
+	MaxEonAge time.Duration `yaml:"maxEonAge"`
+	// number of test transactions in a row, that ended in a SystemFailure
+	MaxSystemFailures int `yaml:"maxSystemFailures"`
+	// time after which a firing alert is sent again, never if 0
+	RepeatInterval time.Duration `yaml:"repeatInterval"`
+}
+
+// Webhook receives the alerts as JSON.
+type Webhook struct {
+	URL string `yaml:"url"`
+	// layout of the payload: "generic" (default), "slack" or "matrix"
+	Format string `yaml:"format"`
+}
+
+// DB is the connection to the observer database.
+type DB struct {
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+	Addr string `yaml:"addr"`
+	Name string `yaml:"name"`
+}
+
+// LoadFile reads the configuration file at path. A missing DefaultFile results in an
+// empty configuration, so that everything can still be set from the environment.
+func LoadFile(path string) (File, error) {
+	var file File
+	if path == "" {
+		path = DefaultFile
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && path == DefaultFile {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("could not read config %v: %w", path, err)
+	}
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return file, fmt.Errorf("invalid config %v: %w", path, err)
+	}
+	return file, nil
+}
+
+// Registry returns the KnownPresets together with the presets of the file.
+func (f File) Registry() (Registry, error) {
+	return KnownPresets.With(f.Presets...)
+}
+
+// Profile returns the settings of the network name or of the default network, if name
+// is empty. Without any networks in the file, the profile is empty. The settings, that the
+// profile leaves empty, are taken from the preset of its chain ID.
+func (f File) Profile(name string) (Profile, error) {
+	profile, err := f.selectProfile(name)
+	if err != nil || profile.ChainID == 0 {
+		return profile, err
+	}
+	registry, err := f.Registry()
+	if err != nil {
+		return Profile{}, err
+	}
+	if preset, ok := registry[profile.ChainID]; ok {
+		profile = profile.WithPreset(preset)
+	}
+	return profile, nil
+}
+
+func (f File) selectProfile(name string) (Profile, error) {
+	if name == "" {
+		name = f.Network
+	}
+	if name == "" {
+		if len(f.Networks) > 1 {
+			return Profile{}, fmt.Errorf("no network selected, choose from %v", f.names())
+		}
+		for _, profile := range f.Networks {
+			return profile, nil
+		}
+		return Profile{}, nil
+	}
+	profile, ok := f.Networks[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown network %v, choose from %v", name, f.names())
+	}
+	return profile, nil
+}
+
+func (f File) names() []string {
+	names := make([]string, 0, len(f.Networks))
+	for name := range f.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvOverrides names the environment variables, that override the fields of a profile.
+// Empty names are not overridden.
+type EnvOverrides struct {
+	RPCURL            string
+	PrivateKey        string
+	Sequencer         string
+	KeyperSetManager  string
+	KeyBroadcast      string
+	ValidatorRegistry string
+	DBUser            string
+	DBPass            string
+	DBAddr            string
+	DBName            string
+	ShutterBlocks     string
+	BeaconURL         string
+}
+
+// ContinuousEnv are the variables of the continuous and collect modes.
+var ContinuousEnv = EnvOverrides{
+	RPCURL:            "CONTINUOUS_TEST_RPC_URL",
+	PrivateKey:        "CONTINUOUS_TEST_PK",
+	Sequencer:         "CONTINUOUS_SEQUENCER_ADDRESS",
+	KeyperSetManager:  "CONTINUOUS_KEYPER_SET_CONTRACT_ADDRESS",
+	KeyBroadcast:      "CONTINUOUS_KEY_BROADCAST_CONTRACT_ADDRESS",
+	ValidatorRegistry: "CONTINUOUS_VALIDATOR_REGISTRY_ADDRESS",
+	DBUser:            "CONTINUOUS_DB_USER",
+	DBPass:            "CONTINUOUS_DB_PASS",
+	DBAddr:            "CONTINUOUS_DB_ADDRESS",
+	DBName:            "CONTINUOUS_DB_NAME",
+	ShutterBlocks:     "CONTINUOUS_SHUTTER_BLOCKS",
+	BeaconURL:         "CONTINUOUS_BEACON_URL",
+}
+
+// StressEnv are the variables of the stress test suite.
+var StressEnv = EnvOverrides{
+	RPCURL:           "STRESS_TEST_RPC_URL",
+	PrivateKey:       "STRESS_TEST_PK",
+	Sequencer:        "STRESS_TEST_SEQUENCER_CONTRACT_ADDRESS",
+	KeyperSetManager: "STRESS_TEST_KEYPER_SET_MANAGER_CONTRACT_ADDRESS",
+	KeyBroadcast:     "STRESS_TEST_KEY_BROADCAST_CONTRACT_ADDRESS",
+}
+
+// WithEnv returns p with every field replaced, whose variable in names is set.
+func (p Profile) WithEnv(names EnvOverrides) Profile {
+	override := func(field *string, name string) {
+		if name == "" {
+			return
+		}
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	override(&p.RPCURL, names.RPCURL)
+	override(&p.PrivateKey, names.PrivateKey)
+	override(&p.Contracts.Sequencer, names.Sequencer)
+	override(&p.Contracts.KeyperSetManager, names.KeyperSetManager)
+	override(&p.Contracts.KeyBroadcast, names.KeyBroadcast)
+	override(&p.Contracts.ValidatorRegistry, names.ValidatorRegistry)
+	override(&p.DB.User, names.DBUser)
+	override(&p.DB.Pass, names.DBPass)
+	override(&p.DB.Addr, names.DBAddr)
+	override(&p.DB.Name, names.DBName)
+	override(&p.ShutterBlocks, names.ShutterBlocks)
+	override(&p.BeaconURL, names.BeaconURL)
+	return p
+}
+
+// Require returns an error naming the first missing setting of the given ones. The
+// names of fields are the yaml keys, e.g. "rpcUrl" or "contracts.sequencer".
+func (p Profile) Require(names EnvOverrides, fields ...string) error {
+	values := map[string][2]string{
+		"rpcUrl":                      {p.RPCURL, names.RPCURL},
+		"privateKey":                  {p.PrivateKey, names.PrivateKey},
+		"contracts.sequencer":         {p.Contracts.Sequencer, names.Sequencer},
+		"contracts.keyperSetManager":  {p.Contracts.KeyperSetManager, names.KeyperSetManager},
+		"contracts.keyBroadcast":      {p.Contracts.KeyBroadcast, names.KeyBroadcast},
+		"contracts.validatorRegistry": {p.Contracts.ValidatorRegistry, names.ValidatorRegistry},
+		"beaconUrl":                   {p.BeaconURL, names.BeaconURL},
+		"db.user":                     {p.DB.User, names.DBUser},
+		"db.pass":                     {p.DB.Pass, names.DBPass},
+		"db.addr":                     {p.DB.Addr, names.DBAddr},
+		"db.name":                     {p.DB.Name, names.DBName},
+	}
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok {
+			return fmt.Errorf("unknown config field %v", field)
+		}
+		if value[0] != "" {
+			continue
+		}
+		if value[1] != "" {
+			return fmt.Errorf("%v is not configured, set it in the network profile or %v", field, value[1])
+		}
+		return fmt.Errorf("%v is not configured in the network profile", field)
+	}
+	return nil
+}
+
+// CheckChainID returns an error, if the profile expects another chain than the one of
+// the rpc.
+func (p Profile) CheckChainID(chainID *big.Int) error {
+	if p.ChainID != 0 && (!chainID.IsUint64() || chainID.Uint64() != p.ChainID) {
+		return fmt.Errorf("rpc is on chain %v, but the network profile expects %v", chainID, p.ChainID)
+	}
+	return nil
+}
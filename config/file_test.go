@@ -0,0 +1,105 @@
+package config
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestLoadExampleFile(t *testing.T) {
+	file, err := LoadFile("../config.example.yaml")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, file.names(), []string{"chiado", "devnet", "gnosis", "local"})
+
+	profile, err := file.Profile("")
+	assert.NilError(t, err)
+	assert.Equal(t, profile.ChainID, uint64(10200))
+	assert.Equal(t, profile.SecondsPerSlot, uint64(5))
+	assert.Equal(t, profile.DB.Name, "shutter_metrics")
+	assert.Equal(t, profile.Alerts.Webhooks[0].Format, "slack")
+	assert.Equal(t, profile.Alerts.NoTrigger, 30*time.Minute)
+
+	profile, err = file.Profile("gnosis")
+	assert.NilError(t, err)
+	assert.Equal(t, profile.ChainID, uint64(100))
+	assert.Equal(t, profile.GenesisTimestamp, uint64(1638993340))
+
+	assert.Equal(t, profile.Contracts.DepositContract, "0x0B98057eA310F4d31F2a452B414647007d1645d9")
+
+	profile, err = file.Profile("devnet")
+	assert.NilError(t, err)
+	assert.Equal(t, profile.GenesisTimestamp, uint64(1700000000))
+	assert.Equal(t, profile.Contracts.Sequencer, "0xffffffffffffffffffffffffffffffffffffffff")
+	assert.Equal(t, profile.DB.Name, "shutter_metrics")
+
+	_, err = file.Profile("mainnet")
+	assert.ErrorContains(t, err, "unknown network mainnet")
+}
+
+func TestLoadFile(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	file, err := LoadFile("")
+	assert.NilError(t, err)
+	profile, err := file.Profile("")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, profile, Profile{})
+
+	_, err = LoadFile("missing.yaml")
+	assert.ErrorContains(t, err, "could not read config")
+
+	assert.NilError(t, os.WriteFile(DefaultFile, []byte("networks:\n  a: {chainId: 1}\n  b: {chainId: 2}\n"), 0o600))
+	file, err = LoadFile("")
+	assert.NilError(t, err)
+	_, err = file.Profile("")
+	assert.ErrorContains(t, err, "no network selected")
+
+	invalid := path.Join(t.TempDir(), "invalid.yaml")
+	assert.NilError(t, os.WriteFile(invalid, []byte("networks: [1, 2]"), 0o600))
+	_, err = LoadFile(invalid)
+	assert.ErrorContains(t, err, "invalid config")
+}
+
+func TestWithEnv(t *testing.T) {
+	profile := Profile{RPCURL: "http://file", PrivateKey: "abcd"}
+	profile.DB.Name = "metrics"
+	t.Setenv("STRESS_TEST_RPC_URL", "http://env")
+	t.Setenv("CONTINUOUS_DB_NAME", "other")
+	t.Setenv("CONTINUOUS_BEACON_URL", "http://beacon")
+
+	stress := profile.WithEnv(StressEnv)
+	assert.Equal(t, stress.RPCURL, "http://env")
+	assert.Equal(t, stress.PrivateKey, "abcd")
+	// the stress tests have no database
+	assert.Equal(t, stress.DB.Name, "metrics")
+
+	continuous := profile.WithEnv(ContinuousEnv)
+	assert.Equal(t, continuous.RPCURL, "http://file")
+	assert.Equal(t, continuous.DB.Name, "other")
+	assert.Equal(t, continuous.BeaconURL, "http://beacon")
+	assert.Equal(t, stress.BeaconURL, "")
+	// the profile itself is not modified
+	assert.Equal(t, profile.RPCURL, "http://file")
+}
+
+func TestRequire(t *testing.T) {
+	profile := Profile{RPCURL: "http://file"}
+	assert.NilError(t, profile.Require(ContinuousEnv, "rpcUrl"))
+	assert.ErrorContains(t, profile.Require(ContinuousEnv, "rpcUrl", "contracts.sequencer"),
+		"contracts.sequencer is not configured, set it in the network profile or CONTINUOUS_SEQUENCER_ADDRESS")
+	assert.ErrorContains(t, profile.Require(StressEnv, "db.name"), "db.name is not configured in the network profile")
+	assert.ErrorContains(t, profile.Require(ContinuousEnv, "beaconUrl"), "set it in the network profile or CONTINUOUS_BEACON_URL")
+	assert.ErrorContains(t, profile.Require(StressEnv, "rpc"), "unknown config field rpc")
+}
+
+func TestCheckChainID(t *testing.T) {
+	assert.NilError(t, Profile{}.CheckChainID(big.NewInt(100)))
+	assert.NilError(t, Profile{ChainID: 100}.CheckChainID(big.NewInt(100)))
+	assert.ErrorContains(t, Profile{ChainID: 10200}.CheckChainID(big.NewInt(100)), "expects 10200")
+}
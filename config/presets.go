@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Preset holds the fixed parameters of a chain, that fill the settings a profile leaves
+// empty.
+type Preset struct {
+	Name             string    `yaml:"name"`
+	ChainID          uint64    `yaml:"chainId"`
+	Contracts        Contracts `yaml:"contracts"`
+	GenesisTimestamp uint64    `yaml:"genesisTimestamp"`
+	SecondsPerSlot   uint64    `yaml:"secondsPerSlot"`
+	SlotsPerEpoch    uint64    `yaml:"slotsPerEpoch"`
+}
+
+// Registry holds the presets by chain ID.
+type Registry map[uint64]Preset
+
+// KnownPresets are the networks, that need no configuration beyond a profile with their
+// chain ID.
+var KnownPresets = Registry{
+	100: {
+		Name:             "gnosis",
+		ChainID:          100,
+		Contracts:        Contracts{DepositContract: "0x0B98057eA310F4d31F2a452B414647007d1645d9"},
+		GenesisTimestamp: 1638993340,
+		SecondsPerSlot:   5,
+		SlotsPerEpoch:    16,
+	},
+	10200: {
+		Name:             "chiado",
+		ChainID:          10200,
+		Contracts:        Contracts{DepositContract: "0xb97036A26259B7147018913bD58a774cf91acf25"},
+		GenesisTimestamp: 1665396300,
+		SecondsPerSlot:   5,
+		SlotsPerEpoch:    16,
+	},
+}
+
+// Lookup returns the preset of chainID.
+func (r Registry) Lookup(chainID *big.Int) (Preset, bool) {
+	if chainID == nil || !chainID.IsUint64() {
+		return Preset{}, false
+	}
+	preset, ok := r[chainID.Uint64()]
+	return preset, ok
+}
+
+// With returns a copy of r with presets added. The settings of a preset for a known chain
+// take precedence over the ones of the known preset, the others are kept.
+func (r Registry) With(presets ...Preset) (Registry, error) {
+	result := make(Registry, len(r)+len(presets))
+	for chainID, preset := range r {
+		result[chainID] = preset
+	}
+	for _, preset := range presets {
+		if preset.ChainID == 0 {
+			return nil, fmt.Errorf("preset %v has no chain ID", preset.Name)
+		}
+		result[preset.ChainID] = preset.merge(result[preset.ChainID])
+	}
+	return result, nil
+}
+
+// merge returns p with its empty settings taken from defaults.
+func (p Preset) merge(defaults Preset) Preset {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&p.Name, defaults.Name)
+	fill(&p.Contracts.Sequencer, defaults.Contracts.Sequencer)
+	fill(&p.Contracts.KeyperSetManager, defaults.Contracts.KeyperSetManager)
+	fill(&p.Contracts.KeyBroadcast, defaults.Contracts.KeyBroadcast)
+	fill(&p.Contracts.DepositContract, defaults.Contracts.DepositContract)
+	fill(&p.Contracts.ValidatorRegistry, defaults.Contracts.ValidatorRegistry)
+	if p.Contracts.ValidatorRegistryStartBlock == 0 {
+		p.Contracts.ValidatorRegistryStartBlock = defaults.Contracts.ValidatorRegistryStartBlock
+	}
+	if p.GenesisTimestamp == 0 {
+		p.GenesisTimestamp = defaults.GenesisTimestamp
+	}
+	if p.SecondsPerSlot == 0 {
+		p.SecondsPerSlot = defaults.SecondsPerSlot
+	}
+	if p.SlotsPerEpoch == 0 {
+		p.SlotsPerEpoch = defaults.SlotsPerEpoch
+	}
+	return p
+}
+
+// WithPreset returns p with its empty contract addresses and chain parameters taken from
+// preset.
+func (p Profile) WithPreset(preset Preset) Profile {
+	merged := Preset{
+		Contracts:        p.Contracts,
+		GenesisTimestamp: p.GenesisTimestamp,
+		SecondsPerSlot:   p.SecondsPerSlot,
+		SlotsPerEpoch:    p.SlotsPerEpoch,
+	}.merge(preset)
+	p.Contracts = merged.Contracts
+	p.GenesisTimestamp = merged.GenesisTimestamp
+	p.SecondsPerSlot = merged.SecondsPerSlot
+	p.SlotsPerEpoch = merged.SlotsPerEpoch
+	if p.ChainID == 0 {
+		p.ChainID = preset.ChainID
+	}
+	return p
+}
+
+// ForChain returns p completed by the known preset of chainID, for profiles that were
+// configured without a chain ID.
+func (p Profile) ForChain(chainID *big.Int) Profile {
+	if p.ChainID != 0 {
+		return p
+	}
+	preset, ok := KnownPresets.Lookup(chainID)
+	if !ok {
+		return p
+	}
+	return p.WithPreset(preset)
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"math/big"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestRegistryWith(t *testing.T) {
+	registry, err := KnownPresets.With(
+		Preset{ChainID: 100, Contracts: Contracts{Sequencer: "0x01"}},
+		Preset{Name: "devnet", ChainID: 7, SecondsPerSlot: 2},
+	)
+	assert.NilError(t, err)
+	gnosis, ok := registry.Lookup(big.NewInt(100))
+	assert.Assert(t, ok)
+	assert.Equal(t, gnosis.Name, "gnosis")
+	assert.Equal(t, gnosis.Contracts.Sequencer, "0x01")
+	assert.Equal(t, gnosis.Contracts.DepositContract, KnownPresets[100].Contracts.DepositContract)
+	assert.Equal(t, gnosis.SlotsPerEpoch, uint64(16))
+	devnet, ok := registry.Lookup(big.NewInt(7))
+	assert.Assert(t, ok)
+	assert.Equal(t, devnet.SecondsPerSlot, uint64(2))
+	// the known presets are not modified
+	assert.Equal(t, KnownPresets[100].Contracts.Sequencer, "")
+	_, ok = KnownPresets.Lookup(big.NewInt(7))
+	assert.Assert(t, !ok)
+
+	_, err = KnownPresets.With(Preset{Name: "broken"})
+	assert.ErrorContains(t, err, "preset broken has no chain ID")
+}
+
+func TestForChain(t *testing.T) {
+	profile := Profile{SecondsPerSlot: 12}
+	chiado := profile.ForChain(big.NewInt(10200))
+	assert.Equal(t, chiado.ChainID, uint64(10200))
+	assert.Equal(t, chiado.GenesisTimestamp, uint64(1665396300))
+	assert.Equal(t, chiado.SecondsPerSlot, uint64(12))
+	assert.Equal(t, chiado.SlotsPerEpoch, uint64(16))
+
+	assert.DeepEqual(t, profile.ForChain(big.NewInt(1337)), profile)
+	// profiles with a chain ID are completed when they are selected
+	assert.DeepEqual(t, Profile{ChainID: 1}.ForChain(big.NewInt(10200)), Profile{ChainID: 1})
+}
@@ -9,11 +9,10 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/shutter-network/nethermind-tests/utils"
 )
 
-func retrieveAccounts(num int, client *ethclient.Client, signerForChain types.Signer, cfg *Configuration) []utils.Account {
+func retrieveAccounts(num int, client utils.Backend, signerForChain types.Signer, cfg *Configuration) []utils.Account {
 	var result []utils.Account
 	fd, err := os.Open(cfg.PkFile)
 	if err != nil {
@@ -36,17 +35,12 @@ func retrieveAccounts(num int, client *ethclient.Client, signerForChain types.Si
 		}
 	}
 	for i := range result {
-		accNonce, err := client.NonceAt(context.Background(), result[i].Address, nil)
-		if err != nil {
-			log.Printf("failed to get nonce for %v: %v\n", result[i].Address, err)
-		}
-		log.Printf("setting account nonce for %v to %v\n", result[i].Address.Hex(), accNonce)
-		result[i].Nonce = big.NewInt(int64(accNonce))
+		result[i].Nonces = cfg.nonces
 	}
 	return result
 }
 
-func fundNewAccount(account utils.Account, amount int64, submitAccount *utils.Account, client *ethclient.Client) error {
+func fundNewAccount(account utils.Account, amount int64, submitAccount *utils.Account, client utils.Backend) error {
 	target := big.NewInt(amount)
 	current, err := client.BalanceAt(context.Background(), account.Address, nil)
 	if err != nil {
@@ -64,18 +58,20 @@ func fundNewAccount(account utils.Account, amount int64, submitAccount *utils.Ac
 		return err
 	}
 	var data []byte
-	nonce := submitAccount.UseNonce()
+	nonce, err := submitAccount.NextNonce()
 	if err != nil {
 		return err
 	}
 	log.Printf("Using submitter nonce %v\n", nonce)
-	tx := types.NewTransaction(nonce.Uint64(), account.Address, missing, gasLimit, gasPrice, data)
+	tx := types.NewTransaction(nonce, account.Address, missing, gasLimit, gasPrice, data)
 	signedTx, err := submitAccount.Sign(submitAccount.Address, tx)
 	if err != nil {
+		submitAccount.ReleaseNonce(nonce)
 		return err
 	}
 	err = client.SendTransaction(context.Background(), signedTx)
 	if err != nil {
+		submitAccount.ReleaseNonce(nonce)
 		return err
 	}
 	log.Println("sent funding tx", signedTx.Hash().Hex(), "to", signedTx.To().Hex())
@@ -83,7 +79,7 @@ func fundNewAccount(account utils.Account, amount int64, submitAccount *utils.Ac
 	return err
 }
 
-func createAccounts(num int, signerForChain types.Signer) ([]utils.Account, error) {
+func createAccounts(num int, signerForChain types.Signer, nonces *utils.NonceManager) ([]utils.Account, error) {
 	accounts := make([]utils.Account, num)
 	for i := 0; i < num; i++ {
 		pk, err := crypto.GenerateKey()
@@ -94,6 +90,7 @@ func createAccounts(num int, signerForChain types.Signer) ([]utils.Account, erro
 		if err != nil {
 			return accounts, err
 		}
+		account.Nonces = nonces
 		accounts[i] = account
 	}
 	return accounts, nil
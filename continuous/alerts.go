@@ -0,0 +1,364 @@
+package continuous
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shutter-network/nethermind-tests/config"
+)
+
+// alertInterval is the time between the evaluations of the alert rules.
+var alertInterval = 15 * time.Second
+
+const (
+	// the number of shutter blocks of the failure rate, if the profile has none
+	defaultFailureWindow = 20
+	webhookTimeout       = 10 * time.Second
+)
+
+// WebhookFormats are the known layouts of the webhook payloads.
+var WebhookFormats = []string{"generic", "slack", "matrix"}
+
+// Alert is the payload of the generic webhooks.
+type Alert struct {
+	Rule string `json:"rule"`
+	// firing or resolved
+	Status   string     `json:"status"`
+	Mode     string     `json:"mode"`
+	Summary  string     `json:"summary"`
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+}
+
+// text is the one line message of the chat webhooks.
+func (a Alert) text() string {
+	if a.Status == "resolved" {
+		return fmt.Sprintf("[RESOLVED] %v/%v: %v (since %v)", a.Mode, a.Rule, a.Summary, a.StartsAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("[FIRING] %v/%v: %v", a.Mode, a.Rule, a.Summary)
+}
+
+// alertRule checks a condition of a continuous mode. check returns the summary of the
+// alert, "" if the condition is not met.
+type alertRule struct {
+	name  string
+	check func(ctx context.Context, a *Alerter, mode string, cfg *Configuration) (string, error)
+}
+
+type activeAlert struct {
+	alert  Alert
+	sentAt time.Time
+}
+
+// Alerter evaluates the alert rules of the continuous modes and posts the alerts to the
+// webhooks. An alert is sent when it starts firing, again after the repeat interval and
+// once more when it is resolved. It is shared by the modes of the process, so that the
+// active alerts survive the restarts of a mode.
+type Alerter struct {
+	config     config.Alerts
+	minBalance *big.Int
+	rules      []alertRule
+	client     *http.Client
+	now        func() time.Time
+
+	mu     sync.Mutex
+	active map[string]*activeAlert
+	// when each mode was started, for the no-trigger rule
+	started map[string]time.Time
+	// the time of the activation block by eon
+	eonActivations map[uint64]time.Time
+}
+
+// NewAlerter returns the alerter of the rules in alerts, that have a threshold.
+func NewAlerter(alerts config.Alerts) (*Alerter, error) {
+	a := &Alerter{
+		config:         alerts,
+		client:         &http.Client{Timeout: webhookTimeout},
+		now:            time.Now,
+		active:         make(map[string]*activeAlert),
+		started:        make(map[string]time.Time),
+		eonActivations: make(map[uint64]time.Time),
+	}
+	for _, webhook := range alerts.Webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("alert webhook without url")
+		}
+		if webhook.Format != "" && !slices.Contains(WebhookFormats, webhook.Format) {
+			return nil, fmt.Errorf("unknown webhook format %v, choose from %v", webhook.Format, WebhookFormats)
+		}
+	}
+	if alerts.FailureWindow < 0 || alerts.FailureWindow > RecentShutterBlocks {
+		return nil, fmt.Errorf("invalid failureWindow %v, at most %v shutter blocks are kept", alerts.FailureWindow, RecentShutterBlocks)
+	}
+	if alerts.MaxFailurePct > 0 {
+		a.rules = append(a.rules, alertRule{"failure-rate", checkFailureRate})
+	}
+	if alerts.NoTrigger > 0 {
+		a.rules = append(a.rules, alertRule{"no-trigger", checkNoTrigger})
+	}
+	if alerts.MinSubmitBalance != "" {
+		minBalance, ok := new(big.Int).SetString(alerts.MinSubmitBalance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid minSubmitBalance %v", alerts.MinSubmitBalance)
+		}
+		a.minBalance = minBalance
+		a.rules = append(a.rules, alertRule{"submit-balance", checkSubmitBalance})
+	}
+	if alerts.MaxEonAge > 0 {
+		a.rules = append(a.rules, alertRule{"eon-age", checkEonAge})
+	}
+	if alerts.MaxSystemFailures > 0 {
+		a.rules = append(a.rules, alertRule{"system-failures", checkSystemFailures})
+	}
+	return a, nil
+}
+
+// Run evaluates the rules for the continuous mode until ctx is done. It does nothing
+// on a nil Alerter.
+func (a *Alerter) Run(ctx context.Context, mode string, cfg *Configuration) {
+	if a == nil || len(a.rules) == 0 {
+		return
+	}
+	a.mu.Lock()
+	a.started[mode] = a.now()
+	a.mu.Unlock()
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		a.evaluate(ctx, mode, cfg)
+	}
+}
+
+// evaluate checks every rule once and sends the alerts, that started, are repeated or
+// were resolved. A rule, that could not be checked, keeps its state.
+func (a *Alerter) evaluate(ctx context.Context, mode string, cfg *Configuration) {
+	for _, rule := range a.rules {
+		summary, err := rule.check(ctx, a, mode, cfg)
+		if err != nil {
+			log.Printf("could not check alert %v of %v: %v", rule.name, mode, err)
+			continue
+		}
+		if alert, ok := a.update(mode, rule.name, summary); ok {
+			a.send(ctx, alert)
+		}
+	}
+}
+
+// update records the result of a check and returns the alert, if one has to be sent.
+func (a *Alerter) update(mode, rule, summary string) (Alert, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := mode + "/" + rule
+	now := a.now()
+	active := a.active[key]
+	switch {
+	case summary != "" && active == nil:
+		active = &activeAlert{alert: Alert{Rule: rule, Status: "firing", Mode: mode, Summary: summary, StartsAt: now}}
+		a.active[key] = active
+	case summary != "" && a.config.RepeatInterval > 0 && now.Sub(active.sentAt) >= a.config.RepeatInterval:
+		active.alert.Summary = summary
+	case summary == "" && active != nil:
+		delete(a.active, key)
+		resolved := active.alert
+		resolved.Status = "resolved"
+		resolved.EndsAt = &now
+		return resolved, true
+	default:
+		return Alert{}, false
+	}
+	active.sentAt = now
+	return active.alert, true
+}
+
+// send posts alert to every webhook. Failures are only logged.
+func (a *Alerter) send(ctx context.Context, alert Alert) {
+	log.Println("alert:", alert.text())
+	for _, webhook := range a.config.Webhooks {
+		body, err := json.Marshal(webhookPayload(alert, webhook.Format))
+		if err != nil {
+			log.Println("could not encode alert:", err)
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("could not send alert to %v: %v", webhook.URL, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		res, err := a.client.Do(req)
+		if err != nil {
+			log.Printf("could not send alert to %v: %v", webhook.URL, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			log.Printf("webhook %v rejected the alert: %v", webhook.URL, res.Status)
+		}
+	}
+}
+
+// webhookPayload lays out alert for the format of a webhook. Slack takes a text, the
+// matrix hookshot webhooks a text and its html.
+func webhookPayload(alert Alert, format string) any {
+	switch format {
+	case "slack":
+		return map[string]string{"text": alert.text()}
+	case "matrix":
+		status := "FIRING"
+		if alert.Status == "resolved" {
+			status = "RESOLVED"
+		}
+		return map[string]string{
+			"text": alert.text(),
+			"html": fmt.Sprintf("<b>[%v]</b> %v/%v: %v", status, html.EscapeString(alert.Mode), html.EscapeString(alert.Rule), html.EscapeString(alert.Summary)),
+		}
+	default:
+		return alert
+	}
+}
+
+// isFinal reports whether a ShutterTx with status will not change anymore.
+func isFinal(status TxStatus) bool {
+	switch status {
+	case Included, NotSequenced, NotIncluded, SystemFailure:
+		return true
+	}
+	return false
+}
+
+// checkFailureRate fires, when too many of the finished test transactions triggered by the
+// last shutter blocks were not included. It waits until the window is full.
+func checkFailureRate(ctx context.Context, a *Alerter, mode string, cfg *Configuration) (string, error) {
+	window := a.config.FailureWindow
+	if window == 0 {
+		window = defaultFailureWindow
+	}
+	blocks := cfg.recentBlocks.last(window)
+	if len(blocks) < window {
+		return "", nil
+	}
+	triggers := make(map[int64]bool)
+	for _, block := range blocks {
+		triggers[block.Number] = true
+	}
+	_, done := cfg.status.snapshot()
+	finished, failed := 0, 0
+	for _, tx := range done {
+		status := tx.state().status
+		if !triggers[tx.triggerBlock] || !isFinal(status) {
+			continue
+		}
+		finished++
+		if status != Included {
+			failed++
+		}
+	}
+	if finished == 0 {
+		return "", nil
+	}
+	pct := 100 * float64(failed) / float64(finished)
+	if pct <= a.config.MaxFailurePct {
+		return "", nil
+	}
+	return fmt.Sprintf("%.1f%% of the %d finished test transactions of the last %d shutter blocks failed", pct, finished, window), nil
+}
+
+// checkNoTrigger fires, when no shutterized block was detected for a while since the start.
+func checkNoTrigger(ctx context.Context, a *Alerter, mode string, cfg *Configuration) (string, error) {
+	a.mu.Lock()
+	last := a.started[mode]
+	a.mu.Unlock()
+	if blocks := cfg.recentBlocks.last(1); len(blocks) == 1 && blocks[0].DetectedAt.After(last) {
+		last = blocks[0].DetectedAt
+	}
+	since := a.now().Sub(last)
+	if since <= a.config.NoTrigger {
+		return "", nil
+	}
+	return fmt.Sprintf("no shutterized block was detected for %v", since.Round(time.Second)), nil
+}
+
+func checkSubmitBalance(ctx context.Context, a *Alerter, mode string, cfg *Configuration) (string, error) {
+	balance, err := cfg.client.BalanceAt(ctx, cfg.submitAccount.Address, nil)
+	if err != nil {
+		return "", err
+	}
+	if balance.Cmp(a.minBalance) >= 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("balance of the submit account %v is %v wei, below %v", cfg.submitAccount.Address.Hex(), balance, a.minBalance), nil
+}
+
+// checkEonAge fires, when the eon active at the latest block was activated too long ago,
+// i.e. the keyper set was expected to rotate.
+func checkEonAge(ctx context.Context, a *Alerter, mode string, cfg *Configuration) (string, error) {
+	if cfg.eonKeys == nil {
+		return "", nil
+	}
+	block, err := cfg.client.BlockNumber(ctx)
+	if err != nil {
+		return "", err
+	}
+	eon, ok := currentEon(cfg.eonKeys.History(), block)
+	if !ok {
+		return "", nil
+	}
+	a.mu.Lock()
+	activated, ok := a.eonActivations[eon.Index]
+	a.mu.Unlock()
+	if !ok {
+		header, err := cfg.client.HeaderByNumber(ctx, new(big.Int).SetUint64(eon.ActivationBlock))
+		if err != nil {
+			return "", err
+		}
+		activated = time.Unix(int64(header.Time), 0)
+		a.mu.Lock()
+		a.eonActivations[eon.Index] = activated
+		a.mu.Unlock()
+	}
+	age := a.now().Sub(activated)
+	if age <= a.config.MaxEonAge {
+		return "", nil
+	}
+	return fmt.Sprintf("eon %d is active since block %d, %v ago", eon.Index, eon.ActivationBlock, age.Round(time.Minute)), nil
+}
+
+// checkSystemFailures fires, when the latest finished test transactions, by trigger block,
+// all ended in a SystemFailure.
+func checkSystemFailures(ctx context.Context, a *Alerter, mode string, cfg *Configuration) (string, error) {
+	type finished struct {
+		trigger int64
+		status  TxStatus
+	}
+	_, done := cfg.status.snapshot()
+	var txs []finished
+	for _, tx := range done {
+		if status := tx.state().status; isFinal(status) {
+			txs = append(txs, finished{tx.triggerBlock, status})
+		}
+	}
+	slices.SortStableFunc(txs, func(x, y finished) int { return cmp.Compare(x.trigger, y.trigger) })
+	failures := 0
+	for i := len(txs) - 1; i >= 0 && txs[i].status == SystemFailure; i-- {
+		failures++
+	}
+	if failures < a.config.MaxSystemFailures {
+		return "", nil
+	}
+	return fmt.Sprintf("the last %d test transactions ended in a system failure", failures), nil
+}
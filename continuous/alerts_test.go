@@ -0,0 +1,193 @@
+package continuous
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"gotest.tools/assert"
+)
+
+// webhookSink records the payloads posted to it by path.
+type webhookSink struct {
+	mu       sync.Mutex
+	payloads map[string][]map[string]any
+}
+
+func newWebhookSink(t *testing.T) (*webhookSink, *httptest.Server) {
+	sink := &webhookSink{payloads: make(map[string][]map[string]any)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NilError(t, err)
+		payload := make(map[string]any)
+		assert.NilError(t, json.Unmarshal(body, &payload))
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		sink.payloads[r.URL.Path] = append(sink.payloads[r.URL.Path], payload)
+	}))
+	t.Cleanup(server.Close)
+	return sink, server
+}
+
+func (s *webhookSink) received(path string) []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads[path]
+}
+
+// doneTx returns a finished ShutterTx for trigger with status.
+func doneTx(t *testing.T, trigger int64, status TxStatus) *ShutterTx {
+	t.Helper()
+	tx := &ShutterTx{triggerBlock: trigger}
+	assert.NilError(t, tx.transition(Signed, trigger, "submitted"))
+	if status == Included || status == NotIncluded {
+		assert.NilError(t, tx.transition(Sequenced, trigger+1, "submission mined"))
+	}
+	assert.NilError(t, tx.transition(status, trigger+2, "done"))
+	return tx
+}
+
+func TestAlerterWebhooks(t *testing.T) {
+	sink, server := newWebhookSink(t)
+	alerter, err := NewAlerter(config.Alerts{
+		Webhooks: []config.Webhook{
+			{URL: server.URL + "/generic"},
+			{URL: server.URL + "/slack", Format: "slack"},
+			{URL: server.URL + "/matrix", Format: "matrix"},
+		},
+		MaxSystemFailures: 2,
+		RepeatInterval:    time.Hour,
+	})
+	assert.NilError(t, err)
+	now := time.Unix(100000, 0).UTC()
+	alerter.now = func() time.Time { return now }
+	cfg := createTestConfig(nil)
+	ctx := context.Background()
+
+	cfg.status.txDone = []*ShutterTx{doneTx(t, 100, Included), doneTx(t, 102, SystemFailure)}
+	alerter.evaluate(ctx, "standard", cfg)
+	assert.Equal(t, len(sink.received("/generic")), 0)
+
+	// finished out of order, the trigger blocks count
+	cfg.status.txDone = append(cfg.status.txDone, doneTx(t, 101, SystemFailure))
+	alerter.evaluate(ctx, "standard", cfg)
+	generic := sink.received("/generic")
+	assert.Equal(t, len(generic), 1)
+	assert.Equal(t, generic[0]["rule"], "system-failures")
+	assert.Equal(t, generic[0]["status"], "firing")
+	assert.Equal(t, generic[0]["mode"], "standard")
+	assert.Equal(t, generic[0]["summary"], "the last 2 test transactions ended in a system failure")
+	assert.Assert(t, generic[0]["endsAt"] == nil)
+	assert.Equal(t, sink.received("/slack")[0]["text"], "[FIRING] standard/system-failures: the last 2 test transactions ended in a system failure")
+	matrix := sink.received("/matrix")[0]
+	assert.Equal(t, matrix["text"], sink.received("/slack")[0]["text"])
+	assert.Equal(t, matrix["html"], "<b>[FIRING]</b> standard/system-failures: the last 2 test transactions ended in a system failure")
+
+	// a firing alert is not sent again before the repeat interval
+	now = now.Add(time.Minute)
+	alerter.evaluate(ctx, "standard", cfg)
+	assert.Equal(t, len(sink.received("/generic")), 1)
+	// nor is the same alert of another mode suppressed
+	alerter.evaluate(ctx, "graffiti", cfg)
+	assert.Equal(t, len(sink.received("/generic")), 2)
+
+	now = now.Add(time.Hour)
+	alerter.evaluate(ctx, "standard", cfg)
+	assert.Equal(t, len(sink.received("/generic")), 3)
+
+	cfg.status.txDone = append(cfg.status.txDone, doneTx(t, 103, Included))
+	alerter.evaluate(ctx, "standard", cfg)
+	generic = sink.received("/generic")
+	assert.Equal(t, len(generic), 4)
+	assert.Equal(t, generic[3]["status"], "resolved")
+	assert.Equal(t, generic[3]["startsAt"], "1970-01-02T03:46:40Z")
+	assert.Equal(t, generic[3]["endsAt"], now.Format(time.RFC3339))
+	assert.Equal(t, sink.received("/slack")[3]["text"],
+		"[RESOLVED] standard/system-failures: the last 2 test transactions ended in a system failure (since 1970-01-02T03:46:40Z)")
+
+	// resolved alerts are only sent once
+	alerter.evaluate(ctx, "standard", cfg)
+	assert.Equal(t, len(sink.received("/generic")), 4)
+}
+
+func TestAlertRules(t *testing.T) {
+	ctx := context.Background()
+	start := time.Unix(100000, 0)
+	alerter, err := NewAlerter(config.Alerts{
+		MaxFailurePct:    30,
+		FailureWindow:    4,
+		NoTrigger:        5 * time.Minute,
+		MinSubmitBalance: "2000000000000000000",
+		MaxEonAge:        time.Hour,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(alerter.rules), 4)
+	now := start
+	alerter.now = func() time.Time { return now }
+	alerter.started["standard"] = start
+
+	cfg := createTestConfig(nil)
+	for i := int64(0); i < 3; i++ {
+		cfg.recentBlocks.add(ShutterBlock{Number: 100 + i, DetectedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	cfg.status.txDone = []*ShutterTx{
+		doneTx(t, 90, SystemFailure),
+		doneTx(t, 100, Included),
+		doneTx(t, 101, NotIncluded),
+		doneTx(t, 102, Included),
+	}
+	summary, err := checkFailureRate(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "", "the window is not full yet")
+	cfg.recentBlocks.add(ShutterBlock{Number: 103, DetectedAt: start.Add(8 * time.Minute)})
+	summary, err = checkFailureRate(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "33.3% of the 3 finished test transactions of the last 4 shutter blocks failed")
+
+	now = start.Add(10 * time.Minute)
+	summary, err = checkNoTrigger(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "")
+	now = start.Add(20 * time.Minute)
+	summary, err = checkNoTrigger(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "no shutterized block was detected for 12m0s")
+
+	_, cfg = createSimulatedConfig(t)
+	summary, err = checkSubmitBalance(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "balance of the submit account "+cfg.submitAccount.Address.Hex()+" is 1000000000000000000 wei, below 2000000000000000000")
+	alerter.minBalance.SetUint64(1)
+	summary, err = checkSubmitBalance(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "")
+
+	now = time.Now()
+	summary, err = checkEonAge(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "")
+	now = now.Add(2 * time.Hour)
+	summary, err = checkEonAge(ctx, alerter, "standard", cfg)
+	assert.NilError(t, err)
+	assert.Assert(t, summary != "")
+}
+
+func TestNewAlerter(t *testing.T) {
+	_, err := NewAlerter(config.Alerts{Webhooks: []config.Webhook{{URL: "http://localhost", Format: "teams"}}})
+	assert.ErrorContains(t, err, "unknown webhook format teams")
+	_, err = NewAlerter(config.Alerts{Webhooks: []config.Webhook{{Format: "slack"}}})
+	assert.ErrorContains(t, err, "without url")
+	_, err = NewAlerter(config.Alerts{MinSubmitBalance: "1e18"})
+	assert.ErrorContains(t, err, "invalid minSubmitBalance")
+	_, err = NewAlerter(config.Alerts{FailureWindow: RecentShutterBlocks + 1})
+	assert.ErrorContains(t, err, "invalid failureWindow")
+
+	var disabled *Alerter
+	disabled.Run(context.Background(), "standard", nil)
+}
@@ -0,0 +1,431 @@
+package continuous
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/shutter-network/nethermind-tests/supervisor"
+)
+
+const (
+	// RecentShutterBlocks is the number of detected shutter blocks kept for the API.
+	RecentShutterBlocks = 100
+	// the number of done transactions and shutter blocks returned by default
+	defaultAPILimit = 50
+)
+
+// Serve serves handler at address in the background. The address of the returned server
+// is the one listened on, close the server to stop it.
+func Serve(address string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Addr: listener.Addr().String(), Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Println("http server stopped:", err)
+		}
+	}()
+	log.Println("serving http at", server.Addr)
+	return server, nil
+}
+
+// API serves the state of the running modes as JSON. It only reads and can not change
+// anything. The continuous modes are attached to it, whenever they are (re)started, and
+// detached, when they stop.
+type API struct {
+	modes func() []supervisor.Health
+
+	mu         sync.RWMutex
+	continuous map[string]*Configuration
+}
+
+// NewAPI returns the API for the modes, whose health is returned by modes.
+func NewAPI(modes func() []supervisor.Health) *API {
+	return &API{modes: modes, continuous: make(map[string]*Configuration)}
+}
+
+// Attach makes the state of the continuous mode available. A later configuration of
+// the same mode replaces the earlier one.
+func (a *API) Attach(mode string, cfg *Configuration) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.continuous[mode] = cfg
+}
+
+// Detach removes the continuous mode, unless it was replaced by another configuration
+// already. It waits for the requests, that use cfg, so that cfg can be closed afterwards.
+func (a *API) Detach(mode string, cfg *Configuration) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.continuous[mode] == cfg {
+		delete(a.continuous, mode)
+	}
+}
+
+// Handler routes the requests below /api/.
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/modes", a.getModes)
+	mux.HandleFunc("GET /api/continuous", a.getContinuous)
+	mux.HandleFunc("GET /api/continuous/{mode}/transactions", a.withMode(getTransactions))
+	mux.HandleFunc("GET /api/continuous/{mode}/shutter-blocks", a.withMode(getShutterBlocks))
+	mux.HandleFunc("GET /api/continuous/{mode}/accounts", a.withMode(getAccounts))
+	mux.HandleFunc("GET /api/continuous/{mode}/report", a.withMode(getReport))
+	return mux
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, apiError{Error: fmt.Sprintf(format, args...)})
+}
+
+// limit returns the limit query parameter of r, defaultAPILimit if it is not given.
+func limit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultAPILimit, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid limit %v", value)
+	}
+	return n, nil
+}
+
+// ModeReport is the health of a mode.
+type ModeReport struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func (a *API) getModes(w http.ResponseWriter, r *http.Request) {
+	modes := []ModeReport{}
+	if a.modes != nil {
+		for _, health := range a.modes() {
+			modes = append(modes, ModeReport{
+				Name:      health.Name,
+				State:     health.State.String(),
+				Restarts:  health.Restarts,
+				LastError: health.LastError,
+				StartedAt: health.StartedAt,
+			})
+		}
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i].Name < modes[j].Name })
+	writeJSON(w, http.StatusOK, modes)
+}
+
+// ContinuousReport is the overview of a continuous mode.
+type ContinuousReport struct {
+	Mode             string         `json:"mode"`
+	SubmitAccount    common.Address `json:"submitAccount"`
+	InFlight         int            `json:"inFlight"`
+	Done             int            `json:"done"`
+	LastShutterBlock *DetectedBlock `json:"lastShutterBlock"`
+	// when the collector wrote the latest report
+	LastReport *time.Time `json:"lastReport"`
+}
+
+func (a *API) getContinuous(w http.ResponseWriter, r *http.Request) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	reports := []ContinuousReport{}
+	for mode, cfg := range a.continuous {
+		inFlight, done := cfg.status.snapshot()
+		report := ContinuousReport{
+			Mode:          mode,
+			SubmitAccount: cfg.submitAccount.Address,
+			InFlight:      len(inFlight),
+			Done:          len(done),
+		}
+		if blocks := cfg.recentBlocks.last(1); len(blocks) == 1 {
+			report.LastShutterBlock = &blocks[0]
+		}
+		if collected, ok := cfg.latestReport.get(); ok {
+			report.LastReport = &collected.CollectedAt
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Mode < reports[j].Mode })
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// withMode passes the configuration of the continuous mode in the path to handle. The
+// mode can not be detached, while it is handled.
+func (a *API) withMode(handle func(http.ResponseWriter, *http.Request, *Configuration)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mode := r.PathValue("mode")
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		cfg, ok := a.continuous[mode]
+		if !ok {
+			writeError(w, http.StatusNotFound, "continuous mode %v is not running", mode)
+			return
+		}
+		handle(w, r, cfg)
+	}
+}
+
+// TxReport is the state of a ShutterTx with its lifecycle.
+type TxReport struct {
+	TriggerBlock    int64          `json:"triggerBlock"`
+	Status          TxStatus       `json:"status"`
+	Sender          common.Address `json:"sender"`
+	InnerTx         *common.Hash   `json:"innerTx"`
+	InnerNonce      *uint64        `json:"innerNonce"`
+	OuterTx         *common.Hash   `json:"outerTx"`
+	OuterNonce      *uint64        `json:"outerNonce"`
+	SubmissionBlock int64          `json:"submissionBlock,omitempty"`
+	InclusionBlock  int64          `json:"inclusionBlock,omitempty"`
+	CancelBlock     int64          `json:"cancelBlock,omitempty"`
+	TargetSlot      int64          `json:"targetSlot,omitempty"`
+	SignedAt        time.Time      `json:"signedAt"`
+	LatencyMs       int64          `json:"latencyMs"`
+	Transitions     []Transition   `json:"transitions"`
+}
+
+func (tx *ShutterTx) report() TxReport {
+	state := tx.state()
+	r := TxReport{
+		TriggerBlock:    tx.triggerBlock,
+		Status:          state.status,
+		SubmissionBlock: state.submissionBlock,
+		InclusionBlock:  state.inclusionBlock,
+		CancelBlock:     state.cancelBlock,
+		TargetSlot:      tx.targetSlot,
+		SignedAt:        tx.signedAt,
+		LatencyMs:       tx.latency.Milliseconds(),
+		Transitions:     state.transitions,
+	}
+	if tx.sender != nil {
+		r.Sender = tx.sender.Address
+	}
+	if tx.innerTx != nil {
+		hash, nonce := tx.innerTx.Hash(), tx.innerTx.Nonce()
+		r.InnerTx, r.InnerNonce = &hash, &nonce
+	}
+	if tx.outerTx != nil {
+		hash, nonce := tx.outerTx.Hash(), tx.outerTx.Nonce()
+		r.OuterTx, r.OuterNonce = &hash, &nonce
+	}
+	if r.Transitions == nil {
+		r.Transitions = []Transition{}
+	}
+	return r
+}
+
+// TransactionsReport are the transactions in flight and the latest done ones, newest first.
+type TransactionsReport struct {
+	InFlight []TxReport `json:"inFlight"`
+	Done     []TxReport `json:"done"`
+}
+
+func getTransactions(w http.ResponseWriter, r *http.Request, cfg *Configuration) {
+	n, err := limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	inFlight, done := cfg.status.snapshot()
+	report := TransactionsReport{InFlight: []TxReport{}, Done: []TxReport{}}
+	for i := len(inFlight) - 1; i >= 0; i-- {
+		report.InFlight = append(report.InFlight, inFlight[i].report())
+	}
+	for i := len(done) - 1; i >= 0 && len(report.Done) < n; i-- {
+		report.Done = append(report.Done, done[i].report())
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func getShutterBlocks(w http.ResponseWriter, r *http.Request, cfg *Configuration) {
+	n, err := limit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cfg.recentBlocks.last(n))
+}
+
+// AccountReport are the nonces and the balance of an account. The balance is in wei.
+type AccountReport struct {
+	Address common.Address `json:"address"`
+	// submit or test
+	Role    string `json:"role"`
+	Balance string `json:"balance"`
+	// nonce of the latest block and of the pending transactions of the node
+	Nonce        uint64 `json:"nonce"`
+	PendingNonce uint64 `json:"pendingNonce"`
+	// nonces allocated by the runner, that were not mined at the last resync
+	Allocated []uint64 `json:"allocated"`
+	// released nonces, that were not handed out again
+	Gaps []uint64 `json:"gaps"`
+}
+
+func getAccounts(w http.ResponseWriter, r *http.Request, cfg *Configuration) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	reports := []AccountReport{}
+	add := func(address common.Address, role string) error {
+		report := AccountReport{Address: address, Role: role, Allocated: []uint64{}, Gaps: []uint64{}}
+		balance, err := cfg.client.BalanceAt(ctx, address, nil)
+		if err != nil {
+			return err
+		}
+		report.Balance = balance.String()
+		report.Nonce, err = cfg.client.NonceAt(ctx, address, nil)
+		if err != nil {
+			return err
+		}
+		report.PendingNonce, err = cfg.client.PendingNonceAt(ctx, address)
+		if err != nil {
+			return err
+		}
+		if cfg.nonces != nil {
+			report.Allocated = append(report.Allocated, cfg.nonces.Pending(address)...)
+			report.Gaps = append(report.Gaps, cfg.nonces.Gaps(address)...)
+		}
+		reports = append(reports, report)
+		return nil
+	}
+	err := add(cfg.submitAccount.Address, "submit")
+	for i := 0; err == nil && i < len(cfg.accounts); i++ {
+		err = add(cfg.accounts[i].Address, "test")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "could not query the accounts: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func getReport(w http.ResponseWriter, r *http.Request, cfg *Configuration) {
+	collected, ok := cfg.latestReport.get()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no report was collected yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, collected)
+}
+
+// snapshot returns copies of the lists of the transactions in flight and done.
+func (s *Status) snapshot() ([]*ShutterTx, []*ShutterTx) {
+	s.statusModMutex.Lock()
+	defer s.statusModMutex.Unlock()
+	return append([]*ShutterTx{}, s.txInFlight...), append([]*ShutterTx{}, s.txDone...)
+}
+
+// DetectedBlock is a shutter block, that triggered a transaction.
+type DetectedBlock struct {
+	Number       int64     `json:"number"`
+	Time         time.Time `json:"time"`
+	TargetedSlot int64     `json:"targetedSlot,omitempty"`
+	DetectedAt   time.Time `json:"detectedAt"`
+}
+
+// recentShutterBlocks keeps the last RecentShutterBlocks detected shutter blocks.
+type recentShutterBlocks struct {
+	mu     sync.Mutex
+	blocks []DetectedBlock
+}
+
+func newRecentShutterBlocks() *recentShutterBlocks {
+	return &recentShutterBlocks{}
+}
+
+func (r *recentShutterBlocks) add(block ShutterBlock) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocks = append(r.blocks, DetectedBlock{
+		Number:       block.Number,
+		Time:         block.Ts.Time.UTC(),
+		TargetedSlot: block.TargetedSlot,
+		DetectedAt:   block.DetectedAt,
+	})
+	if len(r.blocks) > RecentShutterBlocks {
+		r.blocks = append([]DetectedBlock{}, r.blocks[len(r.blocks)-RecentShutterBlocks:]...)
+	}
+}
+
+// last returns up to n of the latest blocks, newest first.
+func (r *recentShutterBlocks) last(n int) []DetectedBlock {
+	result := []DetectedBlock{}
+	if r == nil {
+		return result
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.blocks) - 1; i >= 0 && len(result) < n; i-- {
+		result = append(result, r.blocks[i])
+	}
+	return result
+}
+
+// CollectedReport is a report of the collector and when it was written.
+type CollectedReport struct {
+	CollectedAt time.Time `json:"collectedAt"`
+	Report      Report    `json:"report"`
+}
+
+// latestReport keeps the last report written by the collector.
+type latestReport struct {
+	mu        sync.Mutex
+	collected *CollectedReport
+}
+
+func (l *latestReport) set(report Report) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.collected = &CollectedReport{CollectedAt: time.Now().UTC(), Report: report}
+}
+
+func (l *latestReport) get() (CollectedReport, bool) {
+	if l == nil {
+		return CollectedReport{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.collected == nil {
+		return CollectedReport{}, false
+	}
+	return *l.collected, true
+}
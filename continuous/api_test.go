@@ -0,0 +1,144 @@
+package continuous
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/shutter-network/nethermind-tests/supervisor"
+	"gotest.tools/assert"
+)
+
+// getJSON decodes the response to path of server into value and returns the status code.
+func getJSON(t *testing.T, server *httptest.Server, path string, value any) int {
+	t.Helper()
+	res, err := http.Get(server.URL + path)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, res.Header.Get("Content-Type"), "application/json")
+	assert.NilError(t, json.NewDecoder(res.Body).Decode(value))
+	return res.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	_, cfg := createSimulatedConfig(t)
+	account := cfg.accounts[0]
+	var txs []*ShutterTx
+	for i := int64(0); i < 3; i++ {
+		tx := &ShutterTx{
+			innerTx:      signedTestTx(t, account, uint64(i)),
+			outerTx:      signedTestTx(t, account, uint64(10+i)),
+			sender:       &account,
+			triggerBlock: 100 + i,
+			signedAt:     time.Now(),
+			latency:      time.Duration(i) * time.Millisecond,
+		}
+		tx.ctx, tx.cancel = context.WithCancel(context.Background())
+		assert.NilError(t, tx.transition(Signed, 100+i, "submitted"))
+		txs = append(txs, tx)
+	}
+	assert.NilError(t, txs[0].transition(Sequenced, 101, "submission mined"))
+	assert.NilError(t, txs[0].transition(Included, 102, "included"))
+	assert.NilError(t, txs[1].transition(SystemFailure, 0, "timeout"))
+	cfg.status.txDone = txs[:2]
+	cfg.status.txInFlight = txs[2:]
+	for i := int64(0); i < 3; i++ {
+		cfg.recentBlocks.add(ShutterBlock{Number: 100 + i, Ts: pgtype.Date{Time: time.Unix(1000+12*i, 0), Status: pgtype.Present}})
+	}
+
+	api := NewAPI(func() []supervisor.Health {
+		return []supervisor.Health{{Name: "continuous", State: supervisor.Running, Restarts: 1}}
+	})
+	api.Attach("standard", cfg)
+	server := httptest.NewServer(api.Handler())
+	defer server.Close()
+
+	var modes []ModeReport
+	assert.Equal(t, getJSON(t, server, "/api/modes", &modes), http.StatusOK)
+	assert.DeepEqual(t, modes, []ModeReport{{Name: "continuous", State: "Running", Restarts: 1}})
+
+	var transactions TransactionsReport
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/transactions", &transactions), http.StatusOK)
+	assert.Equal(t, len(transactions.InFlight), 1)
+	assert.Equal(t, transactions.InFlight[0].TriggerBlock, int64(102))
+	assert.Equal(t, transactions.InFlight[0].Status, Signed)
+	assert.Equal(t, *transactions.InFlight[0].OuterNonce, uint64(12))
+	assert.Equal(t, len(transactions.Done), 2)
+	// newest first
+	assert.Equal(t, transactions.Done[0].Status, SystemFailure)
+	included := transactions.Done[1]
+	assert.Equal(t, included.Status, Included)
+	assert.Equal(t, *included.InnerTx, txs[0].innerTx.Hash())
+	assert.Equal(t, included.InclusionBlock, int64(102))
+	assert.Equal(t, len(included.Transitions), 3)
+	assert.Equal(t, included.Sender, account.Address)
+
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/transactions?limit=1", &transactions), http.StatusOK)
+	assert.Equal(t, len(transactions.Done), 1)
+
+	var blocks []DetectedBlock
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/shutter-blocks?limit=2", &blocks), http.StatusOK)
+	assert.Equal(t, len(blocks), 2)
+	assert.Equal(t, blocks[0].Number, int64(102))
+	assert.Equal(t, blocks[0].Time, time.Unix(1024, 0).UTC())
+
+	var accounts []AccountReport
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/accounts", &accounts), http.StatusOK)
+	assert.Equal(t, len(accounts), 2)
+	assert.Equal(t, accounts[0].Role, "submit")
+	assert.Equal(t, accounts[0].Address, cfg.submitAccount.Address)
+	assert.Equal(t, accounts[1].Role, "test")
+	assert.Equal(t, accounts[1].Balance, "1000000000000000000")
+	assert.Equal(t, accounts[1].Nonce, uint64(0))
+
+	var apiErr apiError
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/report", &apiErr), http.StatusNotFound)
+	cfg.latestReport.set(Report{StartBlock: 100, EndBlock: 110, Transactions: 3})
+	var collected CollectedReport
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/report", &collected), http.StatusOK)
+	assert.Equal(t, collected.Report.Transactions, 3)
+	assert.Assert(t, !collected.CollectedAt.IsZero())
+
+	var overview []ContinuousReport
+	assert.Equal(t, getJSON(t, server, "/api/continuous", &overview), http.StatusOK)
+	assert.Equal(t, len(overview), 1)
+	assert.Equal(t, overview[0].Mode, "standard")
+	assert.Equal(t, overview[0].InFlight, 1)
+	assert.Equal(t, overview[0].Done, 2)
+	assert.Equal(t, overview[0].LastShutterBlock.Number, int64(102))
+	assert.Assert(t, overview[0].LastReport != nil)
+
+	assert.Equal(t, getJSON(t, server, "/api/continuous/graffiti/transactions", &apiErr), http.StatusNotFound)
+	assert.Equal(t, apiErr.Error, "continuous mode graffiti is not running")
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/shutter-blocks?limit=x", &apiErr), http.StatusBadRequest)
+
+	// a restarted mode is not detached by its previous run
+	restarted := createTestConfig(nil)
+	api.Attach("standard", restarted)
+	api.Detach("standard", cfg)
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/transactions", &transactions), http.StatusOK)
+	assert.Equal(t, len(transactions.Done), 0)
+	api.Detach("standard", restarted)
+	assert.Equal(t, getJSON(t, server, "/api/continuous/standard/transactions", &apiErr), http.StatusNotFound)
+	var disabled *API
+	disabled.Detach("standard", cfg)
+}
+
+func TestRecentShutterBlocks(t *testing.T) {
+	recent := newRecentShutterBlocks()
+	for i := int64(0); i < RecentShutterBlocks+5; i++ {
+		recent.add(ShutterBlock{Number: i})
+	}
+	blocks := recent.last(RecentShutterBlocks + 10)
+	assert.Equal(t, len(blocks), RecentShutterBlocks)
+	assert.Equal(t, blocks[0].Number, int64(RecentShutterBlocks+4))
+	assert.Equal(t, blocks[len(blocks)-1].Number, int64(5))
+
+	var disabled *recentShutterBlocks
+	disabled.add(ShutterBlock{Number: 1})
+	assert.Equal(t, len(disabled.last(1)), 0)
+}
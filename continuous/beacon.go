@@ -0,0 +1,210 @@
+package continuous
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgtype"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+// BeaconLookbackSlots limits, how far back from the head the BeaconShutterBlocks search.
+const BeaconLookbackSlots = 64
+
+// ShutterBlockSource detects the blocks, that were proposed by shutter validators.
+type ShutterBlockSource interface {
+	// LatestShutterBlock returns the newest block proposed by a shutter validator.
+	LatestShutterBlock(ctx context.Context) (ShutterBlock, bool, error)
+	// ShutterBlocksAfter returns all blocks proposed by shutter validators with a timestamp after ts.
+	ShutterBlocksAfter(ctx context.Context, ts time.Time) ([]ShutterBlock, error)
+}
+
+// headShutterBlockSource is a ShutterBlockSource, that follows the chain itself and can
+// tell the shutter blocks up to a new head as soon as the head is known.
+type headShutterBlockSource interface {
+	ShutterBlockSource
+	ShutterBlocksUpTo(ctx context.Context, ts time.Time, head *types.Header) ([]ShutterBlock, error)
+}
+
+// BeaconClient reads the proposer duties from the API of a beacon node.
+type BeaconClient struct {
+	url    *url.URL
+	client *http.Client
+}
+
+func NewBeaconClient(rawURL string) (*BeaconClient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid beacon url: %w", err)
+	}
+	return &BeaconClient{url: parsed, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+type proposerDutiesResponse struct {
+	Data []struct {
+		Pubkey         string `json:"pubkey"`
+		ValidatorIndex string `json:"validator_index"`
+		Slot           string `json:"slot"`
+	} `json:"data"`
+}
+
+// ProposerDuties returns the proposers of the slots of epoch.
+func (c *BeaconClient) ProposerDuties(ctx context.Context, epoch int64) ([]ProposerDuty, error) {
+	endpoint := c.url.JoinPath("/eth/v1/validator/duties/proposer", strconv.FormatInt(epoch, 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the proposer duties of epoch %v: %w", epoch, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get the proposer duties of epoch %v: %v", epoch, res.Status)
+	}
+	var response proposerDutiesResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proposer duties of epoch %v: %w", epoch, err)
+	}
+	duties := make([]ProposerDuty, len(response.Data))
+	for i, data := range response.Data {
+		duties[i].PublicKey = data.Pubkey
+		duties[i].ValidatorIndex, err = strconv.ParseInt(data.ValidatorIndex, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proposer duties of epoch %v: %w", epoch, err)
+		}
+		duties[i].Slot, err = strconv.ParseInt(data.Slot, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proposer duties of epoch %v: %w", epoch, err)
+		}
+	}
+	return duties, nil
+}
+
+// BeaconShutterBlocks is the ShutterBlockSource, that needs no observer: the proposers of
+// the slots are read from a beacon node and the shutter validators from the validator
+// registry. Only the BeaconLookbackSlots before the head are searched.
+type BeaconShutterBlocks struct {
+	beacon   *BeaconClient
+	registry *ValidatorRegistry
+	slots    *utils.SlotService
+
+	mu sync.Mutex
+	// proposer duties by epoch and slot
+	duties map[int64]map[int64]ProposerDuty
+}
+
+var _ headShutterBlockSource = &BeaconShutterBlocks{}
+
+func NewBeaconShutterBlocks(beacon *BeaconClient, registry *ValidatorRegistry, slots *utils.SlotService) *BeaconShutterBlocks {
+	return &BeaconShutterBlocks{
+		beacon:   beacon,
+		registry: registry,
+		slots:    slots,
+		duties:   make(map[int64]map[int64]ProposerDuty),
+	}
+}
+
+// proposerDuty returns the proposer of slot, the duties are cached per epoch.
+func (b *BeaconShutterBlocks) proposerDuty(ctx context.Context, slot int64) (ProposerDuty, bool, error) {
+	epoch := b.slots.Clock.Epoch(slot)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	duties, ok := b.duties[epoch]
+	if !ok {
+		list, err := b.beacon.ProposerDuties(ctx, epoch)
+		if err != nil {
+			return ProposerDuty{}, false, err
+		}
+		duties = make(map[int64]ProposerDuty, len(list))
+		for _, duty := range list {
+			duties[duty.Slot] = duty
+		}
+		for cached := range b.duties {
+			if cached < epoch-1 {
+				delete(b.duties, cached)
+			}
+		}
+		b.duties[epoch] = duties
+	}
+	duty, ok := duties[slot]
+	return duty, ok, nil
+}
+
+// shutterBlock returns the block of slot, if slot was proposed by a shutter validator.
+func (b *BeaconShutterBlocks) shutterBlock(ctx context.Context, slot int64) (ShutterBlock, bool, error) {
+	duty, ok, err := b.proposerDuty(ctx, slot)
+	if err != nil || !ok {
+		return ShutterBlock{}, false, err
+	}
+	if !b.registry.IsRegistered(uint64(duty.ValidatorIndex), duty.PublicKey) {
+		return ShutterBlock{}, false, nil
+	}
+	number, found, err := b.slots.BlockOfSlot(ctx, slot)
+	if err != nil || !found {
+		return ShutterBlock{}, false, err
+	}
+	ts := pgtype.Date{Time: b.slots.Clock.SlotStart(slot), Status: pgtype.Present}
+	return ShutterBlock{Number: int64(number), Ts: ts}, true, nil
+}
+
+func (b *BeaconShutterBlocks) LatestShutterBlock(ctx context.Context) (ShutterBlock, bool, error) {
+	header, headSlot, err := b.slots.Head(ctx)
+	if err != nil {
+		return ShutterBlock{}, false, err
+	}
+	err = b.registry.Sync(ctx, header.Number.Uint64())
+	if err != nil {
+		return ShutterBlock{}, false, err
+	}
+	for slot := headSlot; slot > headSlot-BeaconLookbackSlots && slot >= 0; slot-- {
+		block, found, err := b.shutterBlock(ctx, slot)
+		if err != nil || found {
+			return block, found, err
+		}
+	}
+	return ShutterBlock{}, false, nil
+}
+
+func (b *BeaconShutterBlocks) ShutterBlocksAfter(ctx context.Context, ts time.Time) ([]ShutterBlock, error) {
+	head, _, err := b.slots.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.ShutterBlocksUpTo(ctx, ts, head)
+}
+
+// ShutterBlocksUpTo returns the blocks proposed by shutter validators with a timestamp
+// after ts up to head, without looking up the head again.
+func (b *BeaconShutterBlocks) ShutterBlocksUpTo(ctx context.Context, ts time.Time, head *types.Header) ([]ShutterBlock, error) {
+	headSlot := b.slots.Observe(head)
+	err := b.registry.Sync(ctx, head.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	// blocks have the start of their slot as timestamp
+	from := max(b.slots.Clock.SlotAt(ts)+1, headSlot-BeaconLookbackSlots+1)
+	if ts.Before(b.slots.Clock.Genesis) {
+		from = max(0, headSlot-BeaconLookbackSlots+1)
+	}
+	var blocks []ShutterBlock
+	for slot := from; slot <= headSlot; slot++ {
+		block, found, err := b.shutterBlock(ctx, slot)
+		if err != nil {
+			return blocks, err
+		}
+		if found {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,340 @@
+package continuous
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shutter-network/contracts/v2/bindings/validatorregistry"
+	"github.com/shutter-network/nethermind-tests/utils"
+	rsvalidatorregistry "github.com/shutter-network/rolling-shutter/rolling-shutter/medley/validatorregistry"
+	blst "github.com/supranational/blst/bindings/go"
+	"gotest.tools/assert"
+)
+
+var testRegistryAddress = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+const testChainID = 1337
+
+// registryLogs serves the Updated events of a validator registry.
+type registryLogs struct {
+	logs []types.Log
+}
+
+func (r *registryLogs) add(t *testing.T, block uint64, message rsvalidatorregistry.RegistrationMessage, key *blst.SecretKey) {
+	t.Helper()
+	registryABI, err := validatorregistry.ValidatorregistryMetaData.GetAbi()
+	assert.NilError(t, err)
+	event := registryABI.Events["Updated"]
+	signature := rsvalidatorregistry.CreateSignature(key, &message)
+	data, err := event.Inputs.Pack(message.Marshal(), signature.Compress())
+	assert.NilError(t, err)
+	r.logs = append(r.logs, types.Log{
+		Address:     testRegistryAddress,
+		Topics:      []common.Hash{event.ID},
+		Data:        data,
+		BlockNumber: block,
+	})
+}
+
+func (r *registryLogs) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, log := range r.logs {
+		if log.BlockNumber >= q.FromBlock.Uint64() && log.BlockNumber <= q.ToBlock.Uint64() {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (r *registryLogs) SubscribeFilterLogs(context.Context, ethereum.FilterQuery, chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+// mockBeacon serves the proposer duties of a beacon node and counts the requests per epoch.
+type mockBeacon struct {
+	mu       sync.Mutex
+	duties   map[int64][]ProposerDuty
+	requests map[int64]int
+}
+
+func (m *mockBeacon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	epoch, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/eth/v1/validator/duties/proposer/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	m.requests[epoch]++
+	duties, ok := m.duties[epoch]
+	if !ok {
+		http.Error(w, "unknown epoch", http.StatusBadRequest)
+		return
+	}
+	type duty struct {
+		Pubkey         string `json:"pubkey"`
+		ValidatorIndex string `json:"validator_index"`
+		Slot           string `json:"slot"`
+	}
+	response := struct {
+		Data []duty `json:"data"`
+	}{}
+	for _, d := range duties {
+		response.Data = append(response.Data, duty{d.PublicKey, fmt.Sprint(d.ValidatorIndex), fmt.Sprint(d.Slot)})
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func blsKey(seed byte) (*blst.SecretKey, string) {
+	ikm := make([]byte, 32)
+	ikm[0] = seed
+	key := blst.KeyGen(ikm)
+	return key, hexutil.Encode(new(blst.P1Affine).From(key).Compress())
+}
+
+func registration(index, nonce uint64, register bool) rsvalidatorregistry.RegistrationMessage {
+	return rsvalidatorregistry.RegistrationMessage{
+		Version:                  registrationMessageVersion,
+		ChainID:                  testChainID,
+		ValidatorRegistryAddress: testRegistryAddress,
+		ValidatorIndex:           index,
+		Nonce:                    nonce,
+		IsRegistration:           register,
+	}
+}
+
+type beaconFixture struct {
+	source   *BeaconShutterBlocks
+	beacon   *mockBeacon
+	observer *MemoryObserver
+	pubkeys  []string
+}
+
+// createBeaconFixture returns the shutter blocks of a chain with 4 slots per epoch, in
+// which validator slot%4 proposes slot and slot 6 is missed. Only validator 1 is
+// registered: 2 deregistered again, 3 signed with a wrong key and 0 never registered.
+func createBeaconFixture(t *testing.T) beaconFixture {
+	t.Helper()
+	keys := make([]*blst.SecretKey, 4)
+	pubkeys := make([]string, 4)
+	for i := range keys {
+		keys[i], pubkeys[i] = blsKey(byte(i + 1))
+	}
+	beacon := &mockBeacon{duties: make(map[int64][]ProposerDuty), requests: make(map[int64]int)}
+	observer := NewMemoryObserver()
+	number := int64(0)
+	for slot := int64(0); slot < 12; slot++ {
+		validator := slot % 4
+		epoch := slot / 4
+		beacon.duties[epoch] = append(beacon.duties[epoch], ProposerDuty{Slot: slot, ValidatorIndex: validator, PublicKey: pubkeys[validator]})
+		if slot == 6 {
+			continue
+		}
+		observer.AddBlock(ObservedBlock{Number: number, Slot: slot, Timestamp: 1000 + 5*slot})
+		number++
+	}
+	server := httptest.NewServer(beacon)
+	t.Cleanup(server.Close)
+
+	logs := &registryLogs{}
+	logs.add(t, 1, registration(1, 0, true), keys[1])
+	logs.add(t, 1, registration(2, 0, true), keys[2])
+	logs.add(t, 2, registration(2, 1, false), keys[2])
+	// the nonce was already used
+	logs.add(t, 3, registration(2, 1, true), keys[2])
+	logs.add(t, 3, registration(3, 0, true), keys[0])
+	wrongChain := registration(0, 0, true)
+	wrongChain.ChainID = 100
+	logs.add(t, 4, wrongChain, keys[0])
+
+	registry, err := NewValidatorRegistry(logs, testRegistryAddress, testChainID, 0)
+	assert.NilError(t, err)
+	client, err := NewBeaconClient(server.URL)
+	assert.NilError(t, err)
+	clock := utils.SlotClock{Genesis: time.Unix(1000, 0), SlotDuration: 5 * time.Second, SlotsPerEpoch: 4}
+	slots := utils.NewSlotService(observedHeaders{observer}, clock)
+	return beaconFixture{
+		source:   NewBeaconShutterBlocks(client, registry, slots),
+		beacon:   beacon,
+		observer: observer,
+		pubkeys:  pubkeys,
+	}
+}
+
+func TestBeaconShutterBlocks(t *testing.T) {
+	fixture := createBeaconFixture(t)
+	source := fixture.source
+	ctx := context.Background()
+
+	latest, found, err := source.LatestShutterBlock(ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, found)
+	assert.Equal(t, latest.Number, int64(8))
+	assert.Equal(t, latest.Ts.Time, time.Unix(1045, 0))
+
+	blocks, err := source.ShutterBlocksAfter(ctx, time.Unix(1005, 0))
+	assert.NilError(t, err)
+	assert.Equal(t, len(blocks), 2)
+	assert.Equal(t, blocks[0].Number, int64(5))
+	assert.Equal(t, blocks[1].Number, int64(8))
+
+	blocks, err = source.ShutterBlocksAfter(ctx, time.Time{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(blocks), 3)
+	assert.Equal(t, blocks[0].Number, int64(1))
+
+	blocks, err = source.ShutterBlocksAfter(ctx, time.Unix(1045, 0))
+	assert.NilError(t, err)
+	assert.Equal(t, len(blocks), 0)
+
+	// the duties are requested once per epoch
+	assert.DeepEqual(t, fixture.beacon.requests, map[int64]int{0: 1, 1: 1, 2: 1})
+}
+
+func TestBeaconShutterBlocksUnknownEpoch(t *testing.T) {
+	fixture := createBeaconFixture(t)
+	delete(fixture.beacon.duties, 2)
+	_, _, err := fixture.source.LatestShutterBlock(context.Background())
+	assert.ErrorContains(t, err, "proposer duties of epoch 2")
+}
+
+func receiveShutterBlocks(t *testing.T, out <-chan ShutterBlock, n int) []ShutterBlock {
+	t.Helper()
+	var blocks []ShutterBlock
+	for len(blocks) < n {
+		select {
+		case block := <-out:
+			blocks = append(blocks, block)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v of %v shutter blocks", len(blocks), n)
+		}
+	}
+	select {
+	case block := <-out:
+		t.Fatalf("unexpected shutter block %v", block.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return blocks
+}
+
+func TestDetectBeaconShutterBlocks(t *testing.T) {
+	fixture := createBeaconFixture(t)
+	observer := fixture.observer
+	cfg := createTestConfig(NewMemoryObserver())
+	cfg.shutterBlocks = fixture.source
+	heads := make(chan *types.Header)
+	out := make(chan ShutterBlock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go detectShutterBlocks(ctx, heads, out, cfg, "standard")
+	head, err := observedHeaders{observer}.HeaderByNumber(ctx, nil)
+	assert.NilError(t, err)
+	// block 8 of slot 9 was already there, when the detection started
+	heads <- head
+	receiveShutterBlocks(t, out, 0)
+
+	// the heads of slots 12 to 15 arrive at once, validator 1 proposed slots 13 and 17
+	fixture.beacon.mu.Lock()
+	for slot := int64(12); slot < 20; slot++ {
+		validator := slot % 4
+		fixture.beacon.duties[slot/4] = append(fixture.beacon.duties[slot/4],
+			ProposerDuty{Slot: slot, ValidatorIndex: validator, PublicKey: fixture.pubkeys[validator]})
+	}
+	fixture.beacon.mu.Unlock()
+	for slot := int64(12); slot < 16; slot++ {
+		observer.AddBlock(ObservedBlock{Number: slot - 1, Slot: slot, Timestamp: 1000 + 5*slot})
+	}
+	head, err = observedHeaders{observer}.HeaderByNumber(ctx, nil)
+	assert.NilError(t, err)
+	heads <- head
+	blocks := receiveShutterBlocks(t, out, 1)
+	assert.Equal(t, blocks[0].Number, int64(12))
+	assert.Assert(t, !blocks[0].DetectedAt.IsZero())
+
+	// a head dispatched again after a reconnection is not detected twice
+	heads <- head
+	receiveShutterBlocks(t, out, 0)
+
+	observer.AddBlock(ObservedBlock{Number: 15, Slot: 16, Timestamp: 1080})
+	observer.AddBlock(ObservedBlock{Number: 16, Slot: 17, Timestamp: 1085})
+	head, err = observedHeaders{observer}.HeaderByNumber(ctx, nil)
+	assert.NilError(t, err)
+	heads <- head
+	blocks = receiveShutterBlocks(t, out, 1)
+	assert.Equal(t, blocks[0].Number, int64(16))
+}
+
+func TestDetectObserverShutterBlocks(t *testing.T) {
+	observerPollInterval = 10 * time.Millisecond
+	defer func() { observerPollInterval = time.Second }()
+	observer := createObserverFixture()
+	cfg := createTestConfig(observer)
+	out := make(chan ShutterBlock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	heads := make(chan *types.Header)
+	go detectShutterBlocks(ctx, heads, out, cfg, "standard")
+	heads <- &types.Header{Number: big.NewInt(103)}
+	receiveShutterBlocks(t, out, 0)
+
+	// the observer is polled without new heads, as it lags behind them
+	observer.AddProposerDuty(ProposerDuty{Slot: 16, ValidatorIndex: 1, PublicKey: "0x01"})
+	observer.AddBlock(ObservedBlock{Number: 104, Slot: 14, Timestamp: 1048})
+	observer.AddBlock(ObservedBlock{Number: 105, Slot: 16, Timestamp: 1072})
+	blocks := receiveShutterBlocks(t, out, 2)
+	assert.Equal(t, blocks[0].Number, int64(104))
+	assert.Equal(t, blocks[1].Number, int64(105))
+}
+
+func TestValidatorRegistrySync(t *testing.T) {
+	key, pubkey := blsKey(1)
+	logs := &registryLogs{}
+	logs.add(t, 5, registration(7, 3, true), key)
+	logs.add(t, maxRegistryBlockRange+10, registration(7, 4, false), key)
+
+	registry, err := NewValidatorRegistry(logs, testRegistryAddress, testChainID, 6)
+	assert.NilError(t, err)
+	assert.NilError(t, registry.Sync(context.Background(), 100))
+	assert.Assert(t, !registry.IsRegistered(7, pubkey), "the registration is before the start block")
+
+	logs.add(t, 50, registration(7, 3, true), key)
+	assert.NilError(t, registry.Sync(context.Background(), 100))
+	assert.Assert(t, !registry.IsRegistered(7, pubkey), "block 50 was already synced")
+
+	registry, err = NewValidatorRegistry(logs, testRegistryAddress, testChainID, 0)
+	assert.NilError(t, err)
+	assert.NilError(t, registry.Sync(context.Background(), 100))
+	assert.Assert(t, registry.IsRegistered(7, pubkey))
+	assert.Assert(t, !registry.IsRegistered(7, "0x1234"))
+	assert.Assert(t, registry.IsRegistered(7, pubkey))
+	assert.NilError(t, registry.Sync(context.Background(), 2*maxRegistryBlockRange))
+	assert.Assert(t, !registry.IsRegistered(7, pubkey))
+	assert.Equal(t, registry.syncedUntil, uint64(2*maxRegistryBlockRange))
+}
+
+func TestBeaconClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/prefix/eth/v1/validator/duties/proposer/3")
+		fmt.Fprint(w, `{"dependent_root": "0x00", "data": [{"pubkey": "0xab", "validator_index": "12", "slot": "96"}]}`)
+	}))
+	defer server.Close()
+	client, err := NewBeaconClient(server.URL + "/prefix")
+	assert.NilError(t, err)
+	duties, err := client.ProposerDuties(context.Background(), 3)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, duties, []ProposerDuty{{Slot: 96, ValidatorIndex: 12, PublicKey: "0xab"}})
+}
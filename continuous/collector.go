@@ -1,22 +1,19 @@
 package continuous
 
 import (
-	"bufio"
 	"context"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"os"
 	"path"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/jackc/pgtype"
 	"github.com/montanaflynn/stats"
 	"github.com/shutter-network/nethermind-tests/utils"
@@ -25,12 +22,14 @@ import (
 )
 
 type ValidatorBlame struct {
-	prefix            []byte
-	triggerBlock      int64
-	submitBlock       int64
-	targetBlock       int64
-	targetBlockTS     *pgtype.Date
-	targetSlot        int64
+	prefix        []byte
+	triggerBlock  int64
+	submitBlock   int64
+	targetBlock   int64
+	targetBlockTS *pgtype.Date
+	targetSlot    int64
+	// slots between the submission and the target, that have no block
+	missedSlots       []int64
 	decryptedTxHash   common.Hash
 	validatorIndex    int64
 	decryptionKey     DecryptionKey
@@ -39,61 +38,6 @@ type ValidatorBlame struct {
 	credentials       common.Address
 }
 
-func (b ValidatorBlame) String() string {
-	emptyHash := common.Hash(make([]byte, common.HashLength))
-	if b.decryptedTxHash == emptyHash {
-		return fmt.Sprintf(
-			"validator id\t: %v\n"+
-				"public key:\t %v\n"+
-				"withdrawal:\t %v\n"+
-				"triggered\t: %v\n"+
-				"submitted\t: %v\n"+
-				"target block\t: %v\n"+
-				"target slot\t: %v\n"+
-				"target ts\t: %v\n"+
-				"NO DECRYPTION KEY SEEN\n"+
-				"identity preimage:\n"+
-				"prefix\t%v\n"+
-				"sender\t%v\n",
-			b.validatorIndex,
-			b.proposerPublicKey,
-			b.credentials.Hex(),
-			b.triggerBlock,
-			b.submitBlock,
-			b.targetBlock,
-			b.targetSlot,
-			b.targetBlockTS.Time.UTC().Format("2006-01-01 15:04:05.000000"),
-			hex.EncodeToString(b.prefix),
-			hex.EncodeToString(b.sender.Bytes()),
-		)
-	} else {
-		return fmt.Sprintf(
-			"validator id\t: %v\n"+
-				"public key:\t %v\n"+
-				"withdrawal:\t %v\n"+
-				"triggered\t: %v\n"+
-				"submitted\t: %v\n"+
-				"target block\t: %v\n"+
-				"target slot\t: %v\n"+
-				"target ts\t: %v\n"+
-				"ts (key-target)\t: %vms\n"+
-				"decrypted tx\t: %v\n"+
-				"decryption key:\n%v\n",
-			b.validatorIndex,
-			b.proposerPublicKey,
-			b.credentials.Hex(),
-			b.triggerBlock,
-			b.submitBlock,
-			b.targetBlock,
-			b.targetSlot,
-			b.targetBlockTS.Time.UTC().Format("2006-01-01 15:04:05.000000"),
-			b.decryptionKey.createdTs.Time.UnixMilli()-b.targetBlockTS.Time.UnixMilli(),
-			b.decryptedTxHash.Hex(),
-			b.decryptionKey,
-		)
-	}
-}
-
 type DecryptionKey struct {
 	identityPreimage []byte
 	txPointer        int
@@ -101,20 +45,6 @@ type DecryptionKey struct {
 	createdTs        *pgtype.Date
 }
 
-func (d DecryptionKey) String() string {
-	return fmt.Sprintf(
-		"first seen\t: %v\n"+
-			"tx pointer\t: %v\n"+
-			"identity preimage:\n"+
-			"prefix\t%v\n"+
-			"sender\t%v",
-		d.createdTs.Time.UTC().Format("2006-01-01 15:04:05.000000"),
-		d.txPointer,
-		hex.EncodeToString(d.identityPreimage[:32]),
-		hex.EncodeToString(d.identityPreimage[32:]),
-	)
-}
-
 type Submission struct {
 	trigger   int64
 	sequenced int64
@@ -122,9 +52,12 @@ type Submission struct {
 
 func withdrawAddressForPublicKey(proposerPublicKey string, cfg *Configuration) (*common.Address, error) {
 	fmt.Printf("proposer public key is %v\n", proposerPublicKey)
+	if cfg.contracts.Depositcontract == nil {
+		return nil, fmt.Errorf("no deposit contract configured")
+	}
 	proposerKeyBytes, err := hex.DecodeString(proposerPublicKey[2:])
 	if err != nil {
-		fmt.Println("could not decode %v", err)
+		fmt.Printf("could not decode %v\n", err)
 		return nil, err
 	}
 	result, err := cfg.contracts.Depositcontract.ValidatorWithdrawalCredentials(&bind.CallOpts{
@@ -209,14 +142,12 @@ type NewBlockNumber struct {
 	uint64
 }
 
-func WatchHeads(ctx context.Context, client *ethclient.Client, blocksChannel chan *NewBlockNumber) error {
+// WatchHeads forwards the number of every new head to blocksChannel, using the head
+// subscription shared by all users of client.
+func WatchHeads(ctx context.Context, client utils.Backend, blocksChannel chan *NewBlockNumber) error {
 	log.Println("START watching heads")
-	newHeads := make(chan *types.Header)
-	sub, err := client.SubscribeNewHead(ctx, newHeads)
-	if err != nil {
-		return err
-	}
-	defer sub.Unsubscribe()
+	newHeads, unsubscribe := utils.HeadsFor(client).SubscribeHeads()
+	defer unsubscribe()
 	for {
 		select {
 		case <-ctx.Done():
@@ -226,27 +157,25 @@ func WatchHeads(ctx context.Context, client *ethclient.Client, blocksChannel cha
 				head.Number.Uint64(),
 			}
 			blocksChannel <- ev
-		case err := <-sub.Err():
-			log.Println("error when watching heads:", err)
-			return err
 		}
 	}
 }
 
-func PrimeBlockCache(cache *BlockCache, cfg *Configuration) error {
+// PrimeBlockCache fills cache with the transactions of every new head until ctx is done.
+func PrimeBlockCache(ctx context.Context, cache *BlockCache, cfg *Configuration) error {
 	blocks := make(chan *NewBlockNumber)
-	group, ctx := errgroup.WithContext(context.Background())
+	group, ctx := errgroup.WithContext(ctx)
 	group.Go(func() error { return WatchHeads(ctx, cfg.client, blocks) })
+	go func() {
+		group.Wait()
+		close(blocks)
+	}()
 	for block := range blocks {
 		maxCached := cache.MaxKey()
 		if maxCached > 0 && maxCached < block.uint64 {
 			collectSubmitIncomingTx(maxCached, block.uint64, cache, cfg)
 		}
 	}
-	go func() {
-		group.Wait()
-		close(blocks)
-	}()
 
 	log.Println("DONE watching heads")
 	return group.Wait()
@@ -296,102 +225,61 @@ func collectSubmitIncomingTx(startBlock uint64, endBlock uint64, cache *BlockCac
 	return result, nil
 }
 func queryBlockTriggers(startBlock uint64, endBlock uint64, cfg *Configuration) ([]int64, error) {
-	var blocks []int64
-	var block int64
-	query := `
-		SELECT
-			b.block_number
-		FROM block AS b
-			LEFT JOIN proposer_duties AS p
-			ON p.slot = b.slot
-			LEFT JOIN validator_status AS s
-			ON p.validator_index = s.validator_index
-		WHERE b.block_number >= $1
-		AND b.block_number <= $2
-		AND s.status = 'active_ongoing';
-		`
-	connection := GetConnection(cfg)
-	rows, err := connection.db.Query(context.Background(), query, startBlock, endBlock)
+	blocks, err := cfg.observer.ShutterBlockNumbers(context.Background(), startBlock, endBlock)
 	if err != nil {
-		return blocks, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		rows.Scan(&block)
-		blocks = append(blocks, block)
-	}
-	if rows.Err() != nil {
-		log.Println("errors when finding shutterized blocks: ", rows.Err())
+		log.Println("errors when finding shutterized blocks: ", err)
 		return blocks, err
 	}
 	return blocks, nil
 }
 
 func queryWhoToBlame(blame *ValidatorBlame, cfg *Configuration) error {
-	var targetBlock, targetSlot, validatorIndex int64
-	var targetTS *pgtype.Date
-
-	queryWhoToBlame := `
-	SELECT
-		b.block_number,
-		b.slot,
-		v.validator_index,
-		to_timestamp(b.block_timestamp),
-		p.public_key
-	FROM block AS b
-		LEFT JOIN proposer_duties AS p ON p.slot = b.slot
-		LEFT JOIN validator_status AS v ON v.validator_index = p.validator_index
-	WHERE v.status = 'active_ongoing'
-	AND b.block_number > $1
-	ORDER BY b.block_number ASC
-	LIMIT 1;`
-	connection := GetConnection(cfg)
-	rows, err := connection.db.Query(context.Background(), queryWhoToBlame, blame.submitBlock)
+	proposer, found, err := cfg.observer.NextShutterProposer(context.Background(), blame.submitBlock)
 	if err != nil {
+		log.Println("errors when finding validator to blame: ", err)
 		return err
 	}
-	defer rows.Close()
-	var publicKey string
-	for rows.Next() {
-		rows.Scan(&targetBlock, &targetSlot, &validatorIndex, &targetTS, &publicKey)
-		blame.targetBlock = targetBlock
-		blame.targetSlot = targetSlot
-		blame.targetBlockTS = targetTS
-		blame.validatorIndex = validatorIndex
-		blame.proposerPublicKey = publicKey
-		credentials, err := withdrawAddressForPublicKey(publicKey, cfg)
-		if err != nil {
-			fmt.Println("error getting withdrawal credentials %v", err)
-		}
-		blame.credentials = *credentials
+	if !found {
+		return nil
+	}
+	blame.targetBlock = proposer.BlockNumber
+	blame.targetSlot = proposer.Slot
+	blame.targetBlockTS = &proposer.Ts
+	blame.validatorIndex = proposer.ValidatorIndex
+	blame.proposerPublicKey = proposer.PublicKey
+	credentials, err := withdrawAddressForPublicKey(proposer.PublicKey, cfg)
+	if err != nil {
+		fmt.Printf("error getting withdrawal credentials %v\n", err)
+		return nil
+	}
+	blame.credentials = *credentials
+	return nil
+}
 
+// queryMissedSlots finds the slots between the submission and the target block, that were
+// missed by their proposers, from the chain.
+func queryMissedSlots(blame *ValidatorBlame, cfg *Configuration) error {
+	if cfg.slots == nil || blame.targetBlock == 0 {
+		return nil
 	}
-	if rows.Err() != nil {
-		log.Println("errors when finding validator to blame: ", rows.Err())
+	submitSlot, err := cfg.slots.SlotOfBlock(context.Background(), uint64(blame.submitBlock))
+	if err != nil {
 		return err
 	}
-	return nil
+	if blame.targetSlot-submitSlot < 2 {
+		return nil
+	}
+	blame.missedSlots, err = cfg.slots.MissedSlots(context.Background(), submitSlot+1, blame.targetSlot-1)
+	return err
 }
 
 func checkSlotMismatch(blame *ValidatorBlame, cfg *Configuration) error {
 	identityPreimage := utils.PrefixFromBlockNumber(blame.triggerBlock)
-	var seenSlot int64
-
-	queryDecryptionKeysByPreimage := `
-	SELECT decryption_keys_message_slot
-	FROM decryption_key AS k
-		LEFT JOIN decryption_keys_message_decryption_key AS dkmdk
-			ON k.id=dkmdk.decryption_key_id
-	WHERE k.identity_preimage=decode($1, 'hex')
-	`
-	connection := GetConnection(cfg)
-	rows, err := connection.db.Query(context.Background(), queryDecryptionKeysByPreimage, hex.EncodeToString(identityPreimage[:]))
+	slots, err := cfg.observer.DecryptionKeySlots(context.Background(), identityPreimage[:])
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		rows.Scan(&identityPreimage, &seenSlot)
+	for _, seenSlot := range slots {
 		log.Println("seen at", seenSlot)
 	}
 	return nil
@@ -410,6 +298,10 @@ func blameValidator(submission Submission, cfg *Configuration) (ValidatorBlame,
 	if err != nil {
 		return blame, err
 	}
+	err = queryMissedSlots(&blame, cfg)
+	if err != nil {
+		log.Println("could not find missed slots", err)
+	}
 	err = queryDecryptionKeysBySlot(&blame, cfg)
 	if err != nil {
 		return blame, err
@@ -424,54 +316,33 @@ func blameValidator(submission Submission, cfg *Configuration) (ValidatorBlame,
 }
 
 func queryDecryptionKeysBySlot(blame *ValidatorBlame, cfg *Configuration) error {
-	var identityPreimage, txHash []byte
-	var txPointer, eon int
-	var createdTs pgtype.Date
-
-	queryDecryptionKeysBySlot := `
-		SELECT
-			k.identity_preimage,
-			d.tx_pointer,
-			d.eon,
-			d.created_at,
-			t.tx_hash
-        FROM decryption_keys_message_decryption_key AS dkmdk
-                LEFT JOIN decryption_key AS k
-                ON dkmdk.decryption_key_id=k.id
-                LEFT JOIN decryption_keys_message AS d
-                ON d.slot=dkmdk.decryption_keys_message_slot
-				LEFT JOIN decrypted_tx AS t
-				ON t.decryption_key_id=k.id
-        WHERE dkmdk.decryption_keys_message_slot=$1;`
-	connection := GetConnection(cfg)
-	rows, err := connection.db.Query(context.Background(), queryDecryptionKeysBySlot, blame.targetSlot)
+	keys, err := cfg.observer.DecryptionKeysBySlot(context.Background(), blame.targetSlot)
 	if err != nil {
+		log.Println("errors when finding validator to blame: ", err)
 		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		rows.Scan(&identityPreimage, &txPointer, &eon, &createdTs, &txHash)
-		blockNumber := utils.BlockNumberFromPrefix(shcrypto.Block(identityPreimage[0:32]))
-		address := common.BytesToAddress(identityPreimage[32:])
+	for _, key := range keys {
+		if len(key.IdentityPreimage) < 32 {
+			log.Println("received short identity preimage", hex.EncodeToString(key.IdentityPreimage))
+			continue
+		}
+		blockNumber := utils.BlockNumberFromPrefix(shcrypto.Block(key.IdentityPreimage[0:32]))
+		address := common.BytesToAddress(key.IdentityPreimage[32:])
 		if address.Hex() == cfg.submitAccount.Address.Hex() && blockNumber == blame.triggerBlock {
+			createdTs := key.CreatedTs
 			blame.decryptionKey = DecryptionKey{
 				createdTs:        &createdTs,
-				txPointer:        txPointer,
-				eon:              eon,
-				identityPreimage: identityPreimage,
+				txPointer:        key.TxPointer,
+				eon:              key.Eon,
+				identityPreimage: key.IdentityPreimage,
 			}
-			if len(txHash) < 32 {
-				log.Println("received empty txhash", hex.EncodeToString(identityPreimage), txPointer, createdTs)
+			if len(key.TxHash) < 32 {
+				log.Println("received empty txhash", hex.EncodeToString(key.IdentityPreimage), key.TxPointer, key.CreatedTs)
 			} else {
-				blame.decryptedTxHash = common.Hash(txHash)
+				blame.decryptedTxHash = common.BytesToHash(key.TxHash)
 			}
 		}
 	}
-	// panic: runtime error: cannot convert slice with length 0 to array or pointer to array with length 32
-	if rows.Err() != nil {
-		log.Println("errors when finding validator to blame: ", rows.Err())
-		return err
-	}
 	return nil
 }
 
@@ -494,281 +365,206 @@ func buildInnerTxHashToTargetSlotMap(cfg *Configuration) map[string]int64 {
 }
 
 func queryValidatorInfoForBlock(blockNumber int64, cfg *Configuration) (int64, string, error) {
-	query := `
-		SELECT
-			p.validator_index,
-			COALESCE(vg.graffiti, '') AS graffiti
-		FROM block AS b
-			LEFT JOIN proposer_duties AS p ON p.slot = b.slot
-			LEFT JOIN validator_graffiti AS vg ON vg.validator_index = p.validator_index
-		WHERE b.block_number = $1
-		LIMIT 1;`
-	connection := GetConnection(cfg)
-	var validatorIndex int64
-	var graffiti string
-	err := connection.db.QueryRow(context.Background(), query, blockNumber).Scan(&validatorIndex, &graffiti)
+	info, err := cfg.observer.ValidatorInfoForBlock(context.Background(), blockNumber)
 	if err != nil {
 		return 0, "", err
 	}
-	return validatorIndex, graffiti, nil
+	return info.ValidatorIndex, info.Graffiti, nil
 }
 
-func queryStatusRatios(w *bufio.Writer, startBlock, endBlock uint64, cfg *Configuration) error {
-	queryStatusRatios := `
-	SELECT
-        dt.tx_hash,
-        dt.tx_status,
-        dt.slot AS inclusion_slot,
-        b_sequenced.slot AS sequenced_slot
-        FROM decryption_key AS dk 
-                LEFT JOIN decrypted_tx AS dt
-                        ON dt.decryption_key_id=dk.id
-                LEFT JOIN block AS b
-                        ON b.slot=dt.slot 
-                LEFT JOIN transaction_submitted_event AS tse
-                        ON tse.id=dt.transaction_submitted_event_id
-                LEFT JOIN block AS b_sequenced
-                        ON b_sequenced.block_number=tse.event_block_number
-	WHERE 
-        SUBSTRING(
-                ENCODE(dk.identity_preimage, 'hex'),  --- encode preimage as hex string
-                65  --- match only sender suffix of identity_preimage
-        ) = $1  --- address of tester account
-	AND 
-        b.block_number BETWEEN $2 AND $3;`
-	connection := GetConnection(cfg)
-	rows, err := connection.db.Query(context.Background(), queryStatusRatios, strings.ToLower(cfg.submitAccount.Address.Hex())[2:], startBlock, endBlock)
-	if err != nil {
-		return err
-	}
-	var count uint64
-	var shieldedAmount, unshieldedAmount, notIncludedAmount, pendingAmount, inTargetedSlotAmount, invalidForTargetAmount int64
-
-	var txHash []byte
-	var txStatus string
-	var inclusionSlot *int64
-	var sequencedSlot *int64
-
-	isGraffitiMode := len(cfg.GraffitiSet) > 0
-	var innerTxHashToTargetSlot map[string]int64
-	if isGraffitiMode {
-		innerTxHashToTargetSlot = buildInnerTxHashToTargetSlotMap(cfg)
-	}
-
-	defer rows.Close()
-	for rows.Next() {
-		err = rows.Scan(&txHash, &txStatus, &inclusionSlot, &sequencedSlot)
-		if err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
-		}
+// StatusRatios counts the observed status of the decrypted test transactions.
+type StatusRatios struct {
+	Count       uint64
+	Shielded    int64
+	Unshielded  int64
+	NotIncluded int64
+	Pending     int64
+	// only counted in graffiti mode
+	InTargetedSlot   int64
+	InvalidForTarget int64
+}
 
-		count++
+func computeStatusRatios(statuses []DecryptedTxStatus, innerTxHashToTargetSlot map[string]int64) StatusRatios {
+	var ratios StatusRatios
+	isGraffitiMode := innerTxHashToTargetSlot != nil
+	for _, status := range statuses {
+		ratios.Count++
 
 		// Check if this is a late sequencer transaction (invalid for target)
-		if isGraffitiMode && sequencedSlot != nil {
-			txHashHex := common.BytesToHash(txHash).Hex()
-			targetedSlot, exists := innerTxHashToTargetSlot[txHashHex]
-			if exists && targetedSlot != 0 && *sequencedSlot >= targetedSlot {
-				invalidForTargetAmount++
+		if isGraffitiMode && status.SequencedSlot != nil {
+			targetedSlot, exists := innerTxHashToTargetSlot[status.TxHash.Hex()]
+			if exists && targetedSlot != 0 && *status.SequencedSlot >= targetedSlot {
+				ratios.InvalidForTarget++
 			}
 		}
 
-		switch txStatus {
-		case "shielded inclusion":
-			shieldedAmount++
+		switch status.Status {
+		case observedShieldedInclusion:
+			ratios.Shielded++
 
 			// Check if included in targeted slot (only for shielded inclusions and in graffiti mode)
-			if isGraffitiMode && inclusionSlot != nil {
-				txHashHex := common.BytesToHash(txHash).Hex()
-				targetedSlot, exists := innerTxHashToTargetSlot[txHashHex]
-				if exists && targetedSlot != 0 && *inclusionSlot == targetedSlot {
-					inTargetedSlotAmount++
+			if isGraffitiMode && status.InclusionSlot != nil {
+				targetedSlot, exists := innerTxHashToTargetSlot[status.TxHash.Hex()]
+				if exists && targetedSlot != 0 && *status.InclusionSlot == targetedSlot {
+					ratios.InTargetedSlot++
 				}
 			}
-		case "unshielded inclusion":
-			unshieldedAmount++
-		case "not included":
-			notIncludedAmount++
-		case "pending":
-			pendingAmount++
+		case observedUnshieldedInclusion:
+			ratios.Unshielded++
+		case observedNotIncluded:
+			ratios.NotIncluded++
+		case observedPending:
+			ratios.Pending++
 		}
 	}
+	return ratios
+}
 
-	if rows.Err() != nil {
-		return rows.Err()
-	}
+func (r StatusRatios) pct(amount int64) float64 {
+	return float64(amount) / float64(r.Count) * 100
+}
 
-	if count == 0 {
-		_, err = fmt.Fprintf(w, "No transactions found for status ratios between blocks %v and %v\n", startBlock, endBlock)
-		return err
+// queryStatusRatios returns the status ratios of the test transactions included in the
+// block range and whether the targeted slots were compared.
+func queryStatusRatios(startBlock, endBlock uint64, cfg *Configuration) (StatusRatios, bool, error) {
+	statuses, err := cfg.observer.DecryptedTxStatuses(context.Background(), cfg.submitAccount.Address, startBlock, endBlock)
+	if err != nil {
+		return StatusRatios{}, false, err
 	}
 
-	shielded := float64(shieldedAmount) / float64(count) * 100
-	unshielded := float64(unshieldedAmount) / float64(count) * 100
-	notIncluded := float64(notIncludedAmount) / float64(count) * 100
-	pending := float64(pendingAmount) / float64(count) * 100
-
-	var inTargetedSlot float64
-	var invalidForTarget float64
+	// the targeted slots are also known for transactions restored from the journal,
+	// e.g. when collecting retroactively
+	var innerTxHashToTargetSlot map[string]int64
+	targetSlots := buildInnerTxHashToTargetSlotMap(cfg)
+	isGraffitiMode := len(cfg.GraffitiSet) > 0 || len(targetSlots) > 0
 	if isGraffitiMode {
-		inTargetedSlot = float64(inTargetedSlotAmount) / float64(count) * 100
-		invalidForTarget = float64(invalidForTargetAmount) / float64(count) * 100
+		innerTxHashToTargetSlot = targetSlots
 	}
+	return computeStatusRatios(statuses, innerTxHashToTargetSlot), isGraffitiMode, nil
+}
 
-	outputFormat := `%v tx found by observer
-%3.2f%% shielded (%v/%v)
-%3.2f%% unshielded (%v/%v)
-%3.2f%% not included (%v/%v)
-%3.2f%% still pending (%v/%v)
-`
-
-	outputArgs := []interface{}{
-		count,
-		shielded, shieldedAmount, count,
-		unshielded, unshieldedAmount, count,
-		notIncluded, notIncludedAmount, count,
-		pending, pendingAmount, count,
+// CollectContinuousTestStats writes the report for the block range to a new blame file
+// in the blame folder, in the report format of cfg.
+func CollectContinuousTestStats(startBlock uint64, endBlock uint64, cache *BlockCache, cfg *Configuration) error {
+	blameFile := path.Join(cfg.blameFolder, fmt.Sprint(time.Now().Unix())+"."+reportFileExtension(cfg.ReportFormat))
+	log.Println("writing blame to ", blameFile)
+	f, err := os.Create(blameFile)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+	return WriteContinuousTestStats(f, startBlock, endBlock, cache, cfg)
+}
 
-	// Add targeted slot stat and invalid for target stat only in graffiti mode
-	if isGraffitiMode {
-		outputFormat += `
-%3.2f%% included in targeted slot (shielded) (%v/%v)
-%3.2f%% invalid for target (late sequencer transaction) (%v/%v)`
-		outputArgs = append(outputArgs, inTargetedSlot, inTargetedSlotAmount, count, invalidForTarget, invalidForTargetAmount, count)
+// WriteContinuousTestStats writes the report for the block range to out, in the report
+// format of cfg, and adds the shutter slots of the range to the scoreboard.
+func WriteContinuousTestStats(out io.Writer, startBlock uint64, endBlock uint64, cache *BlockCache, cfg *Configuration) error {
+	report, err := CollectReport(startBlock, endBlock, cache, cfg)
+	if err != nil {
+		return err
 	}
-
-	_, err = fmt.Fprintf(w, outputFormat+"\n", outputArgs...)
-
-	return err
+	cfg.latestReport.set(report)
+	err = cfg.recordScores(report)
+	if err != nil {
+		log.Println("could not update the scoreboard:", err)
+	}
+	return WriteReport(out, report, cfg.ReportFormat)
 }
 
-func CollectContinuousTestStats(startBlock uint64, endBlock uint64, cache *BlockCache, cfg *Configuration) error {
-	failCnt := 0
+// CollectReport compares the test transactions sequenced in the block range with the
+// ones included and blames the validators for the missing ones.
+func CollectReport(startBlock uint64, endBlock uint64, cache *BlockCache, cfg *Configuration) (Report, error) {
+	report := Report{StartBlock: startBlock, EndBlock: endBlock}
 	var failed []Submission
 	var delays []float64
 	success, err := collectSubmitIncomingTx(startBlock, endBlock, cache, cfg)
 	if err != nil {
-		return err
+		return report, err
 	}
 	submit, err := collectSequencerEvents(startBlock, endBlock, cfg)
 	if err != nil {
-		return err
+		return report, err
 	}
 	successByTrigger := make(map[int64]Success)
 	for i := range success {
 		successByTrigger[success[i].trigger] = success[i]
 	}
 
-	var successful []Success
 	for i := range submit {
 		trigger := submit[i].trigger
 		included, ok := successByTrigger[trigger]
 		if ok {
 			delay := float64(included.included - submit[i].sequenced)
 			delays = append(delays, delay)
-			successful = append(successful, included)
+			report.Successes = append(report.Successes, included.report())
 		} else {
 			failed = append(failed, submit[i])
-			failCnt++
 		}
 	}
-	failPct := (float64(failCnt) / float64(len(submit)) * 100)
-	avgDelay, err := stats.Mean(delays)
-	if err != nil {
-		return err
+	report.Transactions = len(submit)
+	report.Failed = len(failed)
+	if len(submit) > 0 {
+		report.FailPct = float64(len(failed)) / float64(len(submit)) * 100
 	}
-	maxDelay, err := stats.Max(delays)
-	if err != nil {
-		return err
-	}
-	minDelay, err := stats.Min(delays)
-	if err != nil {
-		return err
-	}
-	medianDelay, err := stats.Median(delays)
-	if err != nil {
-		return err
+	if len(delays) > 0 {
+		report.Delay = &DelayStats{}
+		report.Delay.Avg, _ = stats.Mean(delays)
+		report.Delay.Max, _ = stats.Max(delays)
+		report.Delay.Min, _ = stats.Min(delays)
+		report.Delay.Median, _ = stats.Median(delays)
 	}
 	lastValidTrigger := endBlock - 1
 	triggers, err := queryBlockTriggers(startBlock, lastValidTrigger, cfg)
 	if err != nil {
-		return err
+		return report, err
 	}
 	submitTriggers := make([]int64, len(submit))
 	for i, s := range submit {
 		submitTriggers[i] = s.trigger
 	}
+	report.Triggers = len(triggers)
+	report.ShutterizedPct = float64(len(triggers)) / float64(endBlock-startBlock) * 100
+	report.MissedTriggers = utils.Difference(triggers, submitTriggers)
 
-	shutterizedPct := float64(len(triggers)) / float64(endBlock-startBlock) * 100
-	var blames []ValidatorBlame
 	for _, f := range failed {
 		blame, err := blameValidator(f, cfg)
 		if err != nil {
 			log.Println(err)
 		}
-		blames = append(blames, blame)
-	}
-
-	blameFile := path.Join(cfg.blameFolder, fmt.Sprint(time.Now().Unix())+".blame")
-	log.Println("writing blame to ", blameFile)
-	f, err := os.Create(blameFile)
-	if err != nil {
-		return err
+		report.Blames = append(report.Blames, blame.report())
 	}
-	defer f.Close()
-	w := bufio.NewWriter(f)
 
-	_, err = fmt.Fprintf(w, "found %v shutter test tx in block range[%v:%v] (%v triggers)\n", len(submit), startBlock, endBlock, len(triggers))
+	report.Status, report.GraffitiMode, err = queryStatusRatios(startBlock, endBlock, cfg)
 	if err != nil {
-		return err
-	}
-	err = queryStatusRatios(w, startBlock, endBlock, cfg)
-	if err != nil {
-		return err
-	}
-
-	_, err = fmt.Fprintf(w, "shutterized blocks %3.2f%%\n", shutterizedPct)
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintf(w, "fails %v (%3.2f%%)\n", failCnt, failPct)
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintf(w, "missed triggers %v: %v\n", len(triggers)-len(submit), utils.Difference(triggers, submitTriggers))
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintf(w, "delay max %0.0f min %0.0f avg %3.2f median %3.2f\n", maxDelay, minDelay, avgDelay, medianDelay)
-	if err != nil {
-		return err
-	}
-
-	_, err = fmt.Fprintf(w, "=== Information about successful transaction inclusions ===\n")
-	if err != nil {
-		return err
-	}
-
-	for _, s := range successful {
-		_, err = fmt.Fprintln(w, s)
-		if err != nil {
-			return err
+		return report, err
+	}
+
+	if cfg.eonKeys != nil {
+		report.Eons = []EonReport{}
+		for _, eon := range eonsInRange(cfg.eonKeys.History(), startBlock, endBlock) {
+			report.Eons = append(report.Eons, EonReport{
+				Index:           eon.Index,
+				KeyperSet:       eon.KeyperSet,
+				ActivationBlock: eon.ActivationBlock,
+				KeyBroadcast:    eon.Key != nil,
+			})
 		}
 	}
+	return report, nil
+}
 
-	_, err = fmt.Fprintf(w, "=== Information about failed blames ===\n")
-	if err != nil {
-		return err
-	}
-
-	for _, blame := range blames {
-		_, err = fmt.Fprintln(w, blame)
-		if err != nil {
-			return err
+// eonsInRange returns the eons, that were active in some block between startBlock and endBlock.
+func eonsInRange(history []utils.Eon, startBlock, endBlock uint64) []utils.Eon {
+	var result []utils.Eon
+	for i, eon := range history {
+		if eon.ActivationBlock > endBlock {
+			break
+		}
+		if i+1 < len(history) && history[i+1].ActivationBlock <= startBlock {
+			// replaced before the range started
+			continue
 		}
+		result = append(result, eon)
 	}
-	w.Flush()
-	return err
+	return result
 }
@@ -7,90 +7,114 @@ import (
 	"log"
 	"math/big"
 	"os"
-	"sync"
+	"path"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/supervisor"
 	"github.com/shutter-network/nethermind-tests/utils"
 )
 
 type Configuration struct {
 	accounts      []utils.Account
 	submitAccount utils.Account
-	client        *ethclient.Client
+	client        utils.Backend
 	status        Status
 	contracts     utils.Contracts
+	eonKeys       *utils.EonKeyService
+	pipeline      *Pipeline
 	chainID       *big.Int
+	nonces        *utils.NonceManager
 	DbUser        string
 	DbPass        string
 	DbAddr        string
 	DbName        string
 	PkFile        string
-	blameFolder   string
-	GraffitiSet   map[string]bool
-	Connection
+	// folder of the reports, journal and scoreboard
+	blameFolder string
+	// format of the blame files, one of ReportFormats
+	ReportFormat string
+	// nil, if the metrics are disabled
+	Metrics     *ModeMetrics
+	GraffitiSet map[string]bool
+	observer    ObserverStore
+	// detects the shutterized blocks, the observer if nil
+	shutterBlocks ShutterBlockSource
+	journal       *Journal
+	scoreboard    *Scoreboard
+	// the latest detected shutter blocks and collector report, for the API
+	recentBlocks *recentShutterBlocks
+	latestReport *latestReport
+	network      config.Profile
+	// nil, if the slot duration of the network is unknown
+	slots *utils.SlotService
+	// runs the goroutines of a continuous run and recovers their panics, may be nil
+	Helpers *supervisor.Group
 }
 
-type GraffitiList struct {
-	Graffitis []string `json:"graffitis"`
-}
-
-func (cfg *Configuration) NextAccount() *utils.Account {
-	return &cfg.accounts[cfg.status.TxCount()%len(cfg.accounts)]
-}
-func createConfiguration(mode string) (Configuration, error) {
-	cfg := Configuration{
-		status: Status{
-			statusModMutex: &sync.Mutex{},
-		},
+// Close stops the watchers of the transactions in flight, without changing their status,
+// and closes the files and connections of cfg. It also releases a partially created
+// configuration.
+func (cfg *Configuration) Close() {
+	inFlight, _ := cfg.status.snapshot()
+	for _, tx := range inFlight {
+		if tx.cancel != nil {
+			tx.stop()
+		}
 	}
-	PkFile, err := utils.ReadStringFromEnv("CONTINUOUS_PK_FILE")
-	if err != nil {
-		return cfg, err
+	cfg.status.watchers.Wait()
+	cfg.Helpers.Wait()
+	if cfg.journal != nil {
+		if err := cfg.journal.Close(); err != nil {
+			log.Println("could not close journal:", err)
+		}
 	}
-	cfg.PkFile = PkFile
-
-	RpcUrl, err := utils.ReadStringFromEnv("CONTINUOUS_TEST_RPC_URL")
-	if err != nil {
-		return cfg, err
+	if cfg.scoreboard != nil {
+		if err := cfg.scoreboard.Close(); err != nil {
+			log.Println("could not close scoreboard:", err)
+		}
 	}
-	client, err := ethclient.Dial(RpcUrl)
-	if err != nil {
-		return cfg, fmt.Errorf("could not create client %v", err)
+	if cfg.eonKeys != nil {
+		cfg.eonKeys.Close()
 	}
-
-	cfg.client = client
-
-	chainID, err := client.NetworkID(context.Background())
-	if err != nil {
-		return cfg, fmt.Errorf("could not query chainId %v", err)
+	if observer, ok := cfg.observer.(Connection); ok {
+		observer.Close()
+	}
+	if client, ok := cfg.client.(*ethclient.Client); ok {
+		utils.ForgetHeads(client)
+		client.Close()
 	}
+}
 
-	cfg.chainID = chainID
-	signerForChain := types.LatestSignerForChainID(chainID)
+type GraffitiList struct {
+	Graffitis []string `json:"graffitis"`
+}
 
-	submitKeyHex, err := utils.ReadStringFromEnv("CONTINUOUS_TEST_PK")
-	if err != nil {
-		return cfg, err
-	}
-	submitPrivateKey, err := crypto.HexToECDSA(submitKeyHex)
-	if err != nil {
-		return cfg, err
-	}
-	submitAccount, err := utils.AccountFromPrivateKey(submitPrivateKey, signerForChain)
-	if err != nil {
-		return cfg, err
+func (cfg *Configuration) NextAccount() *utils.Account {
+	return &cfg.accounts[cfg.status.TxCount()%len(cfg.accounts)]
+}
+func createConfiguration(mode string, network config.Profile, files Files) (cfg Configuration, err error) {
+	if len(files.PkFile) == 0 {
+		return cfg, fmt.Errorf("no pk file of the test accounts given")
 	}
-	log.Printf("submit account is %v\n", submitAccount.Address.Hex())
-	submitNonce, err := client.NonceAt(context.Background(), submitAccount.Address, nil)
+	cfg, err = createReadOnlyConfiguration(mode, network, files.BlameFolder, observerNeeded(mode, network))
 	if err != nil {
 		return cfg, err
 	}
-	submitAccount.Nonce = big.NewInt(int64(submitNonce))
-	cfg.submitAccount = submitAccount
-	accounts := retrieveAccounts(NumFundedAccounts, client, signerForChain, &cfg)
-	createdAccounts, err := createAccounts(NumFundedAccounts-len(accounts), signerForChain)
+	defer func() {
+		if err != nil {
+			cfg.Close()
+		}
+	}()
+	cfg.PkFile = files.PkFile
+	cfg.nonces = utils.NewNonceManager(cfg.client)
+	cfg.submitAccount.Nonces = cfg.nonces
+	signerForChain := types.LatestSignerForChainID(cfg.chainID)
+	accounts := retrieveAccounts(NumFundedAccounts, cfg.client, signerForChain, &cfg)
+	createdAccounts, err := createAccounts(NumFundedAccounts-len(accounts), signerForChain, cfg.nonces)
 	if err != nil {
 		return cfg, err
 	}
@@ -102,68 +126,129 @@ func createConfiguration(mode string) (Configuration, error) {
 		accounts = append(accounts, created)
 	}
 	for i := range accounts {
-		err = fundNewAccount(accounts[i], MinimalFunding, &submitAccount, client)
+		err = fundNewAccount(accounts[i], MinimalFunding, &cfg.submitAccount, cfg.client)
 		if err != nil {
 			return cfg, err
 		}
 	}
 	cfg.accounts = accounts
-	submitNonce, err = client.NonceAt(context.Background(), submitAccount.Address, nil)
+	cfg.pipeline = NewPipeline()
+
+	journal, entries, err := OpenJournal(cfg.journalFile(mode))
 	if err != nil {
 		return cfg, err
 	}
-	cfg.submitAccount.Nonce = big.NewInt(int64(submitNonce))
-
-	keyBroadcastAddress, err := utils.ReadStringFromEnv("CONTINUOUS_KEY_BROADCAST_CONTRACT_ADDRESS")
+	cfg.journal = journal
+	err = cfg.restoreFromJournal(entries)
 	if err != nil {
 		return cfg, err
 	}
-	keyperSetAddress, err := utils.ReadStringFromEnv("CONTINUOUS_KEYPER_SET_CONTRACT_ADDRESS")
+
+	scoreboardFile := os.Getenv("CONTINUOUS_SCOREBOARD_FILE")
+	if len(scoreboardFile) == 0 {
+		scoreboardFile = path.Join(cfg.blameFolder, ScoreboardFileName(mode))
+	}
+	cfg.scoreboard, err = OpenScoreboard(scoreboardFile)
 	if err != nil {
 		return cfg, err
 	}
-	sequencerAddress, err := utils.ReadStringFromEnv("CONTINUOUS_SEQUENCER_ADDRESS")
+	return cfg, nil
+}
+
+// createReadOnlyConfiguration connects to the chain and the observer, without touching
+// the test accounts, the journal or the scoreboard. The observer settings are only
+// required, if needsObserver is set.
+func createReadOnlyConfiguration(mode string, network config.Profile, blameFolder string, needsObserver bool) (cfg Configuration, err error) {
+	cfg = Configuration{
+		status:       newStatus(),
+		network:      network,
+		recentBlocks: newRecentShutterBlocks(),
+		latestReport: &latestReport{},
+	}
+	defer func() {
+		if err != nil {
+			cfg.Close()
+		}
+	}()
+	err = network.Require(config.ContinuousEnv, "rpcUrl", "privateKey",
+		"contracts.keyBroadcast", "contracts.keyperSetManager", "contracts.sequencer")
 	if err != nil {
 		return cfg, err
 	}
-	contracts, err := utils.SetupContracts(client, keyBroadcastAddress, sequencerAddress, keyperSetAddress, chainID)
+	if len(blameFolder) == 0 {
+		blameFolder = os.TempDir()
+	}
+	cfg.blameFolder = blameFolder
+
+	client, err := ethclient.Dial(network.RPCURL)
 	if err != nil {
-		return cfg, err
+		return cfg, fmt.Errorf("could not create client %v", err)
 	}
-	cfg.contracts = contracts
-	DbName, err := utils.ReadStringFromEnv("CONTINUOUS_DB_NAME")
+	cfg.client = client
+
+	chainID, err := client.NetworkID(context.Background())
+	if err != nil {
+		return cfg, fmt.Errorf("could not query chainId %v", err)
+	}
+	err = network.CheckChainID(chainID)
 	if err != nil {
 		return cfg, err
 	}
-	cfg.DbName = DbName
-	DbUser, err := utils.ReadStringFromEnv("CONTINUOUS_DB_USER")
+	network = network.ForChain(chainID)
+	cfg.network = network
+	clock, err := utils.NewSlotClock(network.GenesisTimestamp, network.SecondsPerSlot, network.SlotsPerEpoch)
+	if err != nil {
+		log.Println("slots are only known from the observer:", err)
+	} else {
+		cfg.slots = utils.NewSlotService(client, clock)
+	}
+
+	cfg.chainID = chainID
+	signerForChain := types.LatestSignerForChainID(chainID)
+
+	submitPrivateKey, err := crypto.HexToECDSA(network.PrivateKey)
 	if err != nil {
 		return cfg, err
 	}
-	cfg.DbUser = DbUser
-	DbAddr, err := utils.ReadStringFromEnv("CONTINUOUS_DB_ADDRESS")
+	submitAccount, err := utils.AccountFromPrivateKey(submitPrivateKey, signerForChain)
 	if err != nil {
 		return cfg, err
 	}
-	log.Println("DbAddr is", DbAddr)
-	cfg.DbAddr = DbAddr
-	DbPass, err := utils.ReadStringFromEnv("CONTINUOUS_DB_PASS")
+	log.Printf("submit account is %v\n", submitAccount.Address.Hex())
+	cfg.submitAccount = submitAccount
+
+	contracts, err := utils.SetupContracts(client, network.Contracts.KeyBroadcast, network.Contracts.Sequencer,
+		network.Contracts.KeyperSetManager, network.Contracts.DepositContract, chainID)
 	if err != nil {
 		return cfg, err
 	}
-	cfg.DbPass = DbPass
-	blameFolder, err := utils.ReadStringFromEnv("CONTINUOUS_BLAME_FOLDER")
+	cfg.contracts = contracts
+	eonKeys, err := utils.NewEonKeyService(client, contracts.KeyperSetManager, contracts.KeyBroadcastContract, KeyperSetChangeLookAhead)
 	if err != nil {
 		return cfg, err
 	}
-	if len(blameFolder) == 0 {
-		tmp, err := os.MkdirTemp("", "blame")
+	cfg.eonKeys = eonKeys
+	// without the observer, a run with the beacon shutter blocks writes no reports
+	if needsObserver || network.DB != (config.DB{}) {
+		err = network.Require(config.ContinuousEnv, "db.name", "db.user", "db.addr", "db.pass")
 		if err != nil {
 			return cfg, err
 		}
-		blameFolder = tmp
+		cfg.DbName = network.DB.Name
+		cfg.DbUser = network.DB.User
+		log.Println("DbAddr is", network.DB.Addr)
+		cfg.DbAddr = network.DB.Addr
+		cfg.DbPass = network.DB.Pass
+		observer, err := ConnectObserver(context.Background(), network.DB)
+		if err != nil {
+			return cfg, fmt.Errorf("could not connect to the observer database: %w", err)
+		}
+		cfg.observer = observer
+	}
+	err = cfg.setupShutterBlocks(client)
+	if err != nil {
+		return cfg, err
 	}
-	cfg.blameFolder = blameFolder
 
 	// Only load graffiti JSON when running in graffiti mode
 	if mode == "graffiti" {
@@ -180,6 +265,65 @@ func createConfiguration(mode string) (Configuration, error) {
 	return cfg, nil
 }
 
+// journalFile returns the journal of mode, the default one in the blame folder, unless
+// CONTINUOUS_JOURNAL_FILE is set.
+func (cfg *Configuration) journalFile(mode string) string {
+	journalFile := os.Getenv("CONTINUOUS_JOURNAL_FILE")
+	if len(journalFile) == 0 {
+		journalFile = path.Join(cfg.blameFolder, JournalFileName(mode))
+	}
+	return journalFile
+}
+
+// observerNeeded reports, if a run of mode needs the observer database, because it detects
+// the shutter blocks or the graffiti slots with it.
+func observerNeeded(mode string, network config.Profile) bool {
+	return mode == "graffiti" || network.ShutterBlocks == "" || network.ShutterBlocks == "observer"
+}
+
+// HasObserver reports, if cfg is connected to the observer database, that the reports need.
+func (cfg *Configuration) HasObserver() bool {
+	return cfg.observer != nil
+}
+
+// setupShutterBlocks selects the source of the shutterized blocks of the network profile.
+func (cfg *Configuration) setupShutterBlocks(client utils.Backend) error {
+	switch cfg.network.ShutterBlocks {
+	case "", "observer":
+		return nil
+	case "beacon":
+	default:
+		return fmt.Errorf("unknown shutter blocks source %v, use observer or beacon", cfg.network.ShutterBlocks)
+	}
+	err := cfg.network.Require(config.ContinuousEnv, "beaconUrl", "contracts.validatorRegistry")
+	if err != nil {
+		return err
+	}
+	if cfg.slots == nil {
+		return fmt.Errorf("the beacon shutter blocks need the genesis timestamp and slot duration of the network")
+	}
+	beacon, err := NewBeaconClient(cfg.network.BeaconURL)
+	if err != nil {
+		return err
+	}
+	registry, err := NewValidatorRegistry(client, common.HexToAddress(cfg.network.Contracts.ValidatorRegistry),
+		cfg.chainID.Uint64(), cfg.network.Contracts.ValidatorRegistryStartBlock)
+	if err != nil {
+		return err
+	}
+	log.Println("detecting shutter blocks with the beacon node", cfg.network.BeaconURL)
+	cfg.shutterBlocks = NewBeaconShutterBlocks(beacon, registry, cfg.slots)
+	return nil
+}
+
+// shutterBlockSource returns the source of the shutterized blocks.
+func (cfg *Configuration) shutterBlockSource() ShutterBlockSource {
+	if cfg.shutterBlocks != nil {
+		return cfg.shutterBlocks
+	}
+	return cfg.observer
+}
+
 func loadGraffitiJSON() (map[string]bool, error) {
 	graffitiFilePath, err := utils.ReadStringFromEnv("GRAFFITI_FILE_PATH")
 	if err != nil {
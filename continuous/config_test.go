@@ -0,0 +1,29 @@
+package continuous
+
+import (
+	"testing"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"gotest.tools/assert"
+)
+
+// createTestConfig returns a configuration without a client, reading from observer, that
+// the tests complete with what they need.
+func createTestConfig(observer ObserverStore) *Configuration {
+	return &Configuration{
+		observer:      observer,
+		submitAccount: utils.Account{Address: testSender},
+		status:        newStatus(),
+		GraffitiSet:   make(map[string]bool),
+		recentBlocks:  newRecentShutterBlocks(),
+		latestReport:  &latestReport{},
+	}
+}
+
+func TestObserverNeeded(t *testing.T) {
+	assert.Assert(t, observerNeeded("standard", config.Profile{}))
+	assert.Assert(t, observerNeeded("standard", config.Profile{ShutterBlocks: "observer"}))
+	assert.Assert(t, !observerNeeded("standard", config.Profile{ShutterBlocks: "beacon"}))
+	assert.Assert(t, observerNeeded("graffiti", config.Profile{ShutterBlocks: "beacon"}))
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/jackc/pgtype"
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/supervisor"
+	"github.com/shutter-network/nethermind-tests/utils"
 )
 
 const KeyperSetChangeLookAhead = 2
@@ -15,14 +20,20 @@ const NumFundedAccounts = 6
 const MinimalFunding = int64(500000000000000000) // 0.5 ETH in wei
 
 type Status struct {
-	statusModMutex  *sync.Mutex
-	lastShutterTS   pgtype.Date
-	txInFlight      []*ShutterTx
-	txDone          []*ShutterTx
-	nextShutterSlot int64
+	statusModMutex *sync.Mutex
+	// counts the running WatchTx goroutines
+	watchers   *sync.WaitGroup
+	txInFlight []*ShutterTx
+	txDone     []*ShutterTx
 }
 
-func (s Status) TxCount() int {
+func newStatus() Status {
+	return Status{statusModMutex: &sync.Mutex{}, watchers: &sync.WaitGroup{}}
+}
+
+func (s *Status) TxCount() int {
+	s.statusModMutex.Lock()
+	defer s.statusModMutex.Unlock()
 	return len(s.txInFlight) + len(s.txDone)
 }
 
@@ -32,181 +43,142 @@ func (s *Status) AddTxInFlight(t *ShutterTx) {
 	s.statusModMutex.Unlock()
 }
 
+// watch runs WatchTx for tx in the background, in helpers if it is not nil.
+func (s *Status) watch(tx *ShutterTx, client utils.Backend, helpers *supervisor.Group) {
+	s.watchers.Add(1)
+	helpers.Go(func() {
+		defer s.watchers.Done()
+		WatchTx(tx, client)
+	})
+}
+
 type ShutterBlock struct {
 	Number       int64
 	Ts           pgtype.Date
 	TargetedSlot int64
+	// when the block was found by the shutter block source
+	DetectedAt time.Time
 }
 
-func QueryAllShutterBlocks(out chan<- ShutterBlock, cfg *Configuration, mode string) {
-	waitBetweenQueries := 1 * time.Second
-	status := Status{lastShutterTS: pgtype.Date{}}
-	connection := GetConnection(cfg)
-	query := `
-		SELECT
-			to_timestamp(b.block_timestamp)
-		FROM validator_status AS v
-			LEFT JOIN proposer_duties AS p
-			ON p.validator_index = v.validator_index
-			LEFT JOIN block AS b
-			ON b.slot=p.slot
-		WHERE v.status = 'active_ongoing'
-		AND b.slot = p.slot
-		ORDER BY b.block_number DESC
-		LIMIT 1;
-	`
-	rows, err := connection.db.Query(context.Background(), query)
+// observerPollInterval is the time between the queries of a shutter block source, that
+// does not follow the chain itself, e.g. the observer, which lags behind the new heads.
+var observerPollInterval = time.Second
+
+// QueryAllShutterBlocks sends the shutterized blocks found by the shutter block source to
+// out until ctx is done. The source is queried on every new head of the chain.
+func QueryAllShutterBlocks(ctx context.Context, out chan<- ShutterBlock, cfg *Configuration, mode string) {
+	heads, unsubscribe := utils.HeadsFor(cfg.client).SubscribeHeads()
+	defer unsubscribe()
+	detectShutterBlocks(ctx, heads, out, cfg, mode)
+}
+
+// detectShutterBlocks sends the shutterized blocks up to the heads to out. Every block is
+// sent once and in order, also if heads were skipped, e.g. after a reconnection. Sources,
+// that do not follow the chain, are additionally polled in between the heads.
+func detectShutterBlocks(ctx context.Context, heads <-chan *types.Header, out chan<- ShutterBlock, cfg *Configuration, mode string) {
+	tracker := shutterBlockTracker{}
+	latest, found, err := cfg.shutterBlockSource().LatestShutterBlock(ctx)
 	if err != nil {
-		panic(err)
+		log.Println("errors when finding shutterized blocks: ", err)
 	}
-	defer rows.Close()
-	var ts pgtype.Date
-	for rows.Next() {
-		rows.Scan(&ts)
-		if !ts.Time.IsZero() {
-			status.lastShutterTS = ts
-		}
+	if found {
+		tracker.last = latest
 	}
-	if rows.Err() != nil {
-		log.Println("errors when finding shutterized blocks: ", rows.Err())
+	var poll <-chan time.Time
+	if _, ok := cfg.shutterBlockSource().(headShutterBlockSource); !ok || mode == "graffiti" {
+		ticker := time.NewTicker(observerPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
 	}
-
-	var newShutterBlock ShutterBlock
+	nextShutterSlot := int64(0)
 	for {
-		time.Sleep(waitBetweenQueries)
-		fmt.Printf(".")
+		var head *types.Header
+		select {
+		case <-ctx.Done():
+			return
+		case head = <-heads:
+			if cfg.slots != nil {
+				cfg.slots.Observe(head)
+			}
+		case <-poll:
+		}
+		var blocks []ShutterBlock
 		switch mode {
 		case "standard":
-			newShutterBlock = queryNewestShutterBlock(status.lastShutterTS, cfg)
-			if !newShutterBlock.Ts.Time.IsZero() {
-				status.lastShutterTS = newShutterBlock.Ts
-				// send event (block number, timestamp) to out channel
-				out <- newShutterBlock
+			blocks, err = tracker.next(ctx, cfg.shutterBlockSource(), head)
+			if err != nil {
+				log.Println("errors when finding shutterized blocks: ", err)
 			}
 		case "graffiti":
-			newShutterBlock := queryGraffitiNextShutterBlock(status.nextShutterSlot, cfg)
-			if !newShutterBlock.Ts.Time.IsZero() {
-				status.nextShutterSlot = newShutterBlock.TargetedSlot
-				// send event (block number, timestamp) to out channel
-				out <- newShutterBlock
+			block := queryGraffitiNextShutterBlock(nextShutterSlot, cfg)
+			if !block.Ts.Time.IsZero() {
+				nextShutterSlot = block.TargetedSlot
+				blocks = append(blocks, block)
+			}
+		}
+		for _, block := range blocks {
+			block.DetectedAt = time.Now()
+			cfg.Metrics.shutterBlock(block.Number)
+			cfg.recentBlocks.add(block)
+			select {
+			case out <- block:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}
 }
 
-func queryNewestShutterBlock(lastBlockTS pgtype.Date, cfg *Configuration) ShutterBlock {
-	connection := GetConnection(cfg)
-	block := int64(0)
-	var ts pgtype.Date
-	query := `
-		SELECT
-			b.block_number,
-			to_timestamp(b.block_timestamp)
-		FROM validator_status AS v
-			LEFT JOIN proposer_duties AS p
-			ON p.validator_index = v.validator_index
-			LEFT JOIN block AS b
-			ON b.slot=p.slot
-		WHERE v.status = 'active_ongoing'
-		AND b.slot = p.slot
-		AND b.block_timestamp > $1;
-	`
-	rows, err := connection.db.Query(context.Background(), query, lastBlockTS.Time.Unix())
-	if err != nil {
-		panic(err)
+// shutterBlockTracker remembers the last detected shutter block, so that the blocks after
+// it are detected exactly once and in order.
+type shutterBlockTracker struct {
+	last ShutterBlock
+}
+
+// next returns the shutter blocks after the last detected one. head is nil, if it is not
+// known.
+func (t *shutterBlockTracker) next(ctx context.Context, source ShutterBlockSource, head *types.Header) ([]ShutterBlock, error) {
+	var blocks []ShutterBlock
+	var err error
+	if headSource, ok := source.(headShutterBlockSource); ok && head != nil {
+		blocks, err = headSource.ShutterBlocksUpTo(ctx, t.last.Ts.Time, head)
+	} else {
+		blocks, err = source.ShutterBlocksAfter(ctx, t.last.Ts.Time)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		if block != 0 {
-			log.Fatal("Finding multiple blocks")
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number < blocks[j].Number })
+	var newBlocks []ShutterBlock
+	for _, block := range blocks {
+		if block.Number <= t.last.Number || block.Ts.Time.IsZero() {
+			continue
 		}
-		rows.Scan(&block, &ts)
-		if !ts.Time.IsZero() {
-			log.Printf("FOUND NEW SHUTTER BLOCK %v: %v", block, ts.Time)
-		}
-	}
-	if rows.Err() != nil {
-		log.Println("errors when finding shutterized blocks: ", rows.Err())
+		log.Printf("FOUND NEW SHUTTER BLOCK %v: %v", block.Number, block.Ts.Time)
+		newBlocks = append(newBlocks, ShutterBlock{Number: block.Number, Ts: block.Ts})
+		t.last = block
 	}
-	res := ShutterBlock{}
-	res.Number = block
-	res.Ts = ts
-	return res
+	return newBlocks, err
 }
 
-func queryGraffitiNextShutterBlock(nextShutterSlot int64, cfg *Configuration) (ShutterBlock) {
-	connection := GetConnection(cfg)
-
-	// This query processes the current Shutter block while simultaneously computing
-	// the next Shutter Slot. The transaction will be sent during the current Shutter
-	// block (the trigger block) for inclusion into the next Shutter Slot, but it will
-	// be tied to the current Shutter block using the identity prefix.
-	query := `
-		WITH current_shutter_block AS (
-			SELECT
-				block_number,
-				slot,
-				to_timestamp(block_timestamp) AS ts
-			FROM block
-			ORDER BY slot DESC
-			LIMIT 1
-		),
-		next_shutter_slot AS (
-			SELECT
-				pd.validator_index,
-				pd.slot AS next_slot
-			FROM proposer_duties pd
-			JOIN validator_status vs
-				ON vs.validator_index = pd.validator_index
-			WHERE vs.status = 'active_ongoing'
-			AND pd.slot > (SELECT slot FROM current_shutter_block)
-			ORDER BY pd.slot ASC
-			LIMIT 1
-		)
-		SELECT
-			ns.next_slot,
-			ns.validator_index,
-			vg.graffiti,
-			cb.block_number,
-			cb.ts
-		FROM next_shutter_slot ns
-		JOIN validator_graffiti vg
-			ON vg.validator_index = ns.validator_index
-		JOIN current_shutter_block cb ON TRUE;
-	`
-
-	var (
-		nextSlot       int64
-		validatorIndex int64
-		graffiti       string
-		blockNumber    int64
-		ts             pgtype.Date
-	)
-
-	row := connection.db.QueryRow(context.Background(), query)
-
-	err := row.Scan(
-		&nextSlot,
-		&validatorIndex,
-		&graffiti,
-		&blockNumber,
-		&ts,
-	)
-	if err != nil {
+func queryGraffitiNextShutterBlock(nextShutterSlot int64, cfg *Configuration) ShutterBlock {
+	next, found, err := cfg.observer.NextShutterSlot(context.Background())
+	if err != nil || !found {
 		return ShutterBlock{}
 	}
 
 	// Skip if a block was already returned for the same shutter slot or if there is a consecutive slot
-	if nextSlot <= nextShutterSlot + 1 {
+	if next.Slot <= nextShutterSlot+1 {
 		return ShutterBlock{}
 	}
 
-	if graffiti != "" && cfg.GraffitiSet[graffiti] {
+	if next.Graffiti != "" && cfg.GraffitiSet[next.Graffiti] {
+		if cfg.slots != nil && !time.Now().Before(cfg.slots.Clock.SlotStart(next.Slot)) {
+			log.Printf("Graffiti slot %d already started, skipping it", next.Slot)
+			return ShutterBlock{}
+		}
 		log.Printf(
 			"Graffiti slot and target block found: nextSlot=%d next_shutter_validator=%d graffiti=%s block=%d ts=%v",
-			nextSlot, validatorIndex, graffiti, blockNumber, ts.Time,
+			next.Slot, next.ValidatorIndex, next.Graffiti, next.BlockNumber, next.Ts.Time,
 		)
-		return ShutterBlock{Number: blockNumber, Ts: ts, TargetedSlot: nextSlot}
+		return ShutterBlock{Number: next.BlockNumber, Ts: next.Ts, TargetedSlot: next.Slot}
 	}
 	return ShutterBlock{}
 }
@@ -215,25 +187,26 @@ func CheckTxInFlight(blockNumber int64, cfg *Configuration) {
 	cfg.status.statusModMutex.Lock()
 	var newInflight []*ShutterTx
 	newDone := cfg.status.txDone[:]
+	states := make([]txState, len(cfg.status.txInFlight))
 	highestInclusion := int64(0)
-	for _, tx := range cfg.status.txInFlight {
-		if tx.inclusionBlock > highestInclusion {
-			highestInclusion = tx.inclusionBlock
+	for i, tx := range cfg.status.txInFlight {
+		states[i] = tx.state()
+		if states[i].inclusionBlock > highestInclusion {
+			highestInclusion = states[i].inclusionBlock
 		}
 	}
-	for _, tx := range cfg.status.txInFlight {
+	for i, tx := range cfg.status.txInFlight {
 		done := false
-		switch s := tx.txStatus; s {
+		switch s := states[i].status; s {
 		case Sequenced:
 			// cancel signal: another included tx with inclusion block > submission block
-			if highestInclusion > tx.submissionBlock {
+			if highestInclusion > states[i].submissionBlock {
+				tx.markCancelled(blockNumber)
 				tx.cancel()
-				tx.cancelBlock = blockNumber
+				tx.record()
 				done = true
 			}
-		case Included:
-			done = true
-		case SystemFailure:
+		case Included, NotSequenced, NotIncluded, SystemFailure:
 			done = true
 		default:
 		}
@@ -259,6 +232,36 @@ func PrintAllTx(cfg *Configuration) {
 	}
 }
 
-func Setup(mode string) (Configuration, error) {
-	return createConfiguration(mode)
+// Files are the local files of a continuous mode.
+type Files struct {
+	// keys of the generated test accounts
+	PkFile string
+	// folder of the reports, journal and scoreboard, the temporary directory if empty
+	BlameFolder string
+}
+
+// Setup connects to the chain and observer of the network profile, that is read from the
+// configuration file and the CONTINUOUS_* variables. It funds the test accounts and
+// restores the transactions in flight from the journal.
+func Setup(mode string, network config.Profile, files Files) (Configuration, error) {
+	return createConfiguration(mode, network, files)
+}
+
+// SetupReadOnly connects to the chain and observer like Setup, to collect the reports of
+// mode. It does not send transactions and only reads the journal, for the targeted slots
+// of the transactions. The scoreboard is left alone.
+func SetupReadOnly(mode string, network config.Profile, blameFolder string) (Configuration, error) {
+	cfg, err := createReadOnlyConfiguration(mode, network, blameFolder, true)
+	if err != nil {
+		return cfg, err
+	}
+	entries, err := ReadJournal(cfg.journalFile(mode))
+	if err == nil {
+		err = cfg.loadJournal(entries)
+	}
+	if err != nil {
+		cfg.Close()
+		return cfg, err
+	}
+	return cfg, nil
 }
@@ -2,28 +2,382 @@ package continuous
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shutter-network/nethermind-tests/config"
 )
 
+// Connection is the ObserverStore backed by the observer's Postgres database.
 type Connection struct {
 	db *pgxpool.Pool
 }
 
-func GetConnection(cfg *Configuration) Connection {
-	if cfg.db != nil {
-		return cfg.Connection
+var _ ObserverStore = Connection{}
+
+// observerTables are the tables of the observer database, that the queries of this file use.
+var observerTables = []string{
+	"block",
+	"decrypted_tx",
+	"decryption_key",
+	"decryption_keys_message",
+	"decryption_keys_message_decryption_key",
+	"proposer_duties",
+	"transaction_submitted_event",
+	"validator_graffiti",
+	"validator_status",
+}
+
+// ConnectObserver connects to the observer database and returns an error, if it is not
+// reachable.
+func ConnectObserver(ctx context.Context, db config.DB) (Connection, error) {
+	cn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", db.User, db.Pass, db.Addr, db.Name)
+	pool, err := pgxpool.New(ctx, cn)
+	if err != nil {
+		return Connection{}, err
+	}
+	err = pool.Ping(ctx)
+	if err != nil {
+		pool.Close()
+		return Connection{}, err
+	}
+	return Connection{db: pool}, nil
+}
+
+func (c Connection) Close() {
+	c.db.Close()
+}
+
+// MissingTables returns the tables, that the queries need, but the observer database lacks.
+func (c Connection) MissingTables(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = current_schema()
+		AND table_name = ANY($1);
+	`
+	rows, err := c.db.Query(ctx, query, observerTables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		found[name] = true
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	var missing []string
+	for _, table := range observerTables {
+		if !found[table] {
+			missing = append(missing, table)
+		}
+	}
+	return missing, nil
+}
+
+func (c Connection) LatestShutterBlock(ctx context.Context) (ShutterBlock, bool, error) {
+	query := `
+		SELECT
+			b.block_number,
+			to_timestamp(b.block_timestamp)
+		FROM validator_status AS v
+			LEFT JOIN proposer_duties AS p
+			ON p.validator_index = v.validator_index
+			LEFT JOIN block AS b
+			ON b.slot=p.slot
+		WHERE v.status = 'active_ongoing'
+		AND b.slot = p.slot
+		ORDER BY b.block_number DESC
+		LIMIT 1;
+	`
+	var block ShutterBlock
+	err := c.db.QueryRow(ctx, query).Scan(&block.Number, &block.Ts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return block, false, nil
+	}
+	if err != nil {
+		return block, false, err
+	}
+	return block, true, nil
+}
+
+func (c Connection) ShutterBlocksAfter(ctx context.Context, ts time.Time) ([]ShutterBlock, error) {
+	query := `
+		SELECT
+			b.block_number,
+			to_timestamp(b.block_timestamp)
+		FROM validator_status AS v
+			LEFT JOIN proposer_duties AS p
+			ON p.validator_index = v.validator_index
+			LEFT JOIN block AS b
+			ON b.slot=p.slot
+		WHERE v.status = 'active_ongoing'
+		AND b.slot = p.slot
+		AND b.block_timestamp > $1;
+	`
+	rows, err := c.db.Query(ctx, query, ts.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blocks []ShutterBlock
+	for rows.Next() {
+		var block ShutterBlock
+		err = rows.Scan(&block.Number, &block.Ts)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, rows.Err()
+}
+
+func (c Connection) NextShutterSlot(ctx context.Context) (NextShutterSlot, bool, error) {
+	// This query processes the current Shutter block while simultaneously computing
+	// the next Shutter Slot. The transaction will be sent during the current Shutter
+	// block (the trigger block) for inclusion into the next Shutter Slot, but it will
+	// be tied to the current Shutter block using the identity prefix.
+	query := `
+		WITH current_shutter_block AS (
+			SELECT
+				block_number,
+				slot,
+				to_timestamp(block_timestamp) AS ts
+			FROM block
+			ORDER BY slot DESC
+			LIMIT 1
+		),
+		next_shutter_slot AS (
+			SELECT
+				pd.validator_index,
+				pd.slot AS next_slot
+			FROM proposer_duties pd
+			JOIN validator_status vs
+				ON vs.validator_index = pd.validator_index
+			WHERE vs.status = 'active_ongoing'
+			AND pd.slot > (SELECT slot FROM current_shutter_block)
+			ORDER BY pd.slot ASC
+			LIMIT 1
+		)
+		SELECT
+			ns.next_slot,
+			ns.validator_index,
+			vg.graffiti,
+			cb.block_number,
+			cb.ts
+		FROM next_shutter_slot ns
+		JOIN validator_graffiti vg
+			ON vg.validator_index = ns.validator_index
+		JOIN current_shutter_block cb ON TRUE;
+	`
+	var next NextShutterSlot
+	err := c.db.QueryRow(ctx, query).Scan(
+		&next.Slot,
+		&next.ValidatorIndex,
+		&next.Graffiti,
+		&next.BlockNumber,
+		&next.Ts,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return next, false, nil
 	}
-	log.Println("creating new DB connection")
-	ctx := context.Background()
-	cn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", cfg.DbUser, cfg.DbPass, cfg.DbAddr, cfg.DbName)
-	db, err := pgxpool.New(ctx, cn)
 	if err != nil {
-		panic("db connection failed")
+		return next, false, err
+	}
+	return next, true, nil
+}
+
+func (c Connection) ShutterBlockNumbers(ctx context.Context, start, end uint64) ([]int64, error) {
+	query := `
+		SELECT
+			b.block_number
+		FROM block AS b
+			LEFT JOIN proposer_duties AS p
+			ON p.slot = b.slot
+			LEFT JOIN validator_status AS s
+			ON p.validator_index = s.validator_index
+		WHERE b.block_number >= $1
+		AND b.block_number <= $2
+		AND s.status = 'active_ongoing';
+		`
+	rows, err := c.db.Query(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blocks []int64
+	for rows.Next() {
+		var block int64
+		err = rows.Scan(&block)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, rows.Err()
+}
+
+func (c Connection) NextShutterProposer(ctx context.Context, blockNumber int64) (BlockProposer, bool, error) {
+	query := `
+	SELECT
+		b.block_number,
+		b.slot,
+		v.validator_index,
+		to_timestamp(b.block_timestamp),
+		p.public_key
+	FROM block AS b
+		LEFT JOIN proposer_duties AS p ON p.slot = b.slot
+		LEFT JOIN validator_status AS v ON v.validator_index = p.validator_index
+	WHERE v.status = 'active_ongoing'
+	AND b.block_number > $1
+	ORDER BY b.block_number ASC
+	LIMIT 1;`
+	var proposer BlockProposer
+	err := c.db.QueryRow(ctx, query, blockNumber).Scan(
+		&proposer.BlockNumber,
+		&proposer.Slot,
+		&proposer.ValidatorIndex,
+		&proposer.Ts,
+		&proposer.PublicKey,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return proposer, false, nil
+	}
+	if err != nil {
+		return proposer, false, err
+	}
+	return proposer, true, nil
+}
+
+func (c Connection) DecryptionKeysBySlot(ctx context.Context, slot int64) ([]DecryptionKeyRecord, error) {
+	query := `
+		SELECT
+			k.identity_preimage,
+			d.tx_pointer,
+			d.eon,
+			d.created_at,
+			t.tx_hash
+        FROM decryption_keys_message_decryption_key AS dkmdk
+                LEFT JOIN decryption_key AS k
+                ON dkmdk.decryption_key_id=k.id
+                LEFT JOIN decryption_keys_message AS d
+                ON d.slot=dkmdk.decryption_keys_message_slot
+				LEFT JOIN decrypted_tx AS t
+				ON t.decryption_key_id=k.id
+        WHERE dkmdk.decryption_keys_message_slot=$1;`
+	rows, err := c.db.Query(ctx, query, slot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []DecryptionKeyRecord
+	for rows.Next() {
+		var key DecryptionKeyRecord
+		err = rows.Scan(&key.IdentityPreimage, &key.TxPointer, &key.Eon, &key.CreatedTs, &key.TxHash)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c Connection) DecryptionKeySlots(ctx context.Context, identityPreimage []byte) ([]int64, error) {
+	query := `
+	SELECT decryption_keys_message_slot
+	FROM decryption_key AS k
+		LEFT JOIN decryption_keys_message_decryption_key AS dkmdk
+			ON k.id=dkmdk.decryption_key_id
+	WHERE k.identity_preimage=decode($1, 'hex')
+	`
+	rows, err := c.db.Query(ctx, query, hex.EncodeToString(identityPreimage))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var slots []int64
+	for rows.Next() {
+		var slot *int64
+		err = rows.Scan(&slot)
+		if err != nil {
+			return slots, err
+		}
+		if slot != nil {
+			slots = append(slots, *slot)
+		}
+	}
+	return slots, rows.Err()
+}
+
+func (c Connection) ValidatorInfoForBlock(ctx context.Context, blockNumber int64) (ValidatorInfo, error) {
+	query := `
+		SELECT
+			p.validator_index,
+			COALESCE(vg.graffiti, '') AS graffiti
+		FROM block AS b
+			LEFT JOIN proposer_duties AS p ON p.slot = b.slot
+			LEFT JOIN validator_graffiti AS vg ON vg.validator_index = p.validator_index
+		WHERE b.block_number = $1
+		LIMIT 1;`
+	var info ValidatorInfo
+	err := c.db.QueryRow(ctx, query, blockNumber).Scan(&info.ValidatorIndex, &info.Graffiti)
+	return info, err
+}
+
+func (c Connection) DecryptedTxStatuses(ctx context.Context, sender common.Address, start, end uint64) ([]DecryptedTxStatus, error) {
+	query := `
+	SELECT
+        dt.tx_hash,
+        dt.tx_status,
+        dt.slot AS inclusion_slot,
+        b_sequenced.slot AS sequenced_slot
+        FROM decryption_key AS dk
+                LEFT JOIN decrypted_tx AS dt
+                        ON dt.decryption_key_id=dk.id
+                LEFT JOIN block AS b
+                        ON b.slot=dt.slot
+                LEFT JOIN transaction_submitted_event AS tse
+                        ON tse.id=dt.transaction_submitted_event_id
+                LEFT JOIN block AS b_sequenced
+                        ON b_sequenced.block_number=tse.event_block_number
+	WHERE
+        SUBSTRING(
+                ENCODE(dk.identity_preimage, 'hex'),  --- encode preimage as hex string
+                65  --- match only sender suffix of identity_preimage
+        ) = $1  --- address of tester account
+	AND
+        b.block_number BETWEEN $2 AND $3;`
+	rows, err := c.db.Query(ctx, query, strings.ToLower(sender.Hex())[2:], start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var statuses []DecryptedTxStatus
+	for rows.Next() {
+		var txHash []byte
+		var status DecryptedTxStatus
+		err = rows.Scan(&txHash, &status.Status, &status.InclusionSlot, &status.SequencedSlot)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		status.TxHash = common.BytesToHash(txHash)
+		statuses = append(statuses, status)
 	}
-	connection := Connection{db: db}
-	cfg.Connection = connection
-	return connection
+	return statuses, rows.Err()
 }
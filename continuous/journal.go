@@ -0,0 +1,382 @@
+package continuous
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+// JournalFileName returns the default name of the journal of mode. Every mode has its own
+// journal, so that a restart only resumes the transactions of its mode.
+func JournalFileName(mode string) string {
+	return fmt.Sprintf("continuous-%v.journal", mode)
+}
+
+// txTimeout is the time a ShutterTx is watched after it was signed.
+const txTimeout = time.Minute * 20
+
+// Journal is an append-only file, that receives a JournalEntry for every lifecycle
+// transition of a ShutterTx. It allows to resume watching the transactions in flight
+// after a restart and keeps the targeted slots available for the reports.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// JournalEntry is a snapshot of a ShutterTx. The transactions are identified by their
+// trigger block.
+type JournalEntry struct {
+	Time            time.Time      `json:"time"`
+	TriggerBlock    int64          `json:"triggerBlock"`
+	Status          string         `json:"status"`
+	Sender          common.Address `json:"sender"`
+	SignedAt        time.Time      `json:"signedAt"`
+	InnerTx         hexutil.Bytes  `json:"innerTx,omitempty"`
+	OuterTx         hexutil.Bytes  `json:"outerTx,omitempty"`
+	SubmissionBlock int64          `json:"submissionBlock,omitempty"`
+	InclusionBlock  int64          `json:"inclusionBlock,omitempty"`
+	CancelBlock     int64          `json:"cancelBlock,omitempty"`
+	TargetSlot      int64          `json:"targetSlot,omitempty"`
+	Latency         time.Duration  `json:"latency,omitempty"`
+	Transitions     []Transition   `json:"transitions,omitempty"`
+}
+
+// OpenJournal opens the journal at path for appending and returns the entries, that
+// were already written to it. Lines, that can not be parsed, e.g. because the process
+// was killed while writing them, are skipped.
+func OpenJournal(path string) (*Journal, []JournalEntry, error) {
+	entries, err := readJournal(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create journal folder: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open journal %v: %w", path, err)
+	}
+	err = terminateLastLine(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("could not open journal %v: %w", path, err)
+	}
+	return &Journal{file: file}, entries, nil
+}
+
+// terminateLastLine ends a partially written last line, so that it does not swallow the
+// next entry.
+func terminateLastLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	_, err = file.ReadAt(last, info.Size()-1)
+	if err != nil || last[0] == '\n' {
+		return err
+	}
+	_, err = file.Write([]byte{'\n'})
+	return err
+}
+
+func readJournal(path string) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read journal %v: %w", path, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			log.Printf("skipping journal line %v: %v\n", line, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read journal %v: %w", path, err)
+	}
+	return entries, nil
+}
+
+// ReadJournal returns the latest state of every transaction in the journal at path,
+// without opening it for appending.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	entries, err := readJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	return mergeJournalEntries(entries), nil
+}
+
+// Record appends the current state of tx to the journal.
+func (j *Journal) Record(tx *ShutterTx) error {
+	entry, err := newJournalEntry(tx)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.file.Write(append(line, '\n'))
+	return err
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+func newJournalEntry(tx *ShutterTx) (JournalEntry, error) {
+	state := tx.state()
+	entry := JournalEntry{
+		Time:            time.Now(),
+		TriggerBlock:    tx.triggerBlock,
+		Status:          state.status.String(),
+		SignedAt:        tx.signedAt,
+		SubmissionBlock: state.submissionBlock,
+		InclusionBlock:  state.inclusionBlock,
+		CancelBlock:     state.cancelBlock,
+		TargetSlot:      tx.targetSlot,
+		Latency:         tx.latency,
+		Transitions:     state.transitions,
+	}
+	if tx.sender != nil {
+		entry.Sender = tx.sender.Address
+	}
+	var err error
+	if tx.innerTx != nil {
+		entry.InnerTx, err = tx.innerTx.MarshalBinary()
+		if err != nil {
+			return entry, err
+		}
+	}
+	if tx.outerTx != nil {
+		entry.OuterTx, err = tx.outerTx.MarshalBinary()
+		if err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// mergeJournalEntries combines all entries of a trigger block into one, in the order
+// of the first entry of each trigger block. Later entries overwrite the status and all
+// fields, that are set in them.
+func mergeJournalEntries(entries []JournalEntry) []JournalEntry {
+	var merged []JournalEntry
+	index := make(map[int64]int)
+	for _, entry := range entries {
+		i, ok := index[entry.TriggerBlock]
+		if !ok {
+			index[entry.TriggerBlock] = len(merged)
+			merged = append(merged, entry)
+			continue
+		}
+		m := &merged[i]
+		m.Time = entry.Time
+		m.Status = entry.Status
+		if entry.Sender != (common.Address{}) {
+			m.Sender = entry.Sender
+		}
+		if !entry.SignedAt.IsZero() {
+			m.SignedAt = entry.SignedAt
+		}
+		if len(entry.InnerTx) > 0 {
+			m.InnerTx = entry.InnerTx
+		}
+		if len(entry.OuterTx) > 0 {
+			m.OuterTx = entry.OuterTx
+		}
+		if entry.SubmissionBlock != 0 {
+			m.SubmissionBlock = entry.SubmissionBlock
+		}
+		if entry.InclusionBlock != 0 {
+			m.InclusionBlock = entry.InclusionBlock
+		}
+		if entry.CancelBlock != 0 {
+			m.CancelBlock = entry.CancelBlock
+		}
+		if entry.TargetSlot != 0 {
+			m.TargetSlot = entry.TargetSlot
+		}
+		if entry.Latency != 0 {
+			m.Latency = entry.Latency
+		}
+		if len(entry.Transitions) > 0 {
+			m.Transitions = entry.Transitions
+		}
+	}
+	return merged
+}
+
+func parseTxStatus(s string) (TxStatus, error) {
+	for ts := Signed; ts <= SystemFailure; ts++ {
+		if ts.String() == s {
+			return ts, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tx status %v", s)
+}
+
+func unmarshalTx(data hexutil.Bytes) (*types.Transaction, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	tx := new(types.Transaction)
+	err := tx.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (cfg *Configuration) accountByAddress(address common.Address) *utils.Account {
+	if cfg.submitAccount.Address == address {
+		return &cfg.submitAccount
+	}
+	for i := range cfg.accounts {
+		if cfg.accounts[i].Address == address {
+			return &cfg.accounts[i]
+		}
+	}
+	return nil
+}
+
+// restoreFromJournal recreates the ShutterTx of every trigger block in entries. Signed
+// and sequenced transactions, whose sender is known, are put in flight and can be watched
+// again with ResumeWatchers. Their inner nonces are reserved, so that new transactions do
+// not reuse them. The other signed and sequenced transactions fail. All other transactions
+// are done.
+func (cfg *Configuration) restoreFromJournal(entries []JournalEntry) error {
+	cfg.status.statusModMutex.Lock()
+	defer cfg.status.statusModMutex.Unlock()
+	for _, entry := range mergeJournalEntries(entries) {
+		tx, err := cfg.journaledTx(entry)
+		if err != nil {
+			return err
+		}
+		status := tx.txStatus
+		resumable := (status == Signed || status == Sequenced) &&
+			tx.innerTx != nil && tx.outerTx != nil && tx.sender.Sign != nil
+		if !resumable {
+			if status == Signed || status == Sequenced {
+				err = tx.transition(SystemFailure, 0, "not resumable after restart")
+				if err != nil {
+					return err
+				}
+				tx.record()
+			}
+			cfg.status.txDone = append(cfg.status.txDone, tx)
+			continue
+		}
+		// the node does not know the encrypted inner transaction
+		tx.sender.ReserveNonce(tx.innerTx.Nonce())
+		tx.ctx, tx.cancel = context.WithDeadline(context.Background(), entry.SignedAt.Add(txTimeout))
+		cfg.status.txInFlight = append(cfg.status.txInFlight, tx)
+	}
+	log.Printf("restored %v tx in flight and %v done from journal\n", len(cfg.status.txInFlight), len(cfg.status.txDone))
+	return nil
+}
+
+// loadJournal adds the transactions in entries to the done ones with their journaled
+// status, for the reports of a read-only configuration. Nothing is resumed or journaled.
+func (cfg *Configuration) loadJournal(entries []JournalEntry) error {
+	cfg.status.statusModMutex.Lock()
+	defer cfg.status.statusModMutex.Unlock()
+	for _, entry := range mergeJournalEntries(entries) {
+		tx, err := cfg.journaledTx(entry)
+		if err != nil {
+			return err
+		}
+		cfg.status.txDone = append(cfg.status.txDone, tx)
+	}
+	log.Printf("loaded %v tx from journal\n", len(cfg.status.txDone))
+	return nil
+}
+
+// journaledTx recreates the ShutterTx of a merged journal entry.
+func (cfg *Configuration) journaledTx(entry JournalEntry) (*ShutterTx, error) {
+	status, err := parseTxStatus(entry.Status)
+	if err != nil {
+		return nil, fmt.Errorf("journal entry for trigger %v: %w", entry.TriggerBlock, err)
+	}
+	innerTx, err := unmarshalTx(entry.InnerTx)
+	if err != nil {
+		return nil, fmt.Errorf("journal entry for trigger %v: %w", entry.TriggerBlock, err)
+	}
+	outerTx, err := unmarshalTx(entry.OuterTx)
+	if err != nil {
+		return nil, fmt.Errorf("journal entry for trigger %v: %w", entry.TriggerBlock, err)
+	}
+	sender := cfg.accountByAddress(entry.Sender)
+	if sender == nil {
+		sender = &utils.Account{Address: entry.Sender}
+	}
+	tx := &ShutterTx{
+		innerTx:         innerTx,
+		outerTx:         outerTx,
+		sender:          sender,
+		prefix:          utils.PrefixFromBlockNumber(entry.TriggerBlock),
+		triggerBlock:    entry.TriggerBlock,
+		submissionBlock: entry.SubmissionBlock,
+		inclusionBlock:  entry.InclusionBlock,
+		cancelBlock:     entry.CancelBlock,
+		targetSlot:      entry.TargetSlot,
+		signedAt:        entry.SignedAt,
+		latency:         entry.Latency,
+		txStatus:        status,
+		transitions:     entry.Transitions,
+		journal:         cfg.journal,
+	}
+	if len(tx.transitions) == 0 {
+		tx.transitions = []Transition{{Status: status, Time: entry.Time, Reason: "restored from journal"}}
+	}
+	return tx, nil
+}
+
+// ResumeWatchers starts watching the transactions in flight, that were restored from the journal.
+func ResumeWatchers(cfg *Configuration) {
+	cfg.status.statusModMutex.Lock()
+	defer cfg.status.statusModMutex.Unlock()
+	for _, tx := range cfg.status.txInFlight {
+		if tx.watched {
+			continue
+		}
+		tx.watched = true
+		tx.metrics = cfg.Metrics
+		tx.metrics.resumed()
+		log.Printf("resuming watcher for trigger %v (%v)\n", tx.triggerBlock, tx.Status())
+		cfg.status.watch(tx, cfg.client, cfg.Helpers)
+	}
+}
@@ -0,0 +1,200 @@
+package continuous
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"gotest.tools/assert"
+)
+
+func createTestAccount(t *testing.T) utils.Account {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	assert.NilError(t, err)
+	account, err := utils.AccountFromPrivateKey(key, types.LatestSignerForChainID(big.NewInt(1337)))
+	assert.NilError(t, err)
+	return account
+}
+
+func signedTestTx(t *testing.T, account utils.Account, nonce uint64) *types.Transaction {
+	t.Helper()
+	tx, err := account.Sign(account.Address, types.NewTx(&types.LegacyTx{Nonce: nonce, To: &account.Address, Gas: 21000}))
+	assert.NilError(t, err)
+	return tx
+}
+
+func TestJournalRestore(t *testing.T) {
+	journalFile := path.Join(t.TempDir(), "blame", JournalFileName("standard"))
+	journal, entries, err := OpenJournal(journalFile)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+	cfg := createTestConfig(nil)
+	cfg.accounts = []utils.Account{createTestAccount(t)}
+	cfg.journal = journal
+	account := cfg.accounts[0]
+	signedAt := time.Now().Add(-time.Minute).Round(time.Second)
+
+	inFlight := &ShutterTx{
+		innerTx:      signedTestTx(t, account, 0),
+		outerTx:      signedTestTx(t, account, 1),
+		sender:       &account,
+		triggerBlock: 100,
+		targetSlot:   12,
+		signedAt:     signedAt,
+		journal:      journal,
+	}
+	assert.NilError(t, inFlight.transition(Signed, 100, "submitted"))
+	inFlight.record()
+	assert.NilError(t, inFlight.transition(Sequenced, 101, "submission mined"))
+	inFlight.record()
+
+	done := &ShutterTx{
+		innerTx:      signedTestTx(t, account, 2),
+		outerTx:      signedTestTx(t, account, 3),
+		sender:       &account,
+		triggerBlock: 102,
+		targetSlot:   14,
+		signedAt:     signedAt,
+		journal:      journal,
+	}
+	assert.NilError(t, done.transition(Signed, 102, "submitted"))
+	done.record()
+	assert.NilError(t, done.transition(Sequenced, 103, "submission mined"))
+	assert.NilError(t, done.transition(Included, 104, "included"))
+	done.record()
+
+	// the sender of this transaction is not known anymore, so it can not be resumed
+	unknown := &ShutterTx{
+		innerTx:      signedTestTx(t, account, 4),
+		outerTx:      signedTestTx(t, account, 5),
+		sender:       &utils.Account{Address: common.HexToAddress("0xbb")},
+		triggerBlock: 105,
+		signedAt:     signedAt,
+		journal:      journal,
+	}
+	assert.NilError(t, unknown.transition(Signed, 105, "submitted"))
+	unknown.record()
+	assert.NilError(t, journal.Close())
+
+	// a partially written line is skipped
+	file, err := os.OpenFile(journalFile, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NilError(t, err)
+	_, err = file.WriteString(`{"triggerBlock":106,"sta`)
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+
+	journal, entries, err = OpenJournal(journalFile)
+	assert.NilError(t, err)
+	defer journal.Close()
+	assert.Equal(t, len(entries), 5)
+	restored := createTestConfig(nil)
+	backend := simulated.NewBackend(types.GenesisAlloc{})
+	defer backend.Close()
+	account.Nonces = utils.NewNonceManager(backend.Client())
+	restored.accounts = []utils.Account{account}
+	restored.journal = journal
+	assert.NilError(t, restored.restoreFromJournal(entries))
+
+	assert.Equal(t, len(restored.status.txInFlight), 1)
+	tx := restored.status.txInFlight[0]
+	assert.Equal(t, tx.triggerBlock, int64(100))
+	assert.Equal(t, tx.Status(), Sequenced)
+	assert.Equal(t, tx.submissionBlock, int64(101))
+	history := tx.History()
+	assert.Equal(t, len(history), 2)
+	assert.Equal(t, history[0].Status, Signed)
+	assert.Equal(t, history[1].Block, int64(101))
+	assert.Equal(t, tx.sender, &restored.accounts[0])
+	assert.Equal(t, tx.innerTx.Hash(), inFlight.innerTx.Hash())
+	assert.Equal(t, tx.outerTx.Hash(), inFlight.outerTx.Hash())
+	assert.Equal(t, tx.prefix, utils.PrefixFromBlockNumber(100))
+	deadline, ok := tx.ctx.Deadline()
+	assert.Assert(t, ok)
+	assert.Assert(t, deadline.Equal(signedAt.Add(txTimeout)))
+	tx.cancel()
+	// new transactions do not reuse the inner nonce of the restored one
+	nonce, err := restored.accounts[0].NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, inFlight.innerTx.Nonce()+1)
+
+	assert.Equal(t, len(restored.status.txDone), 2)
+	assert.Equal(t, restored.status.txDone[0].Status(), Included)
+	assert.Equal(t, len(restored.status.txDone[0].History()), 3)
+	assert.Equal(t, restored.status.txDone[0].inclusionBlock, int64(104))
+	failed := restored.status.txDone[1]
+	assert.Equal(t, failed.triggerBlock, int64(105))
+	assert.Equal(t, failed.Status(), SystemFailure)
+	history = failed.History()
+	assert.Equal(t, history[len(history)-1].Reason, "not resumable after restart")
+	// the failure is journaled
+	assert.NilError(t, journal.Close())
+	entries, err = ReadJournal(journalFile)
+	assert.NilError(t, err)
+	merged := mergeJournalEntries(entries)
+	assert.Equal(t, merged[len(merged)-1].TriggerBlock, int64(105))
+	assert.Equal(t, merged[len(merged)-1].Status, "SystemFailure")
+
+	targetSlots := buildInnerTxHashToTargetSlotMap(restored)
+	assert.DeepEqual(t, targetSlots, map[string]int64{
+		inFlight.innerTx.Hash().Hex(): 12,
+		done.innerTx.Hash().Hex():     14,
+	})
+}
+
+func TestJournalLoad(t *testing.T) {
+	journalFile := path.Join(t.TempDir(), JournalFileName("graffiti"))
+	journal, _, err := OpenJournal(journalFile)
+	assert.NilError(t, err)
+	account := createTestAccount(t)
+	inFlight := &ShutterTx{
+		innerTx:      signedTestTx(t, account, 0),
+		outerTx:      signedTestTx(t, account, 1),
+		sender:       &account,
+		triggerBlock: 100,
+		targetSlot:   12,
+		journal:      journal,
+	}
+	assert.NilError(t, inFlight.transition(Signed, 100, "submitted"))
+	inFlight.record()
+	assert.NilError(t, journal.Close())
+	before, err := os.ReadFile(journalFile)
+	assert.NilError(t, err)
+
+	entries, err := ReadJournal(journalFile)
+	assert.NilError(t, err)
+	cfg := createTestConfig(nil)
+	assert.NilError(t, cfg.loadJournal(entries))
+	assert.Equal(t, len(cfg.status.txInFlight), 0)
+	assert.Equal(t, len(cfg.status.txDone), 1)
+	assert.Equal(t, cfg.status.txDone[0].Status(), Signed, "the status is not changed")
+	assert.DeepEqual(t, buildInnerTxHashToTargetSlotMap(cfg), map[string]int64{inFlight.innerTx.Hash().Hex(): 12})
+	after, err := os.ReadFile(journalFile)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, after, before)
+}
+
+func TestMergeJournalEntries(t *testing.T) {
+	merged := mergeJournalEntries([]JournalEntry{
+		{TriggerBlock: 1, Status: "Signed", TargetSlot: 5},
+		{TriggerBlock: 2, Status: "Signed"},
+		{TriggerBlock: 1, Status: "Sequenced", SubmissionBlock: 2},
+		{TriggerBlock: 1, Status: "NotIncluded", CancelBlock: 4},
+	})
+	assert.Equal(t, len(merged), 2)
+	assert.Equal(t, merged[0].Status, "NotIncluded")
+	assert.Equal(t, merged[0].TargetSlot, int64(5))
+	assert.Equal(t, merged[0].SubmissionBlock, int64(2))
+	assert.Equal(t, merged[0].CancelBlock, int64(4))
+	assert.Equal(t, merged[1].TriggerBlock, int64(2))
+
+	_, err := parseTxStatus("Unknown")
+	assert.ErrorContains(t, err, "unknown tx status")
+}
@@ -0,0 +1,292 @@
+package continuous
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgtype"
+)
+
+// MemoryObserver is an ObserverStore, that keeps the relevant parts of the observer
+// tables in memory. It is used as fixture to test continuous mode and the collector
+// without an observer database.
+type MemoryObserver struct {
+	mu             sync.RWMutex
+	blocks         []ObservedBlock
+	duties         map[int64]ProposerDuty
+	validators     map[int64]ObservedValidator
+	decryptionKeys []ObservedDecryptionKey
+	decryptedTxs   []ObservedDecryptedTx
+}
+
+var _ ObserverStore = &MemoryObserver{}
+
+type ObservedBlock struct {
+	Number    int64
+	Slot      int64
+	Timestamp int64
+}
+
+type ProposerDuty struct {
+	Slot           int64
+	ValidatorIndex int64
+	PublicKey      string
+}
+
+type ObservedValidator struct {
+	Index int64
+	// validators with status 'active_ongoing' are shutter validators
+	Active   bool
+	Graffiti string
+}
+
+type ObservedDecryptionKey struct {
+	// slot of the decryption keys message
+	Slot int64
+	DecryptionKeyRecord
+}
+
+type ObservedDecryptedTx struct {
+	IdentityPreimage []byte
+	TxHash           common.Hash
+	Status           string
+	InclusionSlot    *int64
+	// block, in which the transaction was submitted to the sequencer
+	SequencedBlock int64
+}
+
+func NewMemoryObserver() *MemoryObserver {
+	return &MemoryObserver{
+		duties:     make(map[int64]ProposerDuty),
+		validators: make(map[int64]ObservedValidator),
+	}
+}
+
+func (m *MemoryObserver) AddBlock(block ObservedBlock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocks = append(m.blocks, block)
+}
+
+func (m *MemoryObserver) AddProposerDuty(duty ProposerDuty) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.duties[duty.Slot] = duty
+}
+
+func (m *MemoryObserver) AddValidator(validator ObservedValidator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validators[validator.Index] = validator
+}
+
+func (m *MemoryObserver) AddDecryptionKey(key ObservedDecryptionKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decryptionKeys = append(m.decryptionKeys, key)
+}
+
+func (m *MemoryObserver) AddDecryptedTx(tx ObservedDecryptedTx) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decryptedTxs = append(m.decryptedTxs, tx)
+}
+
+func (m *MemoryObserver) isShutterSlot(slot int64) bool {
+	duty, ok := m.duties[slot]
+	if !ok {
+		return false
+	}
+	return m.validators[duty.ValidatorIndex].Active
+}
+
+func (m *MemoryObserver) blockByNumber(number int64) (ObservedBlock, bool) {
+	for _, block := range m.blocks {
+		if block.Number == number {
+			return block, true
+		}
+	}
+	return ObservedBlock{}, false
+}
+
+func (m *MemoryObserver) blockBySlot(slot int64) (ObservedBlock, bool) {
+	for _, block := range m.blocks {
+		if block.Slot == slot {
+			return block, true
+		}
+	}
+	return ObservedBlock{}, false
+}
+
+func (b ObservedBlock) ts() pgtype.Date {
+	return pgtype.Date{Time: time.Unix(b.Timestamp, 0), Status: pgtype.Present}
+}
+
+func (m *MemoryObserver) LatestShutterBlock(ctx context.Context) (ShutterBlock, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var latest ShutterBlock
+	found := false
+	for _, block := range m.blocks {
+		if m.isShutterSlot(block.Slot) && (!found || block.Number > latest.Number) {
+			latest = ShutterBlock{Number: block.Number, Ts: block.ts()}
+			found = true
+		}
+	}
+	return latest, found, nil
+}
+
+func (m *MemoryObserver) ShutterBlocksAfter(ctx context.Context, ts time.Time) ([]ShutterBlock, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var blocks []ShutterBlock
+	for _, block := range m.blocks {
+		if m.isShutterSlot(block.Slot) && block.Timestamp > ts.Unix() {
+			blocks = append(blocks, ShutterBlock{Number: block.Number, Ts: block.ts()})
+		}
+	}
+	return blocks, nil
+}
+
+func (m *MemoryObserver) NextShutterSlot(ctx context.Context) (NextShutterSlot, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.blocks) == 0 {
+		return NextShutterSlot{}, false, nil
+	}
+	current := m.blocks[0]
+	for _, block := range m.blocks {
+		if block.Slot > current.Slot {
+			current = block
+		}
+	}
+	var next *ProposerDuty
+	for _, duty := range m.duties {
+		if duty.Slot > current.Slot && m.validators[duty.ValidatorIndex].Active && (next == nil || duty.Slot < next.Slot) {
+			d := duty
+			next = &d
+		}
+	}
+	if next == nil {
+		return NextShutterSlot{}, false, nil
+	}
+	graffiti := m.validators[next.ValidatorIndex].Graffiti
+	if graffiti == "" {
+		return NextShutterSlot{}, false, nil
+	}
+	return NextShutterSlot{
+		Slot:           next.Slot,
+		ValidatorIndex: next.ValidatorIndex,
+		Graffiti:       graffiti,
+		BlockNumber:    current.Number,
+		Ts:             current.ts(),
+	}, true, nil
+}
+
+func (m *MemoryObserver) ShutterBlockNumbers(ctx context.Context, start, end uint64) ([]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var numbers []int64
+	for _, block := range m.blocks {
+		if block.Number >= int64(start) && block.Number <= int64(end) && m.isShutterSlot(block.Slot) {
+			numbers = append(numbers, block.Number)
+		}
+	}
+	return numbers, nil
+}
+
+func (m *MemoryObserver) NextShutterProposer(ctx context.Context, blockNumber int64) (BlockProposer, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var next *ObservedBlock
+	for i, block := range m.blocks {
+		if block.Number > blockNumber && m.isShutterSlot(block.Slot) && (next == nil || block.Number < next.Number) {
+			next = &m.blocks[i]
+		}
+	}
+	if next == nil {
+		return BlockProposer{}, false, nil
+	}
+	duty := m.duties[next.Slot]
+	return BlockProposer{
+		BlockNumber:    next.Number,
+		Slot:           next.Slot,
+		ValidatorIndex: duty.ValidatorIndex,
+		Ts:             next.ts(),
+		PublicKey:      duty.PublicKey,
+	}, true, nil
+}
+
+func (m *MemoryObserver) DecryptionKeysBySlot(ctx context.Context, slot int64) ([]DecryptionKeyRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []DecryptionKeyRecord
+	for _, key := range m.decryptionKeys {
+		if key.Slot == slot {
+			keys = append(keys, key.DecryptionKeyRecord)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MemoryObserver) DecryptionKeySlots(ctx context.Context, identityPreimage []byte) ([]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var slots []int64
+	for _, key := range m.decryptionKeys {
+		if bytes.Equal(key.IdentityPreimage, identityPreimage) {
+			slots = append(slots, key.Slot)
+		}
+	}
+	return slots, nil
+}
+
+func (m *MemoryObserver) ValidatorInfoForBlock(ctx context.Context, blockNumber int64) (ValidatorInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	block, ok := m.blockByNumber(blockNumber)
+	if !ok {
+		return ValidatorInfo{}, fmt.Errorf("block %v not found", blockNumber)
+	}
+	duty, ok := m.duties[block.Slot]
+	if !ok {
+		return ValidatorInfo{}, fmt.Errorf("no proposer duty for slot %v", block.Slot)
+	}
+	return ValidatorInfo{
+		ValidatorIndex: duty.ValidatorIndex,
+		Graffiti:       m.validators[duty.ValidatorIndex].Graffiti,
+	}, nil
+}
+
+func (m *MemoryObserver) DecryptedTxStatuses(ctx context.Context, sender common.Address, start, end uint64) ([]DecryptedTxStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var statuses []DecryptedTxStatus
+	for _, tx := range m.decryptedTxs {
+		if len(tx.IdentityPreimage) <= 32 || !bytes.Equal(tx.IdentityPreimage[32:], sender.Bytes()) {
+			continue
+		}
+		if tx.InclusionSlot == nil {
+			continue
+		}
+		block, ok := m.blockBySlot(*tx.InclusionSlot)
+		if !ok || block.Number < int64(start) || block.Number > int64(end) {
+			continue
+		}
+		status := DecryptedTxStatus{
+			TxHash:        tx.TxHash,
+			Status:        tx.Status,
+			InclusionSlot: tx.InclusionSlot,
+		}
+		if sequenced, ok := m.blockByNumber(tx.SequencedBlock); ok {
+			slot := sequenced.Slot
+			status.SequencedSlot = &slot
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,263 @@
+package continuous
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+// metricsRefreshInterval is the time between the updates of the balances and the eon.
+var metricsRefreshInterval = 30 * time.Second
+
+// Metrics are the prometheus metrics of the continuous modes. They are shared by all
+// modes of the process and labelled with the mode.
+type Metrics struct {
+	registry              *prometheus.Registry
+	transactions          *prometheus.CounterVec
+	triggerToSubmission   *prometheus.HistogramVec
+	submissionToInclusion *prometheus.HistogramVec
+	keyDelay              *prometheus.HistogramVec
+	inFlight              *prometheus.GaugeVec
+	balance               *prometheus.GaugeVec
+	eon                   *prometheus.GaugeVec
+	lastShutterBlock      *prometheus.GaugeVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "continuous",
+			Name:      "transactions_total",
+			Help:      "Shutter transactions, that reached a status: sent, sequenced, included, not_sequenced, not_included or system_failure.",
+		}, []string{"mode", "status"}),
+		triggerToSubmission: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "continuous",
+			Name:      "trigger_to_submission_blocks",
+			Help:      "Blocks from the trigger block to the block, in which the submission to the sequencer was mined.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		}, []string{"mode"}),
+		submissionToInclusion: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "continuous",
+			Name:      "submission_to_inclusion_blocks",
+			Help:      "Blocks from the submission to the sequencer to the inclusion of the decrypted transaction.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		}, []string{"mode"}),
+		keyDelay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "continuous",
+			Name:      "key_release_delay_seconds",
+			Help:      "Time from the targeted shutter block to the first sighting of the decryption key of a test transaction.",
+			Buckets:   []float64{-1, 0, 0.5, 1, 2, 3, 4, 6, 8, 12},
+		}, []string{"mode"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "continuous",
+			Name:      "transactions_in_flight",
+			Help:      "Shutter transactions, that did not reach a final status yet.",
+		}, []string{"mode"}),
+		balance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "continuous",
+			Name:      "account_balance_wei",
+			Help:      "Balance of the submit account and the funded test accounts.",
+		}, []string{"account"}),
+		eon: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "continuous",
+			Name:      "current_eon",
+			Help:      "Eon of the keyper set active at the latest block.",
+		}, []string{"mode"}),
+		lastShutterBlock: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "continuous",
+			Name:      "last_shutter_block",
+			Help:      "Number of the last detected shutterized block.",
+		}, []string{"mode"}),
+	}
+	m.registry.MustRegister(
+		m.transactions,
+		m.triggerToSubmission,
+		m.submissionToInclusion,
+		m.keyDelay,
+		m.inFlight,
+		m.balance,
+		m.eon,
+		m.lastShutterBlock,
+	)
+	return m
+}
+
+// Handler serves the metrics in the prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Mode returns the metrics of mode, nil if m is nil.
+func (m *Metrics) Mode(mode string) *ModeMetrics {
+	if m == nil {
+		return nil
+	}
+	labels := prometheus.Labels{"mode": mode}
+	return &ModeMetrics{
+		transactions:          m.transactions.MustCurryWith(labels),
+		triggerToSubmission:   m.triggerToSubmission.With(labels),
+		submissionToInclusion: m.submissionToInclusion.With(labels),
+		keyDelay:              m.keyDelay.With(labels),
+		inFlight:              m.inFlight.With(labels),
+		balance:               m.balance,
+		eon:                   m.eon.With(labels),
+		lastShutterBlock:      m.lastShutterBlock.With(labels),
+	}
+}
+
+// ModeMetrics are the metrics of one continuous mode. All methods do nothing on a nil
+// ModeMetrics, so that the metrics are optional.
+type ModeMetrics struct {
+	transactions          *prometheus.CounterVec
+	triggerToSubmission   prometheus.Observer
+	submissionToInclusion prometheus.Observer
+	keyDelay              prometheus.Observer
+	inFlight              prometheus.Gauge
+	balance               *prometheus.GaugeVec
+	eon                   prometheus.Gauge
+	lastShutterBlock      prometheus.Gauge
+
+	mu sync.Mutex
+	// the last slot, of which the key delays were observed
+	keyDelaySlot int64
+}
+
+var transactionStatusLabels = map[TxStatus]string{
+	Signed:        "sent",
+	Sequenced:     "sequenced",
+	Included:      "included",
+	NotSequenced:  "not_sequenced",
+	NotIncluded:   "not_included",
+	SystemFailure: "system_failure",
+}
+
+// transition counts a transition of a transaction for trigger to status in block.
+// submission is the block, in which the transaction was sequenced.
+func (m *ModeMetrics) transition(status TxStatus, trigger, submission, block int64) {
+	if m == nil {
+		return
+	}
+	m.transactions.WithLabelValues(transactionStatusLabels[status]).Inc()
+	switch status {
+	case Signed:
+		m.inFlight.Inc()
+	case Sequenced:
+		m.triggerToSubmission.Observe(float64(block - trigger))
+	case Included:
+		m.submissionToInclusion.Observe(float64(block - submission))
+	}
+	switch status {
+	case Included, NotSequenced, NotIncluded, SystemFailure:
+		m.inFlight.Dec()
+	}
+}
+
+// resumed counts a transaction restored from the journal as in flight.
+func (m *ModeMetrics) resumed() {
+	if m == nil {
+		return
+	}
+	m.inFlight.Inc()
+}
+
+func (m *ModeMetrics) shutterBlock(number int64) {
+	if m == nil {
+		return
+	}
+	m.lastShutterBlock.Set(float64(number))
+}
+
+// observeKeyDelays observes the key delays of the slots after the last observed one.
+// Slots are scored again by every collect run, but their delays are only observed once.
+func (m *ModeMetrics) observeKeyDelays(scores []SlotScore) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, score := range scores {
+		if score.Slot <= m.keyDelaySlot || len(score.KeyDelaysMs) == 0 {
+			continue
+		}
+		for _, delay := range score.KeyDelaysMs {
+			m.keyDelay.Observe(float64(delay) / 1000)
+		}
+		m.keyDelaySlot = score.Slot
+	}
+}
+
+func (m *ModeMetrics) setBalance(account common.Address, balance *big.Int) {
+	if m == nil {
+		return
+	}
+	value, _ := new(big.Float).SetInt(balance).Float64()
+	m.balance.WithLabelValues(account.Hex()).Set(value)
+}
+
+func (m *ModeMetrics) setEon(eon uint64) {
+	if m == nil {
+		return
+	}
+	m.eon.Set(float64(eon))
+}
+
+// currentEon returns the last eon of history, that is active at block.
+func currentEon(history []utils.Eon, block uint64) (utils.Eon, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].ActivationBlock <= block {
+			return history[i], true
+		}
+	}
+	return utils.Eon{}, false
+}
+
+// RunMetrics updates the balances of the accounts and the current eon in cfg.Metrics
+// until ctx is done.
+func RunMetrics(ctx context.Context, cfg *Configuration) {
+	if cfg.Metrics == nil {
+		return
+	}
+	ticker := time.NewTicker(metricsRefreshInterval)
+	defer ticker.Stop()
+	for {
+		refreshMetrics(ctx, cfg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func refreshMetrics(ctx context.Context, cfg *Configuration) {
+	accounts := append([]utils.Account{cfg.submitAccount}, cfg.accounts...)
+	for _, account := range accounts {
+		balance, err := cfg.client.BalanceAt(ctx, account.Address, nil)
+		if err != nil {
+			log.Println("could not query balance for the metrics:", err)
+			return
+		}
+		cfg.Metrics.setBalance(account.Address, balance)
+	}
+	if cfg.eonKeys == nil {
+		return
+	}
+	block, err := cfg.client.BlockNumber(ctx)
+	if err != nil {
+		log.Println("could not query block number for the metrics:", err)
+		return
+	}
+	if eon, ok := currentEon(cfg.eonKeys.History(), block); ok {
+		cfg.Metrics.setEon(eon.Index)
+	}
+}
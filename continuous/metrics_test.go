@@ -0,0 +1,87 @@
+package continuous
+
+import (
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/shutter-network/nethermind-tests/utils"
+	"gotest.tools/assert"
+)
+
+// scrape returns the metrics served by a new server.
+func scrape(t *testing.T, metrics *Metrics) string {
+	t.Helper()
+	server, err := Serve("127.0.0.1:0", metrics.Handler())
+	assert.NilError(t, err)
+	defer server.Close()
+	res, err := http.Get("http://" + server.Addr + "/metrics")
+	assert.NilError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	body, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	return string(body)
+}
+
+func TestMetricsTransitions(t *testing.T) {
+	metrics := NewMetrics()
+	mode := metrics.Mode("standard")
+	included := &ShutterTx{triggerBlock: 100, metrics: mode}
+	assert.NilError(t, included.transition(Signed, 100, "submitted"))
+	assert.NilError(t, included.transition(Sequenced, 101, "submission mined"))
+	assert.NilError(t, included.transition(Included, 104, "included"))
+	failed := &ShutterTx{triggerBlock: 105, metrics: mode}
+	assert.NilError(t, failed.transition(Signed, 105, "submitted"))
+	assert.NilError(t, failed.transition(SystemFailure, 0, "timeout"))
+	pending := &ShutterTx{triggerBlock: 106, metrics: mode}
+	assert.NilError(t, pending.transition(Signed, 106, "submitted"))
+	mode.shutterBlock(106)
+	mode.setEon(3)
+	mode.setBalance(testSender, big.NewInt(5))
+	mode.observeKeyDelays([]SlotScore{{Slot: 10, KeyDelaysMs: []int64{500, 1500}}})
+	// slots, that were already observed, are skipped
+	mode.observeKeyDelays([]SlotScore{{Slot: 10, KeyDelaysMs: []int64{500, 1500}}, {Slot: 12}})
+
+	body := scrape(t, metrics)
+	for _, expected := range []string{
+		`continuous_transactions_total{mode="standard",status="sent"} 3`,
+		`continuous_transactions_total{mode="standard",status="sequenced"} 1`,
+		`continuous_transactions_total{mode="standard",status="included"} 1`,
+		`continuous_transactions_total{mode="standard",status="system_failure"} 1`,
+		`continuous_transactions_in_flight{mode="standard"} 1`,
+		`continuous_trigger_to_submission_blocks_sum{mode="standard"} 1`,
+		`continuous_submission_to_inclusion_blocks_sum{mode="standard"} 3`,
+		`continuous_key_release_delay_seconds_count{mode="standard"} 2`,
+		`continuous_key_release_delay_seconds_sum{mode="standard"} 2`,
+		`continuous_last_shutter_block{mode="standard"} 106`,
+		`continuous_current_eon{mode="standard"} 3`,
+		`continuous_account_balance_wei{account="` + testSender.Hex() + `"} 5`,
+	} {
+		assert.Assert(t, strings.Contains(body, expected), "%v not in\n%v", expected, body)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	var metrics *Metrics
+	mode := metrics.Mode("standard")
+	assert.Assert(t, mode == nil)
+	tx := &ShutterTx{triggerBlock: 100, metrics: mode}
+	assert.NilError(t, tx.transition(Signed, 100, "submitted"))
+	mode.shutterBlock(100)
+	mode.observeKeyDelays([]SlotScore{{Slot: 10, KeyDelaysMs: []int64{500}}})
+}
+
+func TestCurrentEon(t *testing.T) {
+	history := []utils.Eon{{Index: 0, ActivationBlock: 10}, {Index: 1, ActivationBlock: 20}}
+	_, ok := currentEon(history, 5)
+	assert.Assert(t, !ok)
+	eon, ok := currentEon(history, 19)
+	assert.Assert(t, ok)
+	assert.Equal(t, eon.Index, uint64(0))
+	eon, ok = currentEon(history, 20)
+	assert.Assert(t, ok)
+	assert.Equal(t, eon.Index, uint64(1))
+}
@@ -0,0 +1,76 @@
+package continuous
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgtype"
+)
+
+// ObserverStore gives access to the data collected by the shutter observer. Continuous
+// mode uses it to detect shutterized blocks, the collector to blame validators and to
+// compute the status ratios of the test transactions.
+type ObserverStore interface {
+	ShutterBlockSource
+	// NextShutterSlot returns the next slot with a shutter validator after the current head.
+	NextShutterSlot(ctx context.Context) (NextShutterSlot, bool, error)
+	// ShutterBlockNumbers returns the numbers of all blocks in [start, end], that were proposed by shutter validators.
+	ShutterBlockNumbers(ctx context.Context, start, end uint64) ([]int64, error)
+	// NextShutterProposer returns the first block after blockNumber, that was proposed by a shutter validator.
+	NextShutterProposer(ctx context.Context, blockNumber int64) (BlockProposer, bool, error)
+	// DecryptionKeysBySlot returns the decryption keys released for slot.
+	DecryptionKeysBySlot(ctx context.Context, slot int64) ([]DecryptionKeyRecord, error)
+	// DecryptionKeySlots returns the slots, in which a key for identityPreimage was released.
+	DecryptionKeySlots(ctx context.Context, identityPreimage []byte) ([]int64, error)
+	// ValidatorInfoForBlock returns the proposer of blockNumber.
+	ValidatorInfoForBlock(ctx context.Context, blockNumber int64) (ValidatorInfo, error)
+	// DecryptedTxStatuses returns the observed status of the transactions decrypted for
+	// sender, that were included in [start, end].
+	DecryptedTxStatuses(ctx context.Context, sender common.Address, start, end uint64) ([]DecryptedTxStatus, error)
+}
+
+type NextShutterSlot struct {
+	Slot           int64
+	ValidatorIndex int64
+	Graffiti       string
+	// the current head, that triggers the transaction for Slot
+	BlockNumber int64
+	Ts          pgtype.Date
+}
+
+type BlockProposer struct {
+	BlockNumber    int64
+	Slot           int64
+	ValidatorIndex int64
+	Ts             pgtype.Date
+	PublicKey      string
+}
+
+type DecryptionKeyRecord struct {
+	IdentityPreimage []byte
+	TxPointer        int
+	Eon              int
+	CreatedTs        pgtype.Date
+	// hash of the decrypted transaction, empty if none was observed
+	TxHash []byte
+}
+
+type ValidatorInfo struct {
+	ValidatorIndex int64
+	Graffiti       string
+}
+
+// tx_status values of the decrypted_tx table
+const (
+	observedShieldedInclusion   = "shielded inclusion"
+	observedUnshieldedInclusion = "unshielded inclusion"
+	observedNotIncluded         = "not included"
+	observedPending             = "pending"
+)
+
+type DecryptedTxStatus struct {
+	TxHash        common.Hash
+	Status        string
+	InclusionSlot *int64
+	SequencedSlot *int64
+}
@@ -0,0 +1,288 @@
+package continuous
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgtype"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"gotest.tools/assert"
+)
+
+var testSender = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+// createObserverFixture returns an observer with the shutter validator 1 proposing
+// slots 10, 12 and 14 and the non shutter validator 2 proposing slots 11 and 13.
+// Blocks 100 to 103 were proposed in slots 10 to 13, twelve seconds apart.
+func createObserverFixture() *MemoryObserver {
+	observer := NewMemoryObserver()
+	observer.AddValidator(ObservedValidator{Index: 1, Active: true, Graffiti: "shutter"})
+	observer.AddValidator(ObservedValidator{Index: 2, Active: false, Graffiti: "other"})
+	for slot := int64(10); slot <= 14; slot++ {
+		validator := int64(2)
+		if slot%2 == 0 {
+			validator = 1
+		}
+		observer.AddProposerDuty(ProposerDuty{Slot: slot, ValidatorIndex: validator, PublicKey: "0x01"})
+	}
+	for i := int64(0); i < 4; i++ {
+		observer.AddBlock(ObservedBlock{Number: 100 + i, Slot: 10 + i, Timestamp: 1000 + 12*i})
+	}
+	return observer
+}
+
+func identityPreimage(trigger int64, sender common.Address) []byte {
+	prefix := utils.PrefixFromBlockNumber(trigger)
+	return append(prefix[:], sender.Bytes()...)
+}
+
+func date(ts int64) pgtype.Date {
+	return pgtype.Date{Time: time.Unix(ts, 0), Status: pgtype.Present}
+}
+
+func TestShutterBlockTracker(t *testing.T) {
+	observer := createObserverFixture()
+	tracker := shutterBlockTracker{}
+
+	blocks, err := tracker.next(context.Background(), observer, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(blocks), 2)
+	assert.Equal(t, blocks[0].Number, int64(100))
+	assert.Equal(t, blocks[1].Number, int64(102))
+	assert.Equal(t, blocks[1].Ts.Time.Unix(), int64(1024))
+
+	blocks, err = tracker.next(context.Background(), observer, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(blocks), 0)
+
+	// a burst of shutter blocks is returned in order
+	observer.AddProposerDuty(ProposerDuty{Slot: 16, ValidatorIndex: 1, PublicKey: "0x01"})
+	observer.AddBlock(ObservedBlock{Number: 105, Slot: 16, Timestamp: 1072})
+	observer.AddBlock(ObservedBlock{Number: 104, Slot: 14, Timestamp: 1048})
+	blocks, err = tracker.next(context.Background(), observer, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(blocks), 2)
+	assert.Equal(t, blocks[0].Number, int64(104))
+	assert.Equal(t, blocks[1].Number, int64(105))
+}
+
+func TestQueryGraffitiNextShutterBlock(t *testing.T) {
+	cfg := createTestConfig(createObserverFixture())
+
+	block := queryGraffitiNextShutterBlock(0, cfg)
+	assert.Assert(t, block.Ts.Time.IsZero(), "graffiti is not in the graffiti set")
+
+	cfg.GraffitiSet["shutter"] = true
+	block = queryGraffitiNextShutterBlock(0, cfg)
+	assert.Equal(t, block.Number, int64(103))
+	assert.Equal(t, block.TargetedSlot, int64(14))
+
+	block = queryGraffitiNextShutterBlock(14, cfg)
+	assert.Assert(t, block.Ts.Time.IsZero(), "slot was already targeted")
+}
+
+func TestQueryBlockTriggers(t *testing.T) {
+	cfg := createTestConfig(createObserverFixture())
+
+	triggers, err := queryBlockTriggers(100, 103, cfg)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, triggers, []int64{100, 102})
+}
+
+func TestBlameValidator(t *testing.T) {
+	observer := createObserverFixture()
+	decryptedTxHash := common.HexToHash("0x1234")
+	observer.AddDecryptionKey(ObservedDecryptionKey{
+		Slot: 12,
+		DecryptionKeyRecord: DecryptionKeyRecord{
+			IdentityPreimage: identityPreimage(100, testSender),
+			TxPointer:        3,
+			Eon:              1,
+			CreatedTs:        date(1025),
+			TxHash:           decryptedTxHash.Bytes(),
+		},
+	})
+	observer.AddDecryptionKey(ObservedDecryptionKey{
+		Slot: 12,
+		DecryptionKeyRecord: DecryptionKeyRecord{
+			IdentityPreimage: identityPreimage(100, common.HexToAddress("0xbb")),
+			CreatedTs:        date(1025),
+		},
+	})
+	cfg := createTestConfig(observer)
+
+	blame, err := blameValidator(Submission{trigger: 100, sequenced: 101}, cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, blame.targetBlock, int64(102))
+	assert.Equal(t, blame.targetSlot, int64(12))
+	assert.Equal(t, blame.validatorIndex, int64(1))
+	assert.Equal(t, blame.targetBlockTS.Time.Unix(), int64(1024))
+	assert.Equal(t, blame.decryptedTxHash, decryptedTxHash)
+	assert.Equal(t, blame.decryptionKey.txPointer, 3)
+	assert.Equal(t, blame.decryptionKey.createdTs.Time.Unix(), int64(1025))
+
+	blame, err = blameValidator(Submission{trigger: 102, sequenced: 103}, cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, blame.targetBlock, int64(0), "no shutter block after the submission")
+	assert.Assert(t, blame.decryptionKey.identityPreimage == nil)
+}
+
+// statusRatiosText returns the status ratios of the block range in the text layout.
+func statusRatiosText(t *testing.T, startBlock, endBlock uint64, cfg *Configuration) *bytes.Buffer {
+	t.Helper()
+	report := Report{StartBlock: startBlock, EndBlock: endBlock}
+	var err error
+	report.Status, report.GraffitiMode, err = queryStatusRatios(startBlock, endBlock, cfg)
+	assert.NilError(t, err)
+	var out bytes.Buffer
+	assert.NilError(t, writeStatusRatios(&out, report))
+	return &out
+}
+
+func TestQueryStatusRatios(t *testing.T) {
+	observer := createObserverFixture()
+	slot := func(s int64) *int64 { return &s }
+	statuses := []string{observedShieldedInclusion, observedShieldedInclusion, observedUnshieldedInclusion, observedPending}
+	for i, status := range statuses {
+		observer.AddDecryptedTx(ObservedDecryptedTx{
+			IdentityPreimage: identityPreimage(int64(100+i), testSender),
+			TxHash:           common.BigToHash(big.NewInt(int64(i + 1))),
+			Status:           status,
+			InclusionSlot:    slot(12),
+			SequencedBlock:   101,
+		})
+	}
+	// other senders and transactions outside of the block range are ignored
+	observer.AddDecryptedTx(ObservedDecryptedTx{
+		IdentityPreimage: identityPreimage(100, common.HexToAddress("0xbb")),
+		Status:           observedNotIncluded,
+		InclusionSlot:    slot(12),
+	})
+	observer.AddDecryptedTx(ObservedDecryptedTx{
+		IdentityPreimage: identityPreimage(100, testSender),
+		Status:           observedNotIncluded,
+		InclusionSlot:    slot(13),
+	})
+	cfg := createTestConfig(observer)
+
+	out := statusRatiosText(t, 100, 102, cfg)
+	assert.Assert(t, strings.Contains(out.String(), "4 tx found by observer"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "50.00% shielded (2/4)"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "25.00% unshielded (1/4)"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "0.00% not included (0/4)"), out.String())
+	assert.Assert(t, !strings.Contains(out.String(), "targeted slot"), out.String())
+
+	// graffiti mode compares against the slots targeted by the sent transactions
+	cfg.GraffitiSet["shutter"] = true
+	for i := int64(0); i < 2; i++ {
+		innerTx := types.NewTx(&types.LegacyTx{Nonce: uint64(i)})
+		cfg.status.txDone = append(cfg.status.txDone, &ShutterTx{innerTx: innerTx, targetSlot: 12 - i})
+		observer.AddDecryptedTx(ObservedDecryptedTx{
+			IdentityPreimage: identityPreimage(103, testSender),
+			TxHash:           innerTx.Hash(),
+			Status:           observedShieldedInclusion,
+			InclusionSlot:    slot(12),
+			SequencedBlock:   101,
+		})
+	}
+	out = statusRatiosText(t, 100, 102, cfg)
+	assert.Assert(t, strings.Contains(out.String(), "included in targeted slot (shielded) (1/6)"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "invalid for target (late sequencer transaction) (1/6)"), out.String())
+}
+
+func TestQueryStatusRatiosEmpty(t *testing.T) {
+	cfg := createTestConfig(createObserverFixture())
+
+	out := statusRatiosText(t, 100, 103, cfg)
+	assert.Equal(t, out.String(), "No transactions found for status ratios between blocks 100 and 103\n")
+}
+
+func TestEonsInRange(t *testing.T) {
+	history := []utils.Eon{{Index: 0, ActivationBlock: 0}, {Index: 1, ActivationBlock: 100}, {Index: 2, ActivationBlock: 200}}
+	eons := func(start, end uint64) []uint64 {
+		var result []uint64
+		for _, eon := range eonsInRange(history, start, end) {
+			result = append(result, eon.Index)
+		}
+		return result
+	}
+	assert.DeepEqual(t, eons(10, 50), []uint64{0})
+	assert.DeepEqual(t, eons(99, 100), []uint64{0, 1})
+	assert.DeepEqual(t, eons(100, 150), []uint64{1})
+	assert.DeepEqual(t, eons(150, 300), []uint64{1, 2})
+}
+
+// observedHeaders serves the headers of the blocks of a MemoryObserver.
+type observedHeaders struct {
+	observer *MemoryObserver
+}
+
+func (h observedHeaders) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	h.observer.mu.RLock()
+	defer h.observer.mu.RUnlock()
+	head := h.observer.blocks[0]
+	for _, block := range h.observer.blocks {
+		if number != nil && block.Number == number.Int64() {
+			return &types.Header{Number: big.NewInt(block.Number), Time: uint64(block.Timestamp)}, nil
+		}
+		if block.Number > head.Number {
+			head = block
+		}
+	}
+	if number != nil {
+		return nil, fmt.Errorf("unknown block %v", number)
+	}
+	return &types.Header{Number: big.NewInt(head.Number), Time: uint64(head.Timestamp)}, nil
+}
+
+// fixtureSlots returns the slots of the observer fixture, with genesis 120s before slot 10.
+func fixtureSlots(observer *MemoryObserver, genesis time.Time) *utils.SlotService {
+	clock := utils.SlotClock{Genesis: genesis, SlotDuration: 12 * time.Second}
+	return utils.NewSlotService(observedHeaders{observer}, clock)
+}
+
+func TestBlameMissedSlots(t *testing.T) {
+	observer := createObserverFixture()
+	// the shutter validator misses slot 14, the next shutter block is proposed in slot 16
+	observer.AddProposerDuty(ProposerDuty{Slot: 15, ValidatorIndex: 2, PublicKey: "0x01"})
+	observer.AddProposerDuty(ProposerDuty{Slot: 16, ValidatorIndex: 1, PublicKey: "0x01"})
+	observer.AddBlock(ObservedBlock{Number: 104, Slot: 16, Timestamp: 1072})
+	cfg := createTestConfig(observer)
+
+	blame, err := blameValidator(Submission{trigger: 102, sequenced: 103}, cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, blame.targetSlot, int64(16))
+	assert.Assert(t, blame.missedSlots == nil, "slots are unknown without the slot service")
+
+	cfg.slots = fixtureSlots(observer, time.Unix(880, 0))
+	blame, err = blameValidator(Submission{trigger: 102, sequenced: 103}, cfg)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, blame.missedSlots, []int64{14, 15})
+	assert.Assert(t, strings.HasPrefix(blame.String(), "missed slots\t: [14 15]\n"), blame.String())
+
+	blame, err = blameValidator(Submission{trigger: 100, sequenced: 101}, cfg)
+	assert.NilError(t, err)
+	assert.Assert(t, blame.missedSlots == nil)
+}
+
+func TestQueryGraffitiSlotDeadline(t *testing.T) {
+	observer := createObserverFixture()
+	cfg := createTestConfig(observer)
+	cfg.GraffitiSet["shutter"] = true
+
+	// slot 14 started long ago
+	cfg.slots = fixtureSlots(observer, time.Unix(880, 0))
+	block := queryGraffitiNextShutterBlock(0, cfg)
+	assert.Assert(t, block.Ts.Time.IsZero(), "slot 14 already started")
+
+	cfg.slots = fixtureSlots(observer, time.Now())
+	block = queryGraffitiNextShutterBlock(0, cfg)
+	assert.Equal(t, block.TargetedSlot, int64(14))
+}
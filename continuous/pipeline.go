@@ -0,0 +1,205 @@
+package continuous
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"github.com/shutter-network/shutter/shlib/shcrypto"
+)
+
+// Pipeline prepares the next shutterized transaction while waiting for its trigger. The
+// inner transaction carries the trigger block as value, so it is signed and encrypted
+// speculatively for the latest head, which is the most likely next trigger. If the
+// trigger turns out to be a different block, only signing and encryption are repeated.
+type Pipeline struct {
+	mu   sync.Mutex
+	next *preparedTx
+}
+
+// preparedTx holds everything needed to submit a shutterized transaction.
+type preparedTx struct {
+	account    *utils.Account
+	innerNonce uint64
+	gas        utils.GasCalculation
+	submitGas  utils.GasCalculation
+	// the trigger, the transaction was signed and encrypted for
+	trigger       int64
+	signedInnerTx *types.Transaction
+	eon           uint64
+	encrypted     *shcrypto.EncryptedMessage
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// prepareTx allocates the sender and nonce of the next inner transaction.
+func prepareTx(cfg *Configuration) (*preparedTx, error) {
+	account := cfg.NextAccount()
+	innerNonce, err := account.NextNonce()
+	if err != nil {
+		return nil, fmt.Errorf("could not allocate nonce %v", err)
+	}
+	return &preparedTx{account: account, innerNonce: innerNonce}, nil
+}
+
+// updateGas queries the current gas prices for both transactions.
+func (p *preparedTx) updateGas(cfg *Configuration) error {
+	gas, err := utils.GasCalculationFromClient(context.Background(), cfg.client, utils.MinGasTipUpdateFn)
+	if err != nil {
+		return err
+	}
+	submitGas, err := utils.GasCalculationFromClient(context.Background(), cfg.client, utils.HighPriorityGasPriceFn)
+	if err != nil {
+		return err
+	}
+	p.gas = gas
+	p.submitGas = submitGas
+	return nil
+}
+
+// seal signs the inner transaction for trigger and encrypts it for the identity of trigger.
+func (p *preparedTx) seal(trigger int64, cfg *Configuration) error {
+	innerTx := types.NewTx(
+		&types.DynamicFeeTx{
+			ChainID:   cfg.chainID,
+			Nonce:     p.innerNonce,
+			GasFeeCap: p.gas.Fee,
+			GasTipCap: p.gas.Tip,
+			Gas:       uint64(21000),
+			To:        &cfg.submitAccount.Address,
+			Value:     big.NewInt(trigger),
+		},
+	)
+	signedInnerTx, err := p.account.Sign(p.account.Address, innerTx)
+	if err != nil {
+		return err
+	}
+	buff, err := signedInnerTx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	eon, eonKey, err := cfg.eonKeys.EonKeyForBlock(uint64(trigger))
+	if err != nil {
+		return err
+	}
+	sigma, err := shcrypto.RandomSigma(cryptorand.Reader)
+	if err != nil {
+		return fmt.Errorf("could not get random sigma %v", err)
+	}
+	identityPrefix := utils.PrefixFromBlockNumber(trigger)
+	identity := utils.ComputeIdentity(identityPrefix[:], cfg.submitAccount.Address)
+	p.encrypted = shcrypto.Encrypt(buff, eonKey, identity, sigma)
+	p.signedInnerTx = signedInnerTx
+	p.eon = eon
+	p.trigger = trigger
+	return nil
+}
+
+// release gives back the nonce of a prepared transaction, that was not sent.
+func (p *preparedTx) release() {
+	p.account.ReleaseNonce(p.innerNonce)
+}
+
+// Prepare signs and encrypts the next transaction for expectedTrigger with current gas prices.
+// The gas prices are queried without holding the lock, so that take does not wait for
+// them. The result replaces the prepared transaction, unless that was taken meanwhile.
+func (pl *Pipeline) Prepare(expectedTrigger int64, cfg *Configuration) error {
+	pl.mu.Lock()
+	current := pl.next
+	pl.mu.Unlock()
+	var next *preparedTx
+	if current == nil {
+		var err error
+		next, err = prepareTx(cfg)
+		if err != nil {
+			return err
+		}
+	} else {
+		next = &preparedTx{account: current.account, innerNonce: current.innerNonce}
+	}
+	err := next.updateGas(cfg)
+	if err == nil {
+		err = next.seal(expectedTrigger, cfg)
+	}
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	switch {
+	case pl.next != current:
+		// the nonce of current belongs to the one, who took it
+		if current == nil {
+			next.release()
+		}
+	case err == nil || current == nil:
+		// a new allocation is kept, take completes it
+		pl.next = next
+	}
+	return err
+}
+
+// take returns the transaction for trigger. A transaction prepared for a different
+// trigger is signed and encrypted again, without a prepared one everything is done now.
+func (pl *Pipeline) take(trigger int64, cfg *Configuration) (*preparedTx, error) {
+	pl.mu.Lock()
+	next := pl.next
+	pl.next = nil
+	pl.mu.Unlock()
+	if next != nil && next.signedInnerTx != nil && next.trigger == trigger {
+		return next, nil
+	}
+	var err error
+	if next == nil {
+		next, err = prepareTx(cfg)
+		if err != nil {
+			return nil, err
+		}
+	} else if next.signedInnerTx != nil {
+		log.Printf("prepared tx for %v, but trigger is %v\n", next.trigger, trigger)
+	}
+	if next.gas.Fee == nil || next.submitGas.Fee == nil {
+		err = next.updateGas(cfg)
+		if err != nil {
+			next.release()
+			return nil, err
+		}
+	}
+	err = next.seal(trigger, cfg)
+	if err != nil {
+		next.release()
+		return nil, err
+	}
+	return next, nil
+}
+
+// Discard drops the prepared transaction and gives back its nonce.
+func (pl *Pipeline) Discard() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.next != nil {
+		pl.next.release()
+		pl.next = nil
+	}
+}
+
+// RunPipeline prepares the next transaction for every new head until ctx is done.
+func RunPipeline(ctx context.Context, cfg *Configuration) {
+	heads, unsubscribe := utils.HeadsFor(cfg.client).SubscribeHeads()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case head := <-heads:
+			err := cfg.pipeline.Prepare(head.Number.Int64(), cfg)
+			if err != nil {
+				log.Println("could not prepare tx for", head.Number, err)
+			}
+		}
+	}
+}
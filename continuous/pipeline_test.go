@@ -0,0 +1,142 @@
+package continuous
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgtype"
+	"github.com/shutter-network/nethermind-tests/simulator"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"gotest.tools/assert"
+)
+
+// createSimulatedConfig returns a configuration for sending shutterized transactions
+// to the simulator, with a single account for the inner transactions.
+func createSimulatedConfig(t *testing.T) (*simulator.Simulator, *Configuration) {
+	t.Helper()
+	alloc := types.GenesisAlloc{}
+	submitKey, err := simulator.FundedKey(alloc, big.NewInt(1e18))
+	assert.NilError(t, err)
+	innerKey, err := simulator.FundedKey(alloc, big.NewInt(1e18))
+	assert.NilError(t, err)
+	sim, err := simulator.New(alloc)
+	assert.NilError(t, err)
+	t.Cleanup(func() { sim.Close() })
+	client := sim.Client()
+	chainID, err := client.ChainID(context.Background())
+	assert.NilError(t, err)
+	signer := types.LatestSignerForChainID(chainID)
+	nonces := utils.NewNonceManager(client)
+	submitAccount, err := utils.AccountFromPrivateKey(submitKey, signer)
+	assert.NilError(t, err)
+	submitAccount.Nonces = nonces
+	innerAccount, err := utils.AccountFromPrivateKey(innerKey, signer)
+	assert.NilError(t, err)
+	innerAccount.Nonces = nonces
+	eonKeys, err := utils.NewEonKeyService(client, sim.Contracts.KeyperSetManager, sim.Contracts.KeyBroadcastContract, KeyperSetChangeLookAhead)
+	assert.NilError(t, err)
+	t.Cleanup(eonKeys.Close)
+
+	cfg := createTestConfig(nil)
+	cfg.accounts = []utils.Account{innerAccount}
+	cfg.submitAccount = submitAccount
+	cfg.client = client
+	cfg.contracts = sim.Contracts
+	cfg.eonKeys = eonKeys
+	cfg.pipeline = NewPipeline()
+	cfg.chainID = chainID
+	cfg.nonces = nonces
+	t.Cleanup(func() {
+		for _, tx := range cfg.status.txInFlight {
+			tx.cancel()
+		}
+	})
+	return sim, cfg
+}
+
+func waitForIncluded(t *testing.T, sim *simulator.Simulator, tx *ShutterTx) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		sim.Commit()
+		receipt, err := sim.Client().TransactionReceipt(context.Background(), tx.innerTx.Hash())
+		if err == nil {
+			assert.Equal(t, receipt.Status, types.ReceiptStatusSuccessful)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("tx for %v was not included", tx.triggerBlock)
+}
+
+func TestPipelineUsesPreparedTx(t *testing.T) {
+	sim, cfg := createSimulatedConfig(t)
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+	trigger := int64(head)
+
+	assert.NilError(t, cfg.pipeline.Prepare(trigger, cfg))
+	prepared := cfg.pipeline.next.signedInnerTx
+	detectedAt := time.Now()
+	SendShutterizedTX(trigger, pgtype.Date{}, 0, detectedAt, cfg)
+
+	assert.Equal(t, len(cfg.status.txInFlight), 1)
+	tx := cfg.status.txInFlight[0]
+	assert.Equal(t, tx.innerTx.Hash(), prepared.Hash())
+	assert.Equal(t, tx.innerTx.Value().Int64(), trigger)
+	assert.Assert(t, tx.latency > 0 && tx.latency <= time.Since(detectedAt))
+	assert.Assert(t, cfg.pipeline.next == nil, "the prepared tx was used")
+	waitForIncluded(t, sim, tx)
+}
+
+func TestPipelineResealsForOtherTrigger(t *testing.T) {
+	sim, cfg := createSimulatedConfig(t)
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+	trigger := int64(head)
+
+	assert.NilError(t, cfg.pipeline.Prepare(trigger-1, cfg))
+	preparedNonce := cfg.pipeline.next.innerNonce
+	SendShutterizedTX(trigger, pgtype.Date{}, 0, time.Now(), cfg)
+
+	assert.Equal(t, len(cfg.status.txInFlight), 1)
+	tx := cfg.status.txInFlight[0]
+	assert.Equal(t, tx.innerTx.Value().Int64(), trigger)
+	assert.Equal(t, tx.innerTx.Nonce(), preparedNonce)
+	waitForIncluded(t, sim, tx)
+
+	// without a prepared tx, everything is done when the trigger is found
+	SendShutterizedTX(trigger+1, pgtype.Date{}, 0, time.Now(), cfg)
+	assert.Equal(t, len(cfg.status.txInFlight), 2)
+	tx = cfg.status.txInFlight[1]
+	assert.Equal(t, tx.innerTx.Value().Int64(), trigger+1)
+	assert.Equal(t, tx.innerTx.Nonce(), preparedNonce+1)
+	waitForIncluded(t, sim, tx)
+}
+
+func TestPipelinePrepareWhileTaking(t *testing.T) {
+	_, cfg := createSimulatedConfig(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			_ = cfg.pipeline.Prepare(100, cfg)
+		}
+	}()
+	// every taken transaction has its own nonce, also when it was prepared concurrently
+	nonces := make(map[uint64]bool)
+	for i := 0; i < 20; i++ {
+		prepared, err := cfg.pipeline.take(100, cfg)
+		assert.NilError(t, err)
+		assert.Assert(t, !nonces[prepared.innerNonce], "nonce %v taken twice", prepared.innerNonce)
+		nonces[prepared.innerNonce] = true
+		cfg.status.AddTxInFlight(&ShutterTx{triggerBlock: 100, cancel: func() {}})
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,157 @@
+package continuous
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/shutter-network/contracts/v2/bindings/validatorregistry"
+	rsvalidatorregistry "github.com/shutter-network/rolling-shutter/rolling-shutter/medley/validatorregistry"
+	blst "github.com/supranational/blst/bindings/go"
+)
+
+const (
+	// the version of the registration messages, that the keypers accept
+	registrationMessageVersion = 0
+	// the number of blocks, of which the registry events are read at once
+	maxRegistryBlockRange = 100000
+)
+
+// ValidatorRegistry follows the updates of the validator registry contract, by which the
+// shutter validators register and deregister. As the signature of an update can only be
+// checked with the public key of the validator, the updates are kept and evaluated, when
+// the validator is looked up with the key from its proposer duty.
+type ValidatorRegistry struct {
+	address  common.Address
+	chainID  uint64
+	contract *validatorregistry.ValidatorregistryFilterer
+
+	mu          sync.Mutex
+	syncedUntil uint64
+	updates     map[uint64][]registryUpdate
+	// registration status by validator index, computed from the first count updates
+	registered map[uint64]registrationStatus
+}
+
+type registryUpdate struct {
+	message   rsvalidatorregistry.RegistrationMessage
+	signature []byte
+}
+
+type registrationStatus struct {
+	pubkey     string
+	count      int
+	registered bool
+}
+
+// NewValidatorRegistry reads the registry at address on the chain of filterer, starting
+// with the events of startBlock.
+func NewValidatorRegistry(filterer bind.ContractFilterer, address common.Address, chainID uint64, startBlock uint64) (*ValidatorRegistry, error) {
+	contract, err := validatorregistry.NewValidatorregistryFilterer(address, filterer)
+	if err != nil {
+		return nil, err
+	}
+	syncedUntil := uint64(0)
+	if startBlock > 0 {
+		syncedUntil = startBlock - 1
+	}
+	return &ValidatorRegistry{
+		address:     address,
+		chainID:     chainID,
+		contract:    contract,
+		syncedUntil: syncedUntil,
+		updates:     make(map[uint64][]registryUpdate),
+		registered:  make(map[uint64]registrationStatus),
+	}, nil
+}
+
+// Sync reads the updates of the blocks up to head, that were not read before.
+func (r *ValidatorRegistry) Sync(ctx context.Context, head uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.syncedUntil < head {
+		start := r.syncedUntil + 1
+		end := min(head, r.syncedUntil+maxRegistryBlockRange)
+		it, err := r.contract.FilterUpdated(&bind.FilterOpts{Start: start, End: &end, Context: ctx})
+		if err != nil {
+			return fmt.Errorf("could not read the validator registry: %w", err)
+		}
+		for it.Next() {
+			r.add(it.Event.Message, it.Event.Signature)
+		}
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return fmt.Errorf("could not read the validator registry: %w", err)
+		}
+		r.syncedUntil = end
+	}
+	return nil
+}
+
+// add keeps the update, if its message is meant for this registry.
+func (r *ValidatorRegistry) add(message, signature []byte) {
+	update := registryUpdate{signature: signature}
+	err := update.message.Unmarshal(message)
+	if err != nil {
+		return
+	}
+	if update.message.Version != registrationMessageVersion ||
+		update.message.ChainID != r.chainID ||
+		update.message.ValidatorRegistryAddress != r.address {
+		return
+	}
+	index := update.message.ValidatorIndex
+	r.updates[index] = append(r.updates[index], update)
+}
+
+// IsRegistered returns true, if the last valid update of the validator with index and the
+// hex encoded public key pubkey registered it. An update is valid, if it is signed by the
+// validator and its nonce is higher than the one of the previous valid update.
+func (r *ValidatorRegistry) IsRegistered(index uint64, pubkey string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	updates := r.updates[index]
+	status, ok := r.registered[index]
+	if ok && status.pubkey == pubkey && status.count == len(updates) {
+		return status.registered
+	}
+	status = registrationStatus{pubkey: pubkey, count: len(updates)}
+	key, err := parsePublicKey(pubkey)
+	if err == nil {
+		var nonce *uint64
+		for _, update := range updates {
+			if nonce != nil && update.message.Nonce <= *nonce {
+				continue
+			}
+			signature := new(blst.P2Affine).Uncompress(update.signature)
+			if signature == nil || !rsvalidatorregistry.VerifySignature(signature, key, &update.message) {
+				continue
+			}
+			n := update.message.Nonce
+			nonce = &n
+			status.registered = update.message.IsRegistration
+		}
+	}
+	r.registered[index] = status
+	return status.registered
+}
+
+func parsePublicKey(pubkey string) (*blst.P1Affine, error) {
+	if !strings.HasPrefix(pubkey, "0x") {
+		pubkey = "0x" + pubkey
+	}
+	data, err := hexutil.Decode(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	key := new(blst.P1Affine).Uncompress(data)
+	if key == nil {
+		return nil, fmt.Errorf("invalid public key %v", pubkey)
+	}
+	return key, nil
+}
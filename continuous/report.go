@@ -0,0 +1,427 @@
+package continuous
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ReportFormats are the formats, in which a Report can be written.
+var ReportFormats = []string{"text", "json", "csv"}
+
+// reportTimeLayout formats the timestamps of the text report.
+const reportTimeLayout = "2006-01-02 15:04:05.000000"
+
+// Report is the result of the continuous tests in a block range.
+type Report struct {
+	StartBlock uint64 `json:"startBlock"`
+	EndBlock   uint64 `json:"endBlock"`
+	// number of test transactions sequenced in the range
+	Transactions int `json:"transactions"`
+	// number of shutterized blocks in the range
+	Triggers       int          `json:"triggers"`
+	ShutterizedPct float64      `json:"shutterizedPct"`
+	Failed         int          `json:"failed"`
+	FailPct        float64      `json:"failPct"`
+	MissedTriggers []int64      `json:"missedTriggers"`
+	Status         StatusRatios `json:"status"`
+	// the targeted slot ratios are only computed in graffiti mode
+	GraffitiMode bool `json:"graffitiMode"`
+	// nil, if no transaction was included
+	Delay     *DelayStats     `json:"delay"`
+	Successes []SuccessReport `json:"successes"`
+	Blames    []BlameReport   `json:"blames"`
+	Eons      []EonReport     `json:"eons"`
+}
+
+// DelayStats are the blocks between sequencing and inclusion of the test transactions.
+type DelayStats struct {
+	Max    float64 `json:"max"`
+	Min    float64 `json:"min"`
+	Avg    float64 `json:"avg"`
+	Median float64 `json:"median"`
+}
+
+type SuccessReport struct {
+	TriggerBlock   int64       `json:"triggerBlock"`
+	IncludedBlock  int64       `json:"includedBlock"`
+	ValidatorIndex int64       `json:"validatorIndex"`
+	Graffiti       string      `json:"graffiti"`
+	TxHash         common.Hash `json:"txHash"`
+}
+
+// BlameReport names the validator, that should have included a failed test transaction.
+type BlameReport struct {
+	ValidatorIndex        int64          `json:"validatorIndex"`
+	PublicKey             string         `json:"publicKey"`
+	WithdrawalCredentials common.Address `json:"withdrawalCredentials"`
+	TriggerBlock          int64          `json:"triggerBlock"`
+	SubmitBlock           int64          `json:"submitBlock"`
+	TargetBlock           int64          `json:"targetBlock"`
+	TargetSlot            int64          `json:"targetSlot"`
+	// nil, if no target block was found
+	TargetTime *time.Time `json:"targetTime"`
+	// slots between the submission and the target, that have no block
+	MissedSlots    []int64        `json:"missedSlots"`
+	IdentityPrefix hexutil.Bytes  `json:"identityPrefix"`
+	Sender         common.Address `json:"sender"`
+	// nil, if no decryption key was seen
+	DecryptionKey *DecryptionKeyReport `json:"decryptionKey"`
+	// nil, if no decrypted transaction was observed
+	DecryptedTx *common.Hash `json:"decryptedTx"`
+}
+
+type DecryptionKeyReport struct {
+	FirstSeen time.Time `json:"firstSeen"`
+	// milliseconds from the target block to the key, nil without target block
+	DelayMs          *int64        `json:"delayMs"`
+	Eon              int           `json:"eon"`
+	TxPointer        int           `json:"txPointer"`
+	IdentityPreimage hexutil.Bytes `json:"identityPreimage"`
+}
+
+type EonReport struct {
+	Index           uint64         `json:"index"`
+	KeyperSet       common.Address `json:"keyperSet"`
+	ActivationBlock uint64         `json:"activationBlock"`
+	KeyBroadcast    bool           `json:"keyBroadcast"`
+}
+
+func (s Success) report() SuccessReport {
+	return SuccessReport{
+		TriggerBlock:   s.trigger,
+		IncludedBlock:  s.included,
+		ValidatorIndex: s.validatorIndex,
+		Graffiti:       s.graffiti,
+		TxHash:         s.decryptedTxHash,
+	}
+}
+
+func (b ValidatorBlame) report() BlameReport {
+	r := BlameReport{
+		ValidatorIndex:        b.validatorIndex,
+		PublicKey:             b.proposerPublicKey,
+		WithdrawalCredentials: b.credentials,
+		TriggerBlock:          b.triggerBlock,
+		SubmitBlock:           b.submitBlock,
+		TargetBlock:           b.targetBlock,
+		TargetSlot:            b.targetSlot,
+		MissedSlots:           b.missedSlots,
+		IdentityPrefix:        b.prefix,
+		Sender:                b.sender,
+	}
+	if b.targetBlockTS != nil {
+		ts := b.targetBlockTS.Time.UTC()
+		r.TargetTime = &ts
+	}
+	if b.decryptionKey.identityPreimage != nil {
+		key := &DecryptionKeyReport{
+			Eon:              b.decryptionKey.eon,
+			TxPointer:        b.decryptionKey.txPointer,
+			IdentityPreimage: b.decryptionKey.identityPreimage,
+		}
+		if b.decryptionKey.createdTs != nil {
+			key.FirstSeen = b.decryptionKey.createdTs.Time.UTC()
+			if r.TargetTime != nil {
+				delay := key.FirstSeen.UnixMilli() - r.TargetTime.UnixMilli()
+				key.DelayMs = &delay
+			}
+		}
+		r.DecryptionKey = key
+	}
+	if b.decryptedTxHash != (common.Hash{}) {
+		hash := b.decryptedTxHash
+		r.DecryptedTx = &hash
+	}
+	return r
+}
+
+func (b ValidatorBlame) String() string {
+	return b.report().String()
+}
+
+func formatReportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(reportTimeLayout)
+}
+
+func (b BlameReport) String() string {
+	missed := ""
+	if len(b.MissedSlots) > 0 {
+		missed = fmt.Sprintf("missed slots\t: %v\n", b.MissedSlots)
+	}
+	header := missed + fmt.Sprintf(
+		"validator id\t: %v\n"+
+			"public key:\t %v\n"+
+			"withdrawal:\t %v\n"+
+			"triggered\t: %v\n"+
+			"submitted\t: %v\n"+
+			"target block\t: %v\n"+
+			"target slot\t: %v\n"+
+			"target ts\t: %v\n",
+		b.ValidatorIndex,
+		b.PublicKey,
+		b.WithdrawalCredentials.Hex(),
+		b.TriggerBlock,
+		b.SubmitBlock,
+		b.TargetBlock,
+		b.TargetSlot,
+		formatReportTime(b.TargetTime),
+	)
+	if b.DecryptedTx == nil || b.DecryptionKey == nil {
+		return header + fmt.Sprintf(
+			"NO DECRYPTION KEY SEEN\n"+
+				"identity preimage:\n"+
+				"prefix\t%v\n"+
+				"sender\t%v\n",
+			hex.EncodeToString(b.IdentityPrefix),
+			hex.EncodeToString(b.Sender.Bytes()),
+		)
+	}
+	delay := ""
+	if b.DecryptionKey.DelayMs != nil {
+		delay = fmt.Sprint(*b.DecryptionKey.DelayMs)
+	}
+	return header + fmt.Sprintf(
+		"ts (key-target)\t: %vms\n"+
+			"decrypted tx\t: %v\n"+
+			"decryption key:\n%v\n",
+		delay,
+		b.DecryptedTx.Hex(),
+		b.DecryptionKey,
+	)
+}
+
+func (d DecryptionKeyReport) String() string {
+	preimage := []byte(d.IdentityPreimage)
+	prefix, sender := preimage, []byte{}
+	if len(preimage) >= 32 {
+		prefix, sender = preimage[:32], preimage[32:]
+	}
+	return fmt.Sprintf(
+		"first seen\t: %v\n"+
+			"tx pointer\t: %v\n"+
+			"identity preimage:\n"+
+			"prefix\t%v\n"+
+			"sender\t%v",
+		formatReportTime(&d.FirstSeen),
+		d.TxPointer,
+		hex.EncodeToString(prefix),
+		hex.EncodeToString(sender),
+	)
+}
+
+// WriteReport writes r to out in format, one of ReportFormats.
+func WriteReport(out io.Writer, r Report, format string) error {
+	switch format {
+	case "", "text":
+		return r.writeText(out)
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case "csv":
+		return r.writeCSV(out)
+	default:
+		return fmt.Errorf("unknown report format %v, choose from %v", format, ReportFormats)
+	}
+}
+
+// reportFileExtension returns the extension of the report files in format.
+func reportFileExtension(format string) string {
+	switch format {
+	case "json", "csv":
+		return format
+	default:
+		return "blame"
+	}
+}
+
+func writeStatusRatios(w io.Writer, r Report) error {
+	ratios := r.Status
+	if ratios.Count == 0 {
+		_, err := fmt.Fprintf(w, "No transactions found for status ratios between blocks %v and %v\n", r.StartBlock, r.EndBlock)
+		return err
+	}
+
+	outputFormat := `%v tx found by observer
+%3.2f%% shielded (%v/%v)
+%3.2f%% unshielded (%v/%v)
+%3.2f%% not included (%v/%v)
+%3.2f%% still pending (%v/%v)
+`
+
+	count := ratios.Count
+	outputArgs := []interface{}{
+		count,
+		ratios.pct(ratios.Shielded), ratios.Shielded, count,
+		ratios.pct(ratios.Unshielded), ratios.Unshielded, count,
+		ratios.pct(ratios.NotIncluded), ratios.NotIncluded, count,
+		ratios.pct(ratios.Pending), ratios.Pending, count,
+	}
+
+	// Add targeted slot stat and invalid for target stat only in graffiti mode
+	if r.GraffitiMode {
+		outputFormat += `
+%3.2f%% included in targeted slot (shielded) (%v/%v)
+%3.2f%% invalid for target (late sequencer transaction) (%v/%v)`
+		outputArgs = append(outputArgs,
+			ratios.pct(ratios.InTargetedSlot), ratios.InTargetedSlot, count,
+			ratios.pct(ratios.InvalidForTarget), ratios.InvalidForTarget, count,
+		)
+	}
+
+	_, err := fmt.Fprintf(w, outputFormat+"\n", outputArgs...)
+	return err
+}
+
+// writeText writes the human readable layout of the blame files.
+func (r Report) writeText(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	_, err := fmt.Fprintf(w, "found %v shutter test tx in block range[%v:%v] (%v triggers)\n", r.Transactions, r.StartBlock, r.EndBlock, r.Triggers)
+	if err != nil {
+		return err
+	}
+	err = writeStatusRatios(w, r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "shutterized blocks %3.2f%%\n", r.ShutterizedPct)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "fails %v (%3.2f%%)\n", r.Failed, r.FailPct)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "missed triggers %v: %v\n", len(r.MissedTriggers), r.MissedTriggers)
+	if err != nil {
+		return err
+	}
+	if r.Delay != nil {
+		_, err = fmt.Fprintf(w, "delay max %0.0f min %0.0f avg %3.2f median %3.2f\n", r.Delay.Max, r.Delay.Min, r.Delay.Avg, r.Delay.Median)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "=== Information about successful transaction inclusions ===\n")
+	if err != nil {
+		return err
+	}
+	for _, s := range r.Successes {
+		_, err = fmt.Fprintf(w, "{%v %v %v %v %v}\n", s.TriggerBlock, s.IncludedBlock, s.ValidatorIndex, s.Graffiti, s.TxHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "=== Information about failed blames ===\n")
+	if err != nil {
+		return err
+	}
+	for _, blame := range r.Blames {
+		_, err = fmt.Fprintln(w, blame)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Eons != nil {
+		_, err = fmt.Fprintf(w, "=== Eons active in block range ===\n")
+		if err != nil {
+			return err
+		}
+		for _, eon := range r.Eons {
+			_, err = fmt.Fprintf(w, "eon %v keyper set %v activation block %v key broadcast %v\n", eon.Index, eon.KeyperSet.Hex(), eon.ActivationBlock, eon.KeyBroadcast)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// reportCSVHeader are the columns of the csv report. It has a row for every included,
+// blamed and missing transaction, the columns, that do not apply to a record, are empty.
+var reportCSVHeader = []string{
+	"record", "trigger_block", "submit_block", "block", "slot", "validator_index", "graffiti", "public_key",
+	"withdrawal_credentials", "block_time", "missed_slots", "key_first_seen", "key_delay_ms", "eon", "tx_pointer",
+	"tx_hash",
+}
+
+func (r Report) writeCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	err := w.Write(reportCSVHeader)
+	if err != nil {
+		return err
+	}
+	row := func(record string, trigger int64) []string {
+		values := make([]string, len(reportCSVHeader))
+		values[0] = record
+		values[1] = strconv.FormatInt(trigger, 10)
+		return values
+	}
+	for _, s := range r.Successes {
+		values := row("success", s.TriggerBlock)
+		values[3] = strconv.FormatInt(s.IncludedBlock, 10)
+		values[5] = strconv.FormatInt(s.ValidatorIndex, 10)
+		values[6] = s.Graffiti
+		values[15] = s.TxHash.Hex()
+		err = w.Write(values)
+		if err != nil {
+			return err
+		}
+	}
+	for _, b := range r.Blames {
+		values := row("blame", b.TriggerBlock)
+		values[2] = strconv.FormatInt(b.SubmitBlock, 10)
+		values[3] = strconv.FormatInt(b.TargetBlock, 10)
+		values[4] = strconv.FormatInt(b.TargetSlot, 10)
+		values[5] = strconv.FormatInt(b.ValidatorIndex, 10)
+		values[7] = b.PublicKey
+		values[8] = b.WithdrawalCredentials.Hex()
+		if b.TargetTime != nil {
+			values[9] = b.TargetTime.Format(time.RFC3339Nano)
+		}
+		missed := make([]string, len(b.MissedSlots))
+		for i, slot := range b.MissedSlots {
+			missed[i] = strconv.FormatInt(slot, 10)
+		}
+		values[10] = strings.Join(missed, " ")
+		if b.DecryptionKey != nil {
+			values[11] = b.DecryptionKey.FirstSeen.Format(time.RFC3339Nano)
+			if b.DecryptionKey.DelayMs != nil {
+				values[12] = strconv.FormatInt(*b.DecryptionKey.DelayMs, 10)
+			}
+			values[13] = strconv.Itoa(b.DecryptionKey.Eon)
+			values[14] = strconv.Itoa(b.DecryptionKey.TxPointer)
+		}
+		if b.DecryptedTx != nil {
+			values[15] = b.DecryptedTx.Hex()
+		}
+		err = w.Write(values)
+		if err != nil {
+			return err
+		}
+	}
+	for _, trigger := range r.MissedTriggers {
+		err = w.Write(row("missed_trigger", trigger))
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
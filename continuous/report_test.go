@@ -0,0 +1,119 @@
+package continuous
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gotest.tools/assert"
+)
+
+func createReportFixture() Report {
+	created := date(1025)
+	target := date(1024)
+	failed := ValidatorBlame{
+		prefix:            identityPreimage(100, testSender)[:32],
+		triggerBlock:      100,
+		submitBlock:       101,
+		targetBlock:       102,
+		targetBlockTS:     &target,
+		targetSlot:        12,
+		missedSlots:       []int64{11},
+		decryptedTxHash:   common.HexToHash("0xaa"),
+		validatorIndex:    1,
+		sender:            testSender,
+		proposerPublicKey: "0x01",
+		decryptionKey: DecryptionKey{
+			identityPreimage: identityPreimage(100, testSender),
+			txPointer:        3,
+			eon:              2,
+			createdTs:        &created,
+		},
+	}
+	unseen := ValidatorBlame{prefix: identityPreimage(103, testSender)[:32], triggerBlock: 103, submitBlock: 104, sender: testSender}
+	return Report{
+		StartBlock:     100,
+		EndBlock:       110,
+		Transactions:   3,
+		Triggers:       4,
+		ShutterizedPct: 40,
+		Failed:         2,
+		FailPct:        66.67,
+		MissedTriggers: []int64{106},
+		Status:         StatusRatios{Count: 2, Shielded: 1, NotIncluded: 1},
+		Delay:          &DelayStats{Max: 2, Min: 2, Avg: 2, Median: 2},
+		Successes: []SuccessReport{
+			Success{trigger: 102, included: 104, validatorIndex: 1, graffiti: "shutter", decryptedTxHash: common.HexToHash("0xbb")}.report(),
+		},
+		Blames: []BlameReport{failed.report(), unseen.report()},
+	}
+}
+
+func TestReportText(t *testing.T) {
+	var out bytes.Buffer
+	assert.NilError(t, WriteReport(&out, createReportFixture(), "text"))
+	text := out.String()
+	for _, line := range []string{
+		"found 3 shutter test tx in block range[100:110] (4 triggers)\n",
+		"50.00% shielded (1/2)\n",
+		"fails 2 (66.67%)\n",
+		"missed triggers 1: [106]\n",
+		"delay max 2 min 2 avg 2.00 median 2.00\n",
+		"{102 104 1 shutter 0x00000000000000000000000000000000000000000000000000000000000000bb}\n",
+		"missed slots\t: [11]\n",
+		"target ts\t: 1970-01-01 00:17:04.000000\n",
+		"ts (key-target)\t: 1000ms\n",
+		"first seen\t: 1970-01-01 00:17:05.000000\n",
+		"NO DECRYPTION KEY SEEN\n",
+	} {
+		assert.Assert(t, strings.Contains(text, line), "%q not in\n%v", line, text)
+	}
+	assert.Assert(t, !strings.Contains(text, "=== Eons"), "the eons are unknown")
+}
+
+func TestReportJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NilError(t, WriteReport(&out, createReportFixture(), "json"))
+	var report Report
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.DeepEqual(t, report.MissedTriggers, []int64{106})
+	assert.Equal(t, report.Status.Shielded, int64(1))
+	assert.Equal(t, len(report.Blames), 2)
+	assert.Equal(t, *report.Blames[0].DecryptionKey.DelayMs, int64(1000))
+	assert.Equal(t, report.Blames[0].DecryptionKey.Eon, 2)
+	assert.Equal(t, report.Blames[0].TargetTime.Unix(), int64(1024))
+	assert.Assert(t, report.Blames[1].DecryptionKey == nil)
+	assert.Assert(t, report.Blames[1].TargetTime == nil)
+	assert.Assert(t, strings.Contains(out.String(), `"withdrawalCredentials": "0x0000000000000000000000000000000000000000"`), out.String())
+}
+
+func TestReportCSV(t *testing.T) {
+	var out bytes.Buffer
+	assert.NilError(t, WriteReport(&out, createReportFixture(), "csv"))
+	rows, err := csv.NewReader(&out).ReadAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(rows), 5)
+	assert.DeepEqual(t, rows[0], reportCSVHeader)
+	records := make([]string, len(rows)-1)
+	for i, row := range rows[1:] {
+		records[i] = row[0]
+	}
+	assert.DeepEqual(t, records, []string{"success", "blame", "blame", "missed_trigger"})
+	blame := rows[2]
+	assert.Equal(t, blame[4], "12")
+	assert.Equal(t, blame[9], "1970-01-01T00:17:04Z")
+	assert.Equal(t, blame[10], "11")
+	assert.Equal(t, blame[12], "1000")
+	assert.Equal(t, blame[14], "3")
+	assert.Equal(t, rows[4][1], "106")
+}
+
+func TestReportFormat(t *testing.T) {
+	err := WriteReport(&bytes.Buffer{}, Report{}, "xml")
+	assert.ErrorContains(t, err, "unknown report format xml")
+	assert.Equal(t, reportFileExtension("text"), "blame")
+	assert.Equal(t, reportFileExtension("csv"), "csv")
+}
@@ -0,0 +1,509 @@
+package continuous
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ScoreboardFileName returns the default name of the scoreboard of mode.
+func ScoreboardFileName(mode string) string {
+	return fmt.Sprintf("validators-%v.scoreboard", mode)
+}
+
+// Scoreboard is an append-only file, that receives a SlotScore for every shutter slot
+// seen by the collector. A slot is written again, when a later collect run sees more of
+// its transactions, so the latest line of a slot is its score. It keeps the reliability
+// of the shutter validators available across runs.
+type Scoreboard struct {
+	mu    sync.Mutex
+	file  *os.File
+	slots map[int64]SlotScore
+	// withdrawal credentials by public key, to look them up only once
+	credentials map[string]common.Address
+}
+
+// SlotScore is the outcome of the test transactions, that targeted a shutter slot.
+type SlotScore struct {
+	Slot                  int64          `json:"slot"`
+	Block                 int64          `json:"block"`
+	Time                  time.Time      `json:"time"`
+	ValidatorIndex        int64          `json:"validatorIndex"`
+	PublicKey             string         `json:"publicKey"`
+	WithdrawalCredentials common.Address `json:"withdrawalCredentials"`
+	Expected              int            `json:"expected"`
+	Included              int            `json:"included"`
+	Missed                int            `json:"missed"`
+	// included in the slot, but not by the shutter protocol
+	Unshielded int `json:"unshielded"`
+	// time from the block to the first sighting of the keys of the test transactions
+	KeyDelaysMs []int64 `json:"keyDelaysMs,omitempty"`
+}
+
+// OpenScoreboard opens the scoreboard at path for appending.
+func OpenScoreboard(path string) (*Scoreboard, error) {
+	scores, err := ReadScoreboard(path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create scoreboard folder: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open scoreboard %v: %w", path, err)
+	}
+	s := &Scoreboard{
+		file:        file,
+		slots:       make(map[int64]SlotScore, len(scores)),
+		credentials: make(map[string]common.Address),
+	}
+	for _, score := range scores {
+		s.remember(score)
+	}
+	return s, nil
+}
+
+// ReadScoreboard returns the latest score of every slot in the scoreboard at path,
+// ordered by slot. Lines, that can not be parsed, are skipped.
+func ReadScoreboard(path string) ([]SlotScore, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read scoreboard %v: %w", path, err)
+	}
+	defer file.Close()
+	slots := make(map[int64]SlotScore)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var score SlotScore
+		err = json.Unmarshal(scanner.Bytes(), &score)
+		if err != nil {
+			log.Printf("skipping scoreboard line %v: %v\n", line, err)
+			continue
+		}
+		slots[score.Slot] = score
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read scoreboard %v: %w", path, err)
+	}
+	scores := make([]SlotScore, 0, len(slots))
+	for _, score := range slots {
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Slot < scores[j].Slot })
+	return scores, nil
+}
+
+func (s *Scoreboard) remember(score SlotScore) {
+	s.slots[score.Slot] = score
+	if score.WithdrawalCredentials != (common.Address{}) {
+		s.credentials[score.PublicKey] = score.WithdrawalCredentials
+	}
+}
+
+// Record appends the scores, that differ from the ones already in the scoreboard.
+func (s *Scoreboard) Record(scores []SlotScore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, score := range scores {
+		line, err := json.Marshal(score)
+		if err != nil {
+			return err
+		}
+		if known, ok := s.slots[score.Slot]; ok {
+			knownLine, err := json.Marshal(known)
+			if err == nil && bytes.Equal(line, knownLine) {
+				continue
+			}
+		}
+		_, err = s.file.Write(append(line, '\n'))
+		if err != nil {
+			return err
+		}
+		s.remember(score)
+	}
+	return nil
+}
+
+func (s *Scoreboard) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// withdrawalCredentials returns the credentials of the validator with pubkey, from the
+// scoreboard or the deposit contract.
+func (s *Scoreboard) withdrawalCredentials(pubkey string, cfg *Configuration) common.Address {
+	s.mu.Lock()
+	credentials, ok := s.credentials[pubkey]
+	s.mu.Unlock()
+	if ok || len(pubkey) < 2 {
+		return credentials
+	}
+	found, err := withdrawAddressForPublicKey(pubkey, cfg)
+	if err != nil {
+		return common.Address{}
+	}
+	s.mu.Lock()
+	s.credentials[pubkey] = *found
+	s.mu.Unlock()
+	return *found
+}
+
+// recordScores adds the scores of the shutter slots in the range of report to the scoreboard.
+func (cfg *Configuration) recordScores(report Report) error {
+	if cfg.scoreboard == nil {
+		return nil
+	}
+	scores, err := scoreSlots(report, cfg)
+	if err != nil {
+		return err
+	}
+	cfg.Metrics.observeKeyDelays(scores)
+	return cfg.scoreboard.Record(scores)
+}
+
+// scoreLookBack are the blocks before the end of a report, whose slots are scored. The
+// reports of a run grow from its start block, but the scores of older slots can not
+// change anymore, once their transactions timed out, and are already in the scoreboard.
+const scoreLookBack = 400
+
+// scoreSlots returns the score of every shutter slot, whose block is in the range of
+// report and at most scoreLookBack blocks before its end. The transactions expected in a
+// slot are the ones included in its block and the ones, for which its validator was blamed.
+func scoreSlots(report Report, cfg *Configuration) ([]SlotScore, error) {
+	ctx := context.Background()
+	start := report.StartBlock
+	if report.EndBlock > start+scoreLookBack {
+		start = report.EndBlock - scoreLookBack
+	}
+	blocks, err := cfg.observer.ShutterBlockNumbers(ctx, start, report.EndBlock)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := cfg.observer.DecryptedTxStatuses(ctx, cfg.submitAccount.Address, start, report.EndBlock)
+	if err != nil {
+		return nil, err
+	}
+	unshielded := make(map[int64]int)
+	for _, status := range statuses {
+		if status.Status == observedUnshieldedInclusion && status.InclusionSlot != nil {
+			unshielded[*status.InclusionSlot]++
+		}
+	}
+	included := make(map[int64]int)
+	for _, success := range report.Successes {
+		included[success.IncludedBlock]++
+	}
+	blamed := make(map[int64][]BlameReport)
+	for _, blame := range report.Blames {
+		blamed[blame.TargetBlock] = append(blamed[blame.TargetBlock], blame)
+	}
+
+	var scores []SlotScore
+	for _, number := range blocks {
+		proposer, found, err := cfg.observer.NextShutterProposer(ctx, number-1)
+		if err != nil {
+			return scores, err
+		}
+		if !found || proposer.BlockNumber != number {
+			continue
+		}
+		score := SlotScore{
+			Slot:           proposer.Slot,
+			Block:          number,
+			Time:           proposer.Ts.Time.UTC(),
+			ValidatorIndex: proposer.ValidatorIndex,
+			PublicKey:      proposer.PublicKey,
+			Included:       included[number],
+			Missed:         len(blamed[number]),
+			Unshielded:     unshielded[proposer.Slot],
+		}
+		score.Expected = score.Included + score.Missed
+		for _, blame := range blamed[number] {
+			if blame.WithdrawalCredentials != (common.Address{}) {
+				score.WithdrawalCredentials = blame.WithdrawalCredentials
+			}
+		}
+		if score.WithdrawalCredentials == (common.Address{}) && cfg.scoreboard != nil {
+			score.WithdrawalCredentials = cfg.scoreboard.withdrawalCredentials(proposer.PublicKey, cfg)
+		}
+		if score.Expected > 0 {
+			score.KeyDelaysMs, err = queryKeyDelays(proposer, cfg)
+			if err != nil {
+				return scores, err
+			}
+		}
+		scores = append(scores, score)
+	}
+	return scores, nil
+}
+
+// queryKeyDelays returns the delays between the block of proposer and the decryption keys
+// of the test transactions released for its slot.
+func queryKeyDelays(proposer BlockProposer, cfg *Configuration) ([]int64, error) {
+	keys, err := cfg.observer.DecryptionKeysBySlot(context.Background(), proposer.Slot)
+	if err != nil {
+		return nil, err
+	}
+	var delays []int64
+	for _, key := range keys {
+		if len(key.IdentityPreimage) < 52 {
+			continue
+		}
+		if common.BytesToAddress(key.IdentityPreimage[32:]) != cfg.submitAccount.Address {
+			continue
+		}
+		delays = append(delays, key.CreatedTs.Time.UnixMilli()-proposer.Ts.Time.UnixMilli())
+	}
+	return delays, nil
+}
+
+// ValidatorScore sums up the slot scores of a validator.
+type ValidatorScore struct {
+	ValidatorIndex        int64          `json:"validatorIndex"`
+	PublicKey             string         `json:"publicKey"`
+	WithdrawalCredentials common.Address `json:"withdrawalCredentials"`
+	ShutterSlots          int            `json:"shutterSlots"`
+	Expected              int            `json:"expected"`
+	Included              int            `json:"included"`
+	Missed                int            `json:"missed"`
+	Unshielded            int            `json:"unshielded"`
+	MissPct               float64        `json:"missPct"`
+	// nil, if no key of a test transaction was seen
+	AvgKeyDelayMs *float64  `json:"avgKeyDelayMs"`
+	LastSlot      int64     `json:"lastSlot"`
+	LastSeen      time.Time `json:"lastSeen"`
+	keyDelaySum   int64
+	keyDelays     int
+}
+
+// Ranking are the validators, that proposed shutter slots in the window before Until,
+// ordered from the least to the most reliable.
+type Ranking struct {
+	Window     time.Duration    `json:"-"`
+	Since      time.Time        `json:"since"`
+	Until      time.Time        `json:"until"`
+	Validators []ValidatorScore `json:"validators"`
+}
+
+func (r Ranking) MarshalJSON() ([]byte, error) {
+	type ranking Ranking
+	return json.Marshal(struct {
+		Window string `json:"window"`
+		ranking
+	}{FormatWindow(r.Window), ranking(r)})
+}
+
+type validatorKey struct {
+	index       int64
+	pubkey      string
+	credentials common.Address
+}
+
+// RankValidators ranks the validators by the slots of scores in each window before until.
+func RankValidators(scores []SlotScore, until time.Time, windows []time.Duration) []Ranking {
+	rankings := make([]Ranking, len(windows))
+	for i, window := range windows {
+		rankings[i] = rankValidators(scores, until.Add(-window), until)
+		rankings[i].Window = window
+	}
+	return rankings
+}
+
+func rankValidators(scores []SlotScore, since, until time.Time) Ranking {
+	validators := make(map[validatorKey]*ValidatorScore)
+	for _, score := range scores {
+		if score.Time.Before(since) || score.Time.After(until) {
+			continue
+		}
+		key := validatorKey{score.ValidatorIndex, score.PublicKey, score.WithdrawalCredentials}
+		v, ok := validators[key]
+		if !ok {
+			v = &ValidatorScore{
+				ValidatorIndex:        score.ValidatorIndex,
+				PublicKey:             score.PublicKey,
+				WithdrawalCredentials: score.WithdrawalCredentials,
+			}
+			validators[key] = v
+		}
+		v.ShutterSlots++
+		v.Expected += score.Expected
+		v.Included += score.Included
+		v.Missed += score.Missed
+		v.Unshielded += score.Unshielded
+		for _, delay := range score.KeyDelaysMs {
+			v.keyDelaySum += delay
+			v.keyDelays++
+		}
+		if score.Slot > v.LastSlot {
+			v.LastSlot = score.Slot
+			v.LastSeen = score.Time
+		}
+	}
+	ranking := Ranking{Since: since.UTC(), Until: until.UTC(), Validators: []ValidatorScore{}}
+	for _, v := range validators {
+		if v.Expected > 0 {
+			v.MissPct = float64(v.Missed) / float64(v.Expected) * 100
+		}
+		if v.keyDelays > 0 {
+			avg := float64(v.keyDelaySum) / float64(v.keyDelays)
+			v.AvgKeyDelayMs = &avg
+		}
+		ranking.Validators = append(ranking.Validators, *v)
+	}
+	sort.Slice(ranking.Validators, func(i, j int) bool {
+		a, b := ranking.Validators[i], ranking.Validators[j]
+		if a.MissPct != b.MissPct {
+			return a.MissPct > b.MissPct
+		}
+		if a.Missed != b.Missed {
+			return a.Missed > b.Missed
+		}
+		if a.Unshielded != b.Unshielded {
+			return a.Unshielded > b.Unshielded
+		}
+		if a.ValidatorIndex != b.ValidatorIndex {
+			return a.ValidatorIndex < b.ValidatorIndex
+		}
+		return a.WithdrawalCredentials.Hex() < b.WithdrawalCredentials.Hex()
+	})
+	return ranking
+}
+
+// ParseWindow parses the length of a ranking window, a duration like 12h or a number of
+// days like 7d.
+func ParseWindow(value string) (time.Duration, error) {
+	var window time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int64
+		n, err = strconv.ParseInt(days, 10, 64)
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		window, err = time.ParseDuration(value)
+	}
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %v", value)
+	}
+	return window, nil
+}
+
+// FormatWindow formats window in the notation of ParseWindow.
+func FormatWindow(window time.Duration) string {
+	day := 24 * time.Hour
+	if window%day == 0 {
+		return fmt.Sprintf("%dd", window/day)
+	}
+	return window.String()
+}
+
+// WriteRankings writes rankings to out in format, one of ReportFormats.
+func WriteRankings(out io.Writer, rankings []Ranking, format string) error {
+	switch format {
+	case "text":
+		return writeRankingsText(out, rankings)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rankings)
+	case "csv":
+		return writeRankingsCSV(out, rankings)
+	}
+	return fmt.Errorf("unknown report format %v", format)
+}
+
+func formatKeyDelay(delay *float64) string {
+	if delay == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", *delay)
+}
+
+func writeRankingsText(out io.Writer, rankings []Ranking) error {
+	for i, ranking := range rankings {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "validators of the last %v (%v - %v)\n", FormatWindow(ranking.Window),
+			formatReportTime(&ranking.Since), formatReportTime(&ranking.Until))
+		if len(ranking.Validators) == 0 {
+			fmt.Fprintln(out, "no shutter slots")
+			continue
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "rank\tvalidator\tslots\texpected\tincluded\tmissed\tmissed %\tunshielded\tkey delay ms\tlast slot\tpublic key\twithdrawal")
+		for rank, v := range ranking.Validators {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%.2f\t%v\t%v\t%v\t%v\t%v\n",
+				rank+1, v.ValidatorIndex, v.ShutterSlots, v.Expected, v.Included, v.Missed, v.MissPct,
+				v.Unshielded, formatKeyDelay(v.AvgKeyDelayMs), v.LastSlot, v.PublicKey, v.WithdrawalCredentials.Hex())
+		}
+		err := w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var rankingCSVHeader = []string{
+	"window", "rank", "validator_index", "public_key", "withdrawal_credentials", "shutter_slots",
+	"expected", "included", "missed", "missed_pct", "unshielded", "avg_key_delay_ms", "last_slot",
+}
+
+func writeRankingsCSV(out io.Writer, rankings []Ranking) error {
+	w := csv.NewWriter(out)
+	err := w.Write(rankingCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, ranking := range rankings {
+		for rank, v := range ranking.Validators {
+			err = w.Write([]string{
+				FormatWindow(ranking.Window),
+				strconv.Itoa(rank + 1),
+				strconv.FormatInt(v.ValidatorIndex, 10),
+				v.PublicKey,
+				v.WithdrawalCredentials.Hex(),
+				strconv.Itoa(v.ShutterSlots),
+				strconv.Itoa(v.Expected),
+				strconv.Itoa(v.Included),
+				strconv.Itoa(v.Missed),
+				strconv.FormatFloat(v.MissPct, 'f', 2, 64),
+				strconv.Itoa(v.Unshielded),
+				formatKeyDelay(v.AvgKeyDelayMs),
+				strconv.FormatInt(v.LastSlot, 10),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,171 @@
+package continuous
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gotest.tools/assert"
+)
+
+func TestScoreSlots(t *testing.T) {
+	observer := createObserverFixture()
+	slot := func(s int64) *int64 { return &s }
+	observer.AddDecryptionKey(ObservedDecryptionKey{
+		Slot: 12,
+		DecryptionKeyRecord: DecryptionKeyRecord{
+			IdentityPreimage: identityPreimage(101, testSender),
+			CreatedTs:        date(1025),
+		},
+	})
+	// keys of other senders are ignored
+	observer.AddDecryptionKey(ObservedDecryptionKey{
+		Slot: 12,
+		DecryptionKeyRecord: DecryptionKeyRecord{
+			IdentityPreimage: identityPreimage(101, common.HexToAddress("0xbb")),
+			CreatedTs:        date(1030),
+		},
+	})
+	observer.AddDecryptedTx(ObservedDecryptedTx{
+		IdentityPreimage: identityPreimage(101, testSender),
+		Status:           observedUnshieldedInclusion,
+		InclusionSlot:    slot(12),
+	})
+	cfg := createTestConfig(observer)
+	scoreboard, err := OpenScoreboard(path.Join(t.TempDir(), ScoreboardFileName("standard")))
+	assert.NilError(t, err)
+	defer scoreboard.Close()
+	cfg.scoreboard = scoreboard
+	credentials := common.HexToAddress("0xcc")
+	report := Report{
+		StartBlock: 100,
+		EndBlock:   103,
+		Successes:  []SuccessReport{{TriggerBlock: 101, IncludedBlock: 102, ValidatorIndex: 1}},
+		Blames: []BlameReport{
+			{ValidatorIndex: 1, PublicKey: "0x01", WithdrawalCredentials: credentials, TriggerBlock: 100, SubmitBlock: 101, TargetBlock: 102, TargetSlot: 12},
+		},
+	}
+
+	scores, err := scoreSlots(report, cfg)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scores, []SlotScore{
+		{Slot: 10, Block: 100, Time: time.Unix(1000, 0).UTC(), ValidatorIndex: 1, PublicKey: "0x01"},
+		{
+			Slot: 12, Block: 102, Time: time.Unix(1024, 0).UTC(), ValidatorIndex: 1, PublicKey: "0x01",
+			WithdrawalCredentials: credentials, Expected: 2, Included: 1, Missed: 1, Unshielded: 1, KeyDelaysMs: []int64{1000},
+		},
+	})
+
+	// the credentials of a blame are remembered for the slots without a blame
+	assert.NilError(t, cfg.recordScores(report))
+	scores, err = scoreSlots(Report{StartBlock: 100, EndBlock: 100}, cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, len(scores), 1)
+	assert.Equal(t, scores[0].WithdrawalCredentials, credentials)
+
+	// only the slots of the look-back are scored again
+	scores, err = scoreSlots(Report{StartBlock: 100, EndBlock: 101 + scoreLookBack}, cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, len(scores), 1)
+	assert.Equal(t, scores[0].Block, int64(102))
+}
+
+func TestScoreboardRecord(t *testing.T) {
+	file := path.Join(t.TempDir(), "blame", ScoreboardFileName("standard"))
+	scoreboard, err := OpenScoreboard(file)
+	assert.NilError(t, err)
+	first := SlotScore{Slot: 10, Block: 100, Time: time.Unix(1000, 0).UTC(), ValidatorIndex: 1, Expected: 1, Missed: 1}
+	second := SlotScore{Slot: 12, Block: 102, Time: time.Unix(1024, 0).UTC(), ValidatorIndex: 1}
+	assert.NilError(t, scoreboard.Record([]SlotScore{first, second}))
+	// unchanged slots are not written again
+	assert.NilError(t, scoreboard.Record([]SlotScore{first, second}))
+	second.Expected, second.Included = 1, 1
+	assert.NilError(t, scoreboard.Record([]SlotScore{second}))
+	assert.NilError(t, scoreboard.Close())
+
+	data, err := os.ReadFile(file)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Count(string(data), "\n"), 3)
+
+	scores, err := ReadScoreboard(file)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scores, []SlotScore{first, second})
+
+	// after a restart, the recorded slots are known
+	scoreboard, err = OpenScoreboard(file)
+	assert.NilError(t, err)
+	assert.NilError(t, scoreboard.Record([]SlotScore{second}))
+	assert.NilError(t, scoreboard.Close())
+	data, err = os.ReadFile(file)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Count(string(data), "\n"), 3)
+}
+
+func TestRankValidators(t *testing.T) {
+	now := time.Unix(100000, 0)
+	hourAgo := now.Add(-time.Hour)
+	dayAgo := now.Add(-20 * time.Hour)
+	scores := []SlotScore{
+		{Slot: 1, Time: dayAgo, ValidatorIndex: 1, PublicKey: "0x01", Expected: 4, Missed: 4},
+		{Slot: 2, Time: hourAgo, ValidatorIndex: 1, PublicKey: "0x01", Expected: 2, Included: 2, KeyDelaysMs: []int64{100, 300}},
+		{Slot: 3, Time: hourAgo, ValidatorIndex: 2, PublicKey: "0x02", Expected: 2, Included: 1, Missed: 1, Unshielded: 1, KeyDelaysMs: []int64{500}},
+		{Slot: 4, Time: hourAgo, ValidatorIndex: 3, PublicKey: "0x03"},
+		// too old for every window
+		{Slot: 0, Time: now.Add(-48 * time.Hour), ValidatorIndex: 3, PublicKey: "0x03", Expected: 1, Missed: 1},
+	}
+
+	rankings := RankValidators(scores, now, []time.Duration{2 * time.Hour, 24 * time.Hour})
+	assert.Equal(t, len(rankings), 2)
+	var order []int64
+	for _, v := range rankings[0].Validators {
+		order = append(order, v.ValidatorIndex)
+	}
+	assert.DeepEqual(t, order, []int64{2, 1, 3})
+	assert.Equal(t, rankings[0].Validators[0].MissPct, 50.0)
+	assert.Equal(t, *rankings[0].Validators[1].AvgKeyDelayMs, 200.0)
+	assert.Assert(t, rankings[0].Validators[2].AvgKeyDelayMs == nil)
+
+	daily := rankings[1].Validators
+	assert.Equal(t, daily[0].ValidatorIndex, int64(1))
+	assert.Equal(t, daily[0].ShutterSlots, 2)
+	assert.Equal(t, daily[0].Expected, 6)
+	assert.Equal(t, daily[0].Missed, 4)
+	assert.Equal(t, daily[0].LastSlot, int64(2))
+	assert.Equal(t, daily[2].ValidatorIndex, int64(3))
+	assert.Equal(t, daily[2].ShutterSlots, 1)
+
+	var out bytes.Buffer
+	assert.NilError(t, WriteRankings(&out, rankings, "text"))
+	assert.Assert(t, strings.Contains(out.String(), "validators of the last 2h0m0s"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "validators of the last 1d"), out.String())
+
+	out.Reset()
+	assert.NilError(t, WriteRankings(&out, rankings, "json"))
+	var decoded []map[string]any
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, decoded[1]["window"], "1d")
+	assert.Equal(t, len(decoded[1]["validators"].([]any)), 3)
+
+	out.Reset()
+	assert.NilError(t, WriteRankings(&out, rankings, "csv"))
+	assert.Equal(t, strings.Count(out.String(), "\n"), 7)
+}
+
+func TestParseWindow(t *testing.T) {
+	for value, expected := range map[string]time.Duration{"7d": 7 * 24 * time.Hour, "90m": 90 * time.Minute} {
+		window, err := ParseWindow(value)
+		assert.NilError(t, err)
+		assert.Equal(t, window, expected)
+	}
+	for _, value := range []string{"", "d", "-1d", "0h", "week"} {
+		_, err := ParseWindow(value)
+		assert.ErrorContains(t, err, "invalid window")
+	}
+	assert.Equal(t, FormatWindow(48*time.Hour), "2d")
+	assert.Equal(t, FormatWindow(90*time.Minute), "1h30m0s")
+}
@@ -0,0 +1,70 @@
+package continuous
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ShutdownTimeout is the time Shutdown waits for the transactions in flight to finish,
+// before their watchers are cancelled.
+const ShutdownTimeout = time.Minute * 2
+
+// waitForWatchers waits up to timeout for all running watchers and reports, if they finished.
+func (s *Status) waitForWatchers(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.watchers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Shutdown stops a continuous test, after no new transactions are submitted anymore. It
+// waits up to timeout for the watchers of the transactions in flight. The remaining ones
+// are cancelled and the nonces of their inner transactions are forfeited. Finally the
+// stats from startBlock to the latest block are collected, unless startBlock is 0 or cfg
+// has no observer.
+func Shutdown(startBlock uint64, cache *BlockCache, cfg *Configuration, timeout time.Duration) error {
+	cfg.pipeline.Discard()
+	log.Println("waiting for transactions in flight")
+	if !cfg.status.waitForWatchers(timeout) {
+		cfg.status.statusModMutex.Lock()
+		outstanding := append([]*ShutterTx{}, cfg.status.txInFlight...)
+		cfg.status.statusModMutex.Unlock()
+		var unsequenced []*ShutterTx
+		for _, tx := range outstanding {
+			switch tx.Status() {
+			case Signed:
+				// the watcher does not forfeit the nonce of a tx, that was never sequenced
+				unsequenced = append(unsequenced, tx)
+				tx.cancelForShutdown()
+			case Sequenced:
+				tx.cancelForShutdown()
+			}
+		}
+		log.Printf("cancelled %v transactions in flight\n", len(outstanding))
+		if !cfg.status.waitForWatchers(timeout) {
+			log.Println("watchers did not finish after cancellation")
+		}
+		for _, tx := range unsequenced {
+			forfeitInnerNonce(tx, cfg.client)
+		}
+	}
+	latest, err := cfg.client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	CheckTxInFlight(int64(latest), cfg)
+	PrintAllTx(cfg)
+	if startBlock == 0 || !cfg.HasObserver() {
+		return nil
+	}
+	log.Println("running final stats")
+	return CollectContinuousTestStats(startBlock, latest, cache, cfg)
+}
@@ -0,0 +1,84 @@
+package continuous
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"gotest.tools/assert"
+)
+
+func TestShutdownWaitsForTxInFlight(t *testing.T) {
+	sim, cfg := createSimulatedConfig(t)
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+	trigger := int64(head)
+
+	SendShutterizedTX(trigger, pgtype.Date{}, 0, time.Now(), cfg)
+	assert.Equal(t, len(cfg.status.txInFlight), 1)
+	tx := cfg.status.txInFlight[0]
+	assert.NilError(t, cfg.pipeline.Prepare(trigger+1, cfg))
+	preparedNonce := cfg.pipeline.next.innerNonce
+
+	sim.Start(50 * time.Millisecond)
+	assert.NilError(t, Shutdown(0, nil, cfg, 10*time.Second))
+	sim.Stop()
+
+	assert.Equal(t, tx.Status(), Included)
+	assert.Equal(t, len(cfg.status.txInFlight), 0)
+	assert.Equal(t, len(cfg.status.txDone), 1)
+	assert.Assert(t, cfg.pipeline.next == nil, "the prepared tx was discarded")
+	nonce, err := cfg.accounts[0].NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, preparedNonce)
+}
+
+func TestShutdownCancelsTxInFlight(t *testing.T) {
+	sim, cfg := createSimulatedConfig(t)
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+
+	SendShutterizedTX(int64(head), pgtype.Date{}, 0, time.Now(), cfg)
+	tx := cfg.status.txInFlight[0]
+	done := make(chan error)
+	go func() { done <- Shutdown(0, nil, cfg, 100*time.Millisecond) }()
+	for tx.Status() == Signed {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// mine the transaction, that forfeits the inner nonce
+	sim.Start(50 * time.Millisecond)
+	assert.NilError(t, <-done)
+	sim.Stop()
+
+	assert.Equal(t, tx.Status(), NotSequenced)
+	history := tx.History()
+	assert.Equal(t, history[len(history)-1].Reason, "cancelled by shutdown")
+}
+
+func TestCloseKeepsTxInFlight(t *testing.T) {
+	sim, cfg := createSimulatedConfig(t)
+	journalFile := path.Join(t.TempDir(), JournalFileName("standard"))
+	journal, _, err := OpenJournal(journalFile)
+	assert.NilError(t, err)
+	cfg.journal = journal
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+
+	SendShutterizedTX(int64(head), pgtype.Date{}, 0, time.Now(), cfg)
+	assert.Equal(t, len(cfg.status.txInFlight), 1)
+	tx := cfg.status.txInFlight[0]
+	cfg.Close()
+
+	// the watcher is gone, but the tx is still in flight for the next run
+	assert.Equal(t, tx.Status(), Signed)
+	reopened, entries, err := OpenJournal(journalFile)
+	assert.NilError(t, err)
+	defer reopened.Close()
+	restored := createTestConfig(nil)
+	restored.accounts = cfg.accounts
+	assert.NilError(t, restored.restoreFromJournal(entries))
+	assert.Equal(t, len(restored.status.txInFlight), 1)
+	assert.Equal(t, restored.status.txInFlight[0].Status(), Signed)
+}
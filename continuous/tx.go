@@ -2,32 +2,81 @@ package continuous
 
 import (
 	"context"
-	cryptorand "crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/jackc/pgtype"
 	"github.com/shutter-network/nethermind-tests/utils"
 	"github.com/shutter-network/shutter/shlib/shcrypto"
 )
 
 type ShutterTx struct {
-	innerTx         *types.Transaction
-	outerTx         *types.Transaction
-	sender          *utils.Account
-	prefix          shcrypto.Block
-	triggerBlock    int64
+	innerTx      *types.Transaction
+	outerTx      *types.Transaction
+	sender       *utils.Account
+	prefix       shcrypto.Block
+	triggerBlock int64
+	targetSlot   int64
+	signedAt     time.Time
+	// time from the detection of the trigger to the broadcast of the outer tx
+	latency time.Duration
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// receives the lifecycle transitions, may be nil
+	journal *Journal
+	metrics *ModeMetrics
+	watched bool
+	// set, when the watcher was stopped without a final status, e.g. for a restart
+	stopped atomic.Bool
+	// set, when the tx was cancelled by Shutdown
+	shutdown atomic.Bool
+
+	// guards the status, the blocks and the transitions, which change while the tx is watched
+	mu              sync.Mutex
+	txStatus        TxStatus
 	submissionBlock int64
 	inclusionBlock  int64
 	cancelBlock     int64
-	targetSlot      int64
-	txStatus        TxStatus
-	ctx             context.Context
-	cancel          context.CancelFunc
+	transitions     []Transition
+}
+
+// stop ends the watcher of tx without changing its status, so that the next run resumes
+// it from the journal.
+func (tx *ShutterTx) stop() {
+	tx.stopped.Store(true)
+	tx.cancel()
+}
+
+// cancelForShutdown cancels tx, so that its watcher gives it up with the shutdown as reason.
+func (tx *ShutterTx) cancelForShutdown() {
+	tx.shutdown.Store(true)
+	tx.cancel()
+}
+
+// cancelReason returns the reason of a cancellation of tx, that is not one by Shutdown.
+func (tx *ShutterTx) cancelReason(reason string) string {
+	if tx.shutdown.Load() {
+		return "cancelled by shutdown"
+	}
+	return reason
+}
+
+// record writes the current state of tx to its journal.
+func (tx *ShutterTx) record() {
+	if tx.journal == nil {
+		return
+	}
+	err := tx.journal.Record(tx)
+	if err != nil {
+		log.Printf("could not journal tx for %v: %v\n", tx.triggerBlock, err)
+	}
 }
 
 func (tx *ShutterTx) String() string {
@@ -49,22 +98,31 @@ func (tx *ShutterTx) String() string {
 		outerTxHash = tx.outerTx.Hash().Hex()
 		outerTxNonce = fmt.Sprint(tx.outerTx.Nonce())
 	}
+	state := tx.state()
+	var timeline strings.Builder
+	for _, t := range state.transitions {
+		timeline.WriteString("\n\t\t" + t.String())
+	}
 	return fmt.Sprintf(
 		"ShutterTx[%v]\t%v\n"+
 			"\ttrigger:\t%8d\n"+
 			"\tsubmit :\t%8d\t%v n:%v\n"+
 			"\tinclude:\t%8d\t%v n:%v\n"+
-			"\tcancel :\t%8d",
-		tx.txStatus,
+			"\tcancel :\t%8d\n"+
+			"\tlatency:\t%v\n"+
+			"\ttimeline:%v",
+		state.status,
 		tx.sender.Address.Hex(),
 		tx.triggerBlock,
-		tx.submissionBlock,
+		state.submissionBlock,
 		outerTxHash,
 		outerTxNonce,
-		tx.inclusionBlock,
+		state.inclusionBlock,
 		innerTxHash,
 		innerTxNonce,
-		tx.cancelBlock,
+		state.cancelBlock,
+		tx.latency,
+		timeline.String(),
 	)
 }
 
@@ -80,75 +138,75 @@ const (
 )
 
 func (ts TxStatus) String() string {
+	if ts < Signed || ts > SystemFailure {
+		return "Unknown"
+	}
 	return [...]string{"Signed", "Sequenced", "Included", "NotSequenced", "NotIncluded", "SystemFailure"}[ts-1]
 }
 
-func (ts TxStatus) EnumIndex() int {
-	return int(ts)
+func (ts TxStatus) MarshalText() ([]byte, error) {
+	return []byte(ts.String()), nil
 }
-func SendShutterizedTX(blockNumber int64, lastTimestamp pgtype.Date, targetSlot int64, cfg *Configuration) {
-	account := cfg.NextAccount()
-	log.Printf("SENDING NEW TX FOR %v from %v", blockNumber, account.Address.Hex())
-	gasLimit := uint64(21000)
-	var data []byte
-	gas, err := utils.GasCalculationFromClient(context.Background(), cfg.client, utils.MinGasTipUpdateFn)
-	if err != nil {
-		panic(err)
-	}
-	identityPrefix := utils.PrefixFromBlockNumber(blockNumber)
-	identity := utils.ComputeIdentity(identityPrefix[:], cfg.submitAccount.Address)
-	innerNonceP := account.UseNonce()
-	innerTx := types.NewTx(
-		&types.DynamicFeeTx{
-			ChainID:   cfg.chainID,
-			Nonce:     innerNonceP.Uint64(),
-			GasFeeCap: gas.Fee,
-			GasTipCap: gas.Tip,
-			Gas:       gasLimit,
-			To:        &cfg.submitAccount.Address,
-			Value:     big.NewInt(blockNumber),
-			Data:      data,
-		},
-	)
 
-	signedInnerTx, err := account.Sign(account.Address, innerTx)
+func (ts *TxStatus) UnmarshalText(text []byte) error {
+	status, err := parseTxStatus(string(text))
 	if err != nil {
-		panic(err)
-	}
-	sigma, err := shcrypto.RandomSigma(cryptorand.Reader)
-	if err != nil {
-		panic("could not get random sigma")
+		return err
 	}
+	*ts = status
+	return nil
+}
+
+func (ts TxStatus) EnumIndex() int {
+	return int(ts)
+}
 
-	buff, err := signedInnerTx.MarshalBinary()
+// SendShutterizedTX submits the transaction for the trigger blockNumber, that was
+// detected at detectedAt. The transaction prepared by cfg.pipeline is used, if possible.
+func SendShutterizedTX(blockNumber int64, lastTimestamp pgtype.Date, targetSlot int64, detectedAt time.Time, cfg *Configuration) {
+	pipeline := cfg.pipeline
+	if pipeline == nil {
+		pipeline = NewPipeline()
+	}
+	prepared, err := pipeline.take(blockNumber, cfg)
 	if err != nil {
-		panic(err)
+		log.Printf("could not prepare tx for %v: %v\n", blockNumber, err)
+		return
 	}
-
-	eon, eonKey, err := utils.GetEonKey(context.Background(), cfg.client, cfg.contracts.KeyperSetManager, cfg.contracts.KeyBroadcastContract, KeyperSetChangeLookAhead)
+	account := prepared.account
+	signedInnerTx := prepared.signedInnerTx
+	log.Printf("SENDING NEW TX FOR %v from %v", blockNumber, account.Address.Hex())
+	identityPrefix := utils.PrefixFromBlockNumber(blockNumber)
+	opts, err := cfg.submitAccount.Opts()
 	if err != nil {
-		panic(err)
+		prepared.release()
+		log.Println("could not allocate submit nonce", err)
+		return
 	}
-	encrypted := shcrypto.Encrypt(buff, (*shcrypto.EonPublicKey)(eonKey), identity, sigma)
-	opts := cfg.submitAccount.Opts()
 
 	opts.Value = big.NewInt(0).Sub(signedInnerTx.Cost(), signedInnerTx.Value())
-
-	submitGas, err := utils.GasCalculationFromClient(context.Background(), cfg.client, utils.HighPriorityGasPriceFn)
-	if err != nil {
-		panic(err)
-	}
-	opts.GasFeeCap = submitGas.Fee
-	opts.GasTipCap = submitGas.Tip
+	opts.GasFeeCap = prepared.submitGas.Fee
+	opts.GasTipCap = prepared.submitGas.Tip
 	log.Printf("submit nonce: %v\n", opts.Nonce)
 	outerTx, err := cfg.contracts.Sequencer.SubmitEncryptedTransaction(
-		opts, eon, identityPrefix, encrypted.Marshal(), new(big.Int).SetUint64(signedInnerTx.Gas()),
+		opts, prepared.eon, identityPrefix, prepared.encrypted.Marshal(), new(big.Int).SetUint64(signedInnerTx.Gas()),
 	)
 	if err != nil {
-		panic(err)
+		// neither transaction reached the node, so both nonces can be used again
+		log.Printf("could not submit tx for %v: %v\n", blockNumber, err)
+		prepared.release()
+		cfg.submitAccount.ReleaseNonce(opts.Nonce.Uint64())
+		err = cfg.submitAccount.ResyncNonce()
+		if err != nil {
+			log.Println("could not resync submit nonce", err)
+		}
+		return
 	}
+	submitLatency := time.Since(detectedAt)
+	log.Printf("submitted tx for %v %v after detection\n", blockNumber, submitLatency)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*20)
+	signedAt := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), signedAt.Add(txTimeout))
 
 	tx := ShutterTx{
 		outerTx:      outerTx,
@@ -157,100 +215,96 @@ func SendShutterizedTX(blockNumber int64, lastTimestamp pgtype.Date, targetSlot
 		prefix:       identityPrefix,
 		triggerBlock: blockNumber,
 		targetSlot:   targetSlot,
-		txStatus:     TxStatus(Signed),
+		signedAt:     signedAt,
+		latency:      submitLatency,
 		ctx:          ctx,
 		cancel:       cancel,
+		journal:      cfg.journal,
+		metrics:      cfg.Metrics,
+		watched:      true,
+	}
+	err = tx.transition(Signed, blockNumber, "submitted to the sequencer")
+	if err != nil {
+		log.Println(err)
 	}
+	tx.record()
 	cfg.status.AddTxInFlight(&tx)
 	log.Println(signedInnerTx.Hash())
-	go WatchTx(&tx, cfg.client)
+	cfg.status.watch(&tx, cfg.client, cfg.Helpers)
 }
 
-func WatchTx(tx *ShutterTx, client *ethclient.Client) {
+// WatchTx follows tx until it reaches a final status. A tx, that is already sequenced,
+// e.g. after it was restored from the journal, is only watched for its inclusion.
+func WatchTx(tx *ShutterTx, client utils.Backend) {
 	defer tx.cancel()
-	submissionReceipt, err := utils.WaitForTxSubscribe(tx.ctx, *tx.outerTx, fmt.Sprintf("submission[%v]", tx.triggerBlock), client)
-	select {
-	case <-tx.ctx.Done():
-		switch tx.ctx.Err() {
-		case context.Canceled:
-			tx.txStatus = TxStatus(NotSequenced)
-			log.Println(tx)
-			return
-		case context.DeadlineExceeded:
-			tx.txStatus = TxStatus(SystemFailure)
-			log.Println(tx)
-			return
-		default:
-			fmt.Println("something else")
-		}
-	default:
-	}
-	if err != nil {
-		tx.txStatus = TxStatus(SystemFailure)
-	}
-	if submissionReceipt.Status == 1 {
-		tx.txStatus = TxStatus(Sequenced)
-		tx.submissionBlock = submissionReceipt.BlockNumber.Int64()
-	} else {
-		tx.txStatus = TxStatus(SystemFailure)
-	}
-	if tx.txStatus != Sequenced {
-		log.Println(tx)
-		err = forfeitNonce(tx.innerTx.Nonce(), *tx.sender, client)
+	defer tx.record()
+	defer func() { log.Println(tx) }()
+	move := func(status TxStatus, block int64, reason string) {
+		err := tx.transition(status, block, reason)
 		if err != nil {
-			log.Println("could not reset nonce", err)
+			log.Println(err)
 		}
-		return
 	}
-	includedReceipt, err := utils.WaitForTxSubscribe(tx.ctx, *tx.innerTx, fmt.Sprintf("inclusion[%v]", tx.triggerBlock), client)
-	select {
-	case <-tx.ctx.Done():
-		switch tx.ctx.Err() {
-		case context.Canceled:
-			err = forfeitNonce(tx.innerTx.Nonce(), *tx.sender, client)
-			if err != nil {
-				if err.Error()[0:8] == "OldNonce" {
-					// FIXME: the error message is rpc endpoint implementation specific (in this case Nethermind)
-					// ...but at this point there is a very high chance, that the tx
-					// was included before we could send the cancellation.
-					fmt.Println("OOOOOOLD NONCE")
-				}
-				log.Println("could not reset nonce", err)
-			}
-			tx.txStatus = TxStatus(NotIncluded)
-			log.Println(tx)
+	if tx.Status() == Signed {
+		submissionReceipt, err := utils.WaitForTxSubscribe(tx.ctx, tx.outerTx, fmt.Sprintf("submission[%v]", tx.triggerBlock), client)
+		switch {
+		case tx.stopped.Load():
 			return
-		case context.DeadlineExceeded:
+		case errors.Is(tx.ctx.Err(), context.Canceled):
+			move(NotSequenced, tx.state().cancelBlock, tx.cancelReason("cancelled before the submission was mined"))
+			return
+		case errors.Is(tx.ctx.Err(), context.DeadlineExceeded):
+			move(SystemFailure, 0, "timeout waiting for the submission")
+			return
+		case err != nil:
+			move(SystemFailure, 0, fmt.Sprintf("could not wait for the submission: %v", err))
+		case submissionReceipt.Status != types.ReceiptStatusSuccessful:
+			move(SystemFailure, submissionReceipt.BlockNumber.Int64(), "submission reverted")
+		default:
+			move(Sequenced, submissionReceipt.BlockNumber.Int64(), "submission mined")
+			tx.record()
+		}
+		if tx.Status() != Sequenced {
 			err = forfeitNonce(tx.innerTx.Nonce(), *tx.sender, client)
 			if err != nil {
-				if err.Error()[0:8] == "OldNonce" {
-					// FIXME: the error message is rpc endpoint implementation specific (in this case Nethermind)
-					// ...but at this point there is a very high chance, that the tx
-					// was included before we could send the cancellation.
-					fmt.Println("OOOOOOLD NONCE")
-				}
 				log.Println("could not reset nonce", err)
 			}
-			tx.txStatus = TxStatus(SystemFailure)
-			log.Println(tx)
 			return
-		default:
 		}
+	}
+	includedReceipt, err := utils.WaitForTxSubscribe(tx.ctx, tx.innerTx, fmt.Sprintf("inclusion[%v]", tx.triggerBlock), client)
+	switch {
+	case tx.stopped.Load():
+		return
+	case errors.Is(tx.ctx.Err(), context.Canceled):
+		forfeitInnerNonce(tx, client)
+		move(NotIncluded, tx.state().cancelBlock, tx.cancelReason("cancelled, a later submission was included"))
+	case errors.Is(tx.ctx.Err(), context.DeadlineExceeded):
+		forfeitInnerNonce(tx, client)
+		move(SystemFailure, 0, "timeout waiting for the inclusion")
+	case err != nil:
+		move(SystemFailure, 0, fmt.Sprintf("could not wait for the inclusion: %v", err))
 	default:
+		move(Included, includedReceipt.BlockNumber.Int64(), "included")
+		log.Printf("INCLUDED!!! %v\n", tx.innerTx.Hash())
 	}
+}
+
+// forfeitInnerNonce uses up the nonce of the inner transaction of tx, that was not included in time.
+func forfeitInnerNonce(tx *ShutterTx, client utils.Backend) {
+	err := forfeitNonce(tx.innerTx.Nonce(), *tx.sender, client)
 	if err != nil {
-		tx.txStatus = TxStatus(SystemFailure)
-		log.Println(err)
-	}
-	if includedReceipt != nil {
-		tx.txStatus = TxStatus(Included)
-		tx.inclusionBlock = includedReceipt.BlockNumber.Int64()
-		log.Printf("INCLUDED!!! %v\n", tx.innerTx.Hash())
+		if strings.HasPrefix(err.Error(), "OldNonce") {
+			// FIXME: the error message is rpc endpoint implementation specific (in this case Nethermind)
+			// ...but at this point there is a very high chance, that the tx
+			// was included before we could send the cancellation.
+			fmt.Println("OOOOOOLD NONCE")
+		}
+		log.Println("could not reset nonce", err)
 	}
-	log.Println(tx)
 }
 
-func forfeitNonce(nonce uint64, account utils.Account, client *ethclient.Client) error {
+func forfeitNonce(nonce uint64, account utils.Account, client utils.Backend) error {
 	chainId, err := client.ChainID(context.Background())
 	if err != nil {
 		return err
@@ -280,11 +334,17 @@ func forfeitNonce(nonce uint64, account utils.Account, client *ethclient.Client)
 	}
 	err = client.SendTransaction(context.Background(), signed)
 	if err != nil {
+		// the nonce was most likely used already, make sure the next allocation agrees with the
+		// node. The pool does not know the inner transactions in flight, so they are kept.
+		resyncErr := account.SyncMinedNonce()
+		if resyncErr != nil {
+			log.Println("could not resync nonce", resyncErr)
+		}
 		return err
 	}
 	receipt, err := utils.WaitForTxSubscribe(
 		context.Background(),
-		*signed,
+		signed,
 		fmt.Sprintf("forfeit nonce[%v] for %v", nonce, account.Address.Hex()),
 		client,
 	)
@@ -0,0 +1,95 @@
+package continuous
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Transition is a change of the status of a ShutterTx.
+type Transition struct {
+	Status TxStatus `json:"status"`
+	// the block, that caused the transition, 0 if there is none
+	Block  int64     `json:"block,omitempty"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%v\t%-13v\t%8d\t%v", t.Time.Format(time.RFC3339), t.Status, t.Block, t.Reason)
+}
+
+// legalTransitions lists the statuses, that a ShutterTx can reach from each status.
+// Included, NotSequenced, NotIncluded and SystemFailure are final.
+var legalTransitions = map[TxStatus][]TxStatus{
+	0:         {Signed},
+	Signed:    {Sequenced, NotSequenced, SystemFailure},
+	Sequenced: {Included, NotIncluded, SystemFailure},
+}
+
+// txState is a consistent copy of the mutable fields of a ShutterTx.
+type txState struct {
+	status          TxStatus
+	submissionBlock int64
+	inclusionBlock  int64
+	cancelBlock     int64
+	transitions     []Transition
+}
+
+// transition moves tx to status, if that is allowed from its current status. Reaching
+// Sequenced sets the submission block, reaching Included the inclusion block.
+func (tx *ShutterTx) transition(status TxStatus, block int64, reason string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if !slices.Contains(legalTransitions[tx.txStatus], status) {
+		return fmt.Errorf("illegal transition of tx for %v from %v to %v (%v)", tx.triggerBlock, tx.txStatus, status, reason)
+	}
+	switch status {
+	case Sequenced:
+		tx.submissionBlock = block
+	case Included:
+		tx.inclusionBlock = block
+	}
+	tx.txStatus = status
+	tx.transitions = append(tx.transitions, Transition{
+		Status: status,
+		Block:  block,
+		Time:   time.Now(),
+		Reason: reason,
+	})
+	tx.metrics.transition(status, tx.triggerBlock, tx.submissionBlock, block)
+	return nil
+}
+
+// Status returns the current status of tx.
+func (tx *ShutterTx) Status() TxStatus {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.txStatus
+}
+
+// History returns the transitions of tx in the order they happened.
+func (tx *ShutterTx) History() []Transition {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return append([]Transition{}, tx.transitions...)
+}
+
+// markCancelled records the block, in which the watcher of tx was cancelled.
+func (tx *ShutterTx) markCancelled(block int64) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.cancelBlock = block
+}
+
+func (tx *ShutterTx) state() txState {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return txState{
+		status:          tx.txStatus,
+		submissionBlock: tx.submissionBlock,
+		inclusionBlock:  tx.inclusionBlock,
+		cancelBlock:     tx.cancelBlock,
+		transitions:     append([]Transition{}, tx.transitions...),
+	}
+}
@@ -0,0 +1,47 @@
+package continuous
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestTxTransitions(t *testing.T) {
+	tx := &ShutterTx{triggerBlock: 10}
+	assert.ErrorContains(t, tx.transition(Sequenced, 11, "too early"), "illegal transition")
+
+	assert.NilError(t, tx.transition(Signed, 10, "submitted"))
+	assert.NilError(t, tx.transition(Sequenced, 11, "submission mined"))
+	assert.ErrorContains(t, tx.transition(Signed, 12, "back again"), "illegal transition")
+	assert.NilError(t, tx.transition(Included, 12, "included"))
+	assert.ErrorContains(t, tx.transition(SystemFailure, 0, "after final"), "illegal transition")
+
+	state := tx.state()
+	assert.Equal(t, state.status, Included)
+	assert.Equal(t, state.submissionBlock, int64(11))
+	assert.Equal(t, state.inclusionBlock, int64(12))
+	history := tx.History()
+	assert.Equal(t, len(history), 3)
+	for i, status := range []TxStatus{Signed, Sequenced, Included} {
+		assert.Equal(t, history[i].Status, status)
+	}
+	assert.Assert(t, !history[2].Time.Before(history[0].Time))
+}
+
+func TestTransitionJSON(t *testing.T) {
+	tx := &ShutterTx{}
+	assert.NilError(t, tx.transition(Signed, 10, "submitted"))
+	assert.NilError(t, tx.transition(NotSequenced, 12, "cancelled"))
+
+	data, err := json.Marshal(tx.History())
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(data), `"status":"NotSequenced"`))
+	var decoded []Transition
+	assert.NilError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, len(decoded), 2)
+	assert.Equal(t, decoded[1].Status, NotSequenced)
+	assert.Equal(t, decoded[1].Block, int64(12))
+	assert.Equal(t, decoded[1].Reason, "cancelled")
+}
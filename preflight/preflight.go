@@ -0,0 +1,318 @@
+// Package preflight checks a network profile and the local environment before any
+// transaction is sent, so that a misconfiguration shows up as a failed check instead of a
+// panic deep inside the tests.
+package preflight
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/continuous"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+// errSkipped marks a check, that could not run because an earlier one failed.
+var errSkipped = errors.New("skipped")
+
+// Result is the outcome of a single check.
+type Result struct {
+	Check  string
+	Detail string
+	Err    error
+}
+
+func (r Result) Status() string {
+	switch {
+	case errors.Is(r.Err, errSkipped):
+		return "SKIP"
+	case r.Err != nil:
+		return "FAIL"
+	default:
+		return "PASS"
+	}
+}
+
+// Observer is the part of the observer database, that is checked.
+type Observer interface {
+	MissingTables(ctx context.Context) ([]string, error)
+}
+
+// Environment is what the checks run against.
+type Environment struct {
+	Network config.Profile
+	// dialed from the rpc url of Network, if nil
+	Client utils.Backend
+	// connected with the db settings of Network, if nil
+	Observer    Observer
+	PkFile      string
+	BlameFolder string
+	LogsFolder  string
+}
+
+// Run runs every check and returns their results in order. Checks, that depend on a failed
+// one, are skipped.
+func Run(ctx context.Context, env Environment) []Result {
+	var results []Result
+	add := func(check, detail string, err error) {
+		results = append(results, Result{Check: check, Detail: detail, Err: err})
+	}
+
+	client, chainID, err := dial(ctx, &env)
+	detail := ""
+	if chainID != nil {
+		detail = fmt.Sprintf("chain %v", chainID)
+	}
+	add("rpc", detail, err)
+	if err == nil {
+		defer client.close()
+	}
+	contracts := []struct {
+		name    string
+		address string
+	}{
+		{"sequencer contract", env.Network.Contracts.Sequencer},
+		{"keyper set manager contract", env.Network.Contracts.KeyperSetManager},
+		{"key broadcast contract", env.Network.Contracts.KeyBroadcast},
+		{"deposit contract", env.Network.Contracts.DepositContract},
+	}
+	codeFound := true
+	for _, contract := range contracts {
+		if client == nil {
+			add(contract.name, contract.address, errSkipped)
+			continue
+		}
+		err := hasCode(ctx, client, contract.address)
+		add(contract.name, contract.address, err)
+		codeFound = codeFound && err == nil
+	}
+
+	switch {
+	case client == nil || !codeFound:
+		add("eon key", "", errSkipped)
+	default:
+		eon, err := eonKey(ctx, client, env.Network, chainID)
+		add("eon key", fmt.Sprintf("eon %v", eon), err)
+	}
+
+	if client == nil {
+		add("test accounts", env.PkFile, errSkipped)
+		add("submit account", "", errSkipped)
+	} else {
+		var refill *big.Int
+		refill, detail, err = testAccounts(ctx, client, chainID, env.PkFile)
+		add("test accounts", detail, err)
+		detail, err = submitAccount(ctx, client, chainID, env.Network.PrivateKey, refill)
+		add("submit account", detail, err)
+	}
+
+	detail, err = observer(ctx, env)
+	add("observer db", detail, err)
+
+	blameFolder := env.BlameFolder
+	if blameFolder == "" {
+		blameFolder = os.TempDir()
+	}
+	add("blame folder", blameFolder, writable(blameFolder))
+	add("logs folder", env.LogsFolder, writable(env.LogsFolder))
+	return results
+}
+
+// Failed returns the number of failed checks.
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Status() == "FAIL" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Write prints the results as a table.
+func Write(out io.Writer, results []Result) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, result := range results {
+		detail := result.Detail
+		if result.Err != nil && !errors.Is(result.Err, errSkipped) {
+			detail = strings.TrimSpace(detail + " " + result.Err.Error())
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", result.Check, result.Status(), detail)
+	}
+	return w.Flush()
+}
+
+// rpcClient closes the client, if it was dialed by the checks.
+type rpcClient struct {
+	utils.Backend
+	close func()
+}
+
+func dial(ctx context.Context, env *Environment) (*rpcClient, *big.Int, error) {
+	c := &rpcClient{Backend: env.Client, close: func() {}}
+	if env.Client == nil {
+		if env.Network.RPCURL == "" {
+			return nil, nil, errors.New("no rpc url configured")
+		}
+		ethClient, err := ethclient.DialContext(ctx, env.Network.RPCURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		c = &rpcClient{Backend: ethClient, close: ethClient.Close}
+	}
+	chainID, err := c.ChainID(ctx)
+	if err != nil {
+		c.close()
+		return nil, nil, fmt.Errorf("could not query chainId %v", err)
+	}
+	err = env.Network.CheckChainID(chainID)
+	if err != nil {
+		c.close()
+		return nil, chainID, err
+	}
+	env.Network = env.Network.ForChain(chainID)
+	return c, chainID, nil
+}
+
+func hasCode(ctx context.Context, client utils.Backend, address string) error {
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("invalid address")
+	}
+	code, err := client.CodeAt(ctx, common.HexToAddress(address), nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no code")
+	}
+	return nil
+}
+
+func eonKey(ctx context.Context, client utils.Backend, network config.Profile, chainID *big.Int) (uint64, error) {
+	contracts, err := utils.SetupContracts(client, network.Contracts.KeyBroadcast, network.Contracts.Sequencer,
+		network.Contracts.KeyperSetManager, network.Contracts.DepositContract, chainID)
+	if err != nil {
+		return 0, err
+	}
+	eon, _, err := utils.GetEonKey(ctx, client, contracts.KeyperSetManager, contracts.KeyBroadcastContract, continuous.KeyperSetChangeLookAhead)
+	return eon, err
+}
+
+// testAccounts returns the amount, that the submit account has to send to the test accounts
+// of the continuous tests, when they are set up. Missing accounts are created then.
+func testAccounts(ctx context.Context, client utils.Backend, chainID *big.Int, pkFile string) (*big.Int, string, error) {
+	minimal := big.NewInt(continuous.MinimalFunding)
+	refill := new(big.Int)
+	var pks []*ecdsa.PrivateKey
+	fd, err := os.Open(pkFile)
+	if err == nil {
+		pks, err = utils.ReadPks(fd)
+		fd.Close()
+		if err != nil {
+			return refill, pkFile, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return refill, pkFile, err
+	}
+	if len(pks) > continuous.NumFundedAccounts {
+		pks = pks[:continuous.NumFundedAccounts]
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	low := 0
+	for _, pk := range pks {
+		account, err := utils.AccountFromPrivateKey(pk, signer)
+		if err != nil {
+			return refill, pkFile, err
+		}
+		balance, err := client.BalanceAt(ctx, account.Address, nil)
+		if err != nil {
+			return refill, pkFile, err
+		}
+		missing := new(big.Int).Sub(minimal, balance)
+		// like the setup, only accounts below half of the minimal funding are refilled
+		if missing.Cmp(new(big.Int).Div(minimal, big.NewInt(2))) > 0 {
+			refill.Add(refill, missing)
+		}
+		if missing.Sign() > 0 {
+			low++
+		}
+	}
+	created := continuous.NumFundedAccounts - len(pks)
+	refill.Add(refill, new(big.Int).Mul(minimal, big.NewInt(int64(created))))
+	detail := fmt.Sprintf("%v of %v below %v wei, %v to create, refill needs %v wei", low, len(pks), minimal, created, refill)
+	return refill, detail, nil
+}
+
+// submitAccount checks, that the submit account can fund the test accounts and still
+// holds the minimal funding itself.
+func submitAccount(ctx context.Context, client utils.Backend, chainID *big.Int, pk string, refill *big.Int) (string, error) {
+	if pk == "" {
+		return "", fmt.Errorf("no private key configured")
+	}
+	key, err := crypto.HexToECDSA(pk)
+	if err != nil {
+		return "", err
+	}
+	account, err := utils.AccountFromPrivateKey(key, types.LatestSignerForChainID(chainID))
+	if err != nil {
+		return "", err
+	}
+	balance, err := client.BalanceAt(ctx, account.Address, nil)
+	if err != nil {
+		return account.Address.Hex(), err
+	}
+	required := new(big.Int).Add(refill, big.NewInt(continuous.MinimalFunding))
+	detail := fmt.Sprintf("%v has %v wei", account.Address.Hex(), balance)
+	if balance.Cmp(required) < 0 {
+		return detail, fmt.Errorf("needs at least %v wei", required)
+	}
+	return detail, nil
+}
+
+func observer(ctx context.Context, env Environment) (string, error) {
+	db := env.Network.DB
+	if env.Network.ShutterBlocks == "beacon" && db == (config.DB{}) && env.Observer == nil {
+		return "not configured, only needed by collect and the graffiti mode", nil
+	}
+	detail := fmt.Sprintf("%v/%v", db.Addr, db.Name)
+	store := env.Observer
+	if store == nil {
+		conn, err := continuous.ConnectObserver(ctx, db)
+		if err != nil {
+			return detail, err
+		}
+		defer conn.Close()
+		store = conn
+	}
+	missing, err := store.MissingTables(ctx)
+	if err != nil {
+		return detail, err
+	}
+	if len(missing) > 0 {
+		return detail, fmt.Errorf("missing tables %v", strings.Join(missing, ", "))
+	}
+	return detail, nil
+}
+
+// writable creates and removes a file in dir.
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".preflight")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,132 @@
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gotest.tools/assert"
+
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/continuous"
+	"github.com/shutter-network/nethermind-tests/simulator"
+)
+
+type observerStub []string
+
+func (missing observerStub) MissingTables(context.Context) ([]string, error) {
+	return missing, nil
+}
+
+func statuses(results []Result) map[string]string {
+	result := make(map[string]string)
+	for _, r := range results {
+		result[r.Check] = r.Status()
+	}
+	return result
+}
+
+func newEnvironment(t *testing.T, funding *big.Int) Environment {
+	alloc := types.GenesisAlloc{}
+	key, err := simulator.FundedKey(alloc, funding)
+	assert.NilError(t, err)
+	sim, err := simulator.New(alloc)
+	assert.NilError(t, err)
+	t.Cleanup(func() { sim.Close() })
+	chainID, err := sim.Client().ChainID(context.Background())
+	assert.NilError(t, err)
+
+	network := config.Profile{
+		ChainID:    chainID.Uint64(),
+		PrivateKey: hexutil.Encode(crypto.FromECDSA(key))[2:],
+	}
+	network.Contracts.Sequencer = simulator.SequencerContractAddress.Hex()
+	network.Contracts.KeyperSetManager = simulator.KeyperSetManagerContractAddress.Hex()
+	network.Contracts.KeyBroadcast = simulator.KeyBroadcastContractAddress.Hex()
+	// the simulator has no deposit contract, any contract will do for the checks
+	network.Contracts.DepositContract = simulator.SequencerContractAddress.Hex()
+	return Environment{
+		Network:     network,
+		Client:      sim.Client(),
+		Observer:    observerStub{},
+		PkFile:      path.Join(t.TempDir(), "pk.hex"),
+		BlameFolder: t.TempDir(),
+		LogsFolder:  t.TempDir(),
+	}
+}
+
+func TestPreflightPasses(t *testing.T) {
+	funding := big.NewInt(0).Mul(big.NewInt(100), big.NewInt(1e18))
+	env := newEnvironment(t, funding)
+	results := Run(context.Background(), env)
+	assert.Equal(t, Failed(results), 0)
+	assert.Equal(t, len(results), 11)
+	for _, r := range results {
+		assert.Equal(t, r.Status(), "PASS", r.Check)
+	}
+
+	var out bytes.Buffer
+	assert.NilError(t, Write(&out, results))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, len(lines), 12)
+	assert.Assert(t, strings.HasPrefix(lines[1], "rpc "))
+	assert.Assert(t, strings.Contains(out.String(), "eon 0"))
+}
+
+func TestPreflightFailures(t *testing.T) {
+	env := newEnvironment(t, big.NewInt(continuous.MinimalFunding))
+	// an existing, empty test account needs a refill, that the submit account can not pay
+	key, err := crypto.GenerateKey()
+	assert.NilError(t, err)
+	writePks(t, env.PkFile, key)
+	env.Network.Contracts.KeyBroadcast = "0x00000000000000000000000000000000000000ff"
+	env.Observer = observerStub{"validator_graffiti"}
+	env.LogsFolder = path.Join(t.TempDir(), "missing")
+
+	results := Run(context.Background(), env)
+	assert.DeepEqual(t, statuses(results), map[string]string{
+		"rpc":                         "PASS",
+		"sequencer contract":          "PASS",
+		"keyper set manager contract": "PASS",
+		"key broadcast contract":      "FAIL",
+		"deposit contract":            "PASS",
+		"eon key":                     "SKIP",
+		"test accounts":               "PASS",
+		"submit account":              "FAIL",
+		"observer db":                 "FAIL",
+		"blame folder":                "PASS",
+		"logs folder":                 "FAIL",
+	})
+	assert.Equal(t, Failed(results), 4)
+	var out bytes.Buffer
+	assert.NilError(t, Write(&out, results))
+	assert.Assert(t, strings.Contains(out.String(), "missing tables validator_graffiti"))
+	assert.Assert(t, strings.Contains(out.String(), "1 of 1 below"))
+}
+
+func TestPreflightWrongChain(t *testing.T) {
+	env := newEnvironment(t, big.NewInt(1e18))
+	env.Network.ChainID = 100
+	results := Run(context.Background(), env)
+	assert.Equal(t, results[0].Status(), "FAIL")
+	for _, r := range results[1:8] {
+		assert.Equal(t, r.Status(), "SKIP", r.Check)
+	}
+}
+
+func writePks(t *testing.T, file string, keys ...*ecdsa.PrivateKey) {
+	t.Helper()
+	var hexKeys []string
+	for _, key := range keys {
+		hexKeys = append(hexKeys, hexutil.Encode(crypto.FromECDSA(key))[2:])
+	}
+	assert.NilError(t, os.WriteFile(file, []byte(strings.Join(hexKeys, "\n")), 0o600))
+}
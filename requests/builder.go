@@ -0,0 +1,216 @@
+package requests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+const transferGasLimit = uint64(21000)
+
+// TxBuilder creates, signs and sends transactions of a configurable type.
+type TxBuilder struct {
+	// one of types.LegacyTxType, types.AccessListTxType or types.DynamicFeeTxType
+	Type uint8
+	// recipient of the transaction, the sender itself if nil
+	To    *common.Address
+	Value *big.Int
+	Data  []byte
+	// gas limit of the transaction, estimated if 0 and the transaction is not a plain transfer
+	GasLimit   uint64
+	AccessList types.AccessList
+	// computes fee cap and tip cap from the values suggested by the node. Legacy and
+	// access list transactions use the fee cap as gas price.
+	GasPriceFn utils.GasPriceFn
+}
+
+// SuggestedGasPriceFn uses the suggested gas price and tip cap as they are.
+func SuggestedGasPriceFn(suggestedGasTipCap *big.Int, suggestedGasPrice *big.Int, _ int, _ int) (utils.GasFeeCap, utils.GasTipCap) {
+	return suggestedGasPrice, suggestedGasTipCap
+}
+
+// NewTxBuilder returns a builder for a transaction of txType, that sends 1 wei to the sender itself.
+func NewTxBuilder(txType uint8) TxBuilder {
+	return TxBuilder{
+		Type:       txType,
+		Value:      big.NewInt(1),
+		GasPriceFn: SuggestedGasPriceFn,
+	}
+}
+
+// ParseTxType maps the names legacy, access-list and dynamic-fee to the transaction type.
+func ParseTxType(name string) (uint8, error) {
+	switch strings.ToLower(name) {
+	case "", "legacy":
+		return types.LegacyTxType, nil
+	case "access-list":
+		return types.AccessListTxType, nil
+	case "dynamic-fee":
+		return types.DynamicFeeTxType, nil
+	}
+	return 0, fmt.Errorf("unknown transaction type %v", name)
+}
+
+// ParseGasStrategy maps the names suggested, default, high-priority and min-tip to a GasPriceFn.
+func ParseGasStrategy(name string) (utils.GasPriceFn, error) {
+	switch strings.ToLower(name) {
+	case "", "suggested":
+		return SuggestedGasPriceFn, nil
+	case "default":
+		return utils.DefaultGasPriceFn, nil
+	case "high-priority":
+		return utils.HighPriorityGasPriceFn, nil
+	case "min-tip":
+		return utils.MinGasTipUpdateFn, nil
+	}
+	return nil, fmt.Errorf("unknown gas strategy %v", name)
+}
+
+// Build creates the unsigned transaction from `from` with the given nonce.
+func (b TxBuilder) Build(ctx context.Context, client utils.Backend, from common.Address, nonce uint64) (*types.Transaction, error) {
+	to := from
+	if b.To != nil {
+		to = *b.To
+	}
+	value := b.Value
+	if value == nil {
+		value = big.NewInt(0)
+	}
+	gasPriceFn := b.GasPriceFn
+	if gasPriceFn == nil {
+		gasPriceFn = SuggestedGasPriceFn
+	}
+	gas, err := utils.GasCalculationFromClient(ctx, client, gasPriceFn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggested gas price: %w", err)
+	}
+	gasLimit := b.GasLimit
+	if gasLimit == 0 {
+		gasLimit = transferGasLimit
+		if len(b.Data) > 0 || len(b.AccessList) > 0 {
+			gasLimit, err = client.EstimateGas(ctx, ethereum.CallMsg{
+				From:       from,
+				To:         &to,
+				Value:      value,
+				Data:       b.Data,
+				AccessList: b.AccessList,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to estimate gas: %w", err)
+			}
+		}
+	}
+
+	switch b.Type {
+	case types.LegacyTxType:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			To:       &to,
+			Value:    value,
+			Gas:      gasLimit,
+			GasPrice: gas.Fee,
+			Data:     b.Data,
+		}), nil
+	case types.AccessListTxType:
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain ID: %w", err)
+		}
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      nonce,
+			To:         &to,
+			Value:      value,
+			Gas:        gasLimit,
+			GasPrice:   gas.Fee,
+			Data:       b.Data,
+			AccessList: b.AccessList,
+		}), nil
+	case types.DynamicFeeTxType:
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain ID: %w", err)
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      nonce,
+			To:         &to,
+			Value:      value,
+			Gas:        gasLimit,
+			GasFeeCap:  gas.Fee,
+			GasTipCap:  gas.Tip,
+			Data:       b.Data,
+			AccessList: b.AccessList,
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported transaction type %v", b.Type)
+}
+
+// Sign builds the transaction with the given nonce and signs it with privateKey.
+func (b TxBuilder) Sign(ctx context.Context, client utils.Backend, privateKey *ecdsa.PrivateKey, nonce uint64) (*types.Transaction, error) {
+	tx, err := b.Build(ctx, client, crypto.PubkeyToAddress(privateKey.PublicKey), nonce)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	signedTx, err := types.SignTx(tx, types.NewLondonSigner(chainID), privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return signedTx, nil
+}
+
+// Send signs the transaction with the next pending nonce of pKey and sends it.
+func (b TxBuilder) Send(client utils.Backend, pKey string) (*types.Transaction, error) {
+	privateKey, err := crypto.HexToECDSA(pKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	log.Println("Sending transaction from: " + fromAddress.String())
+
+	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+
+	signedTx, err := b.Sign(context.Background(), client, privateKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	err = sendSigned(client, signedTx)
+	if err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+func sendSigned(client utils.Backend, signedTx *types.Transaction) error {
+	rawTxBytes, err := signedTx.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+
+	log.Printf("Signed transaction: %s\n", rawTxBytes)
+
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return fmt.Errorf("failed to send transaction: %w", err)
+	}
+
+	log.Printf("Transaction sent: %s\n", signedTx.Hash().Hex())
+	return nil
+}
@@ -0,0 +1,252 @@
+package requests
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shutter-network/nethermind-tests/utils"
+)
+
+type Outcome int
+
+const (
+	IncludedOriginal Outcome = iota + 1 // the transaction was included as sent
+	IncludedBump                        // one of the replacements with bumped fees was included
+	Cancelled                           // the cancel transaction was included
+	Failed                              // none of the transactions was included or the included one reverted
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case IncludedOriginal:
+		return "included original"
+	case IncludedBump:
+		return "included bump"
+	case Cancelled:
+		return "cancelled"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+type EscalationResult struct {
+	Outcome Outcome
+	// number of the included replacement, starting at 1
+	Bump int
+	// the included transaction, nil if nothing was included
+	Tx *types.Transaction
+}
+
+func (r EscalationResult) String() string {
+	if r.Outcome == IncludedBump {
+		return fmt.Sprintf("%v %d", r.Outcome, r.Bump)
+	}
+	return r.Outcome.String()
+}
+
+// EscalationPolicy describes how a transaction, that was not included in time, is
+// replaced: Steps times with fees raised by BumpPercent, but never above MaxGasPrice,
+// and finally by a cancel transaction. Every replacement is given StepTimeout to be included.
+type EscalationPolicy struct {
+	Steps       int
+	BumpPercent int64
+	// upper limit for gas price and fee cap, no limit if nil
+	MaxGasPrice *big.Int
+	StepTimeout time.Duration
+}
+
+// nodes reject replacements, that do not raise the fees by at least 10%
+const minBumpPercent = 10
+
+func DefaultEscalationPolicy(stepTimeout time.Duration) EscalationPolicy {
+	return EscalationPolicy{
+		Steps:       3,
+		BumpPercent: 20,
+		StepTimeout: stepTimeout,
+	}
+}
+
+// bumpFees raises fee and tip by the policy's percentage, but at least to the currently
+// suggested values. It returns false, if the fee can not be raised because of MaxGasPrice.
+func (p EscalationPolicy) bumpFees(ctx context.Context, client utils.Backend, fee, tip *big.Int) (*big.Int, *big.Int, bool, error) {
+	percent := p.BumpPercent
+	if percent < minBumpPercent {
+		percent = minBumpPercent
+	}
+	suggested, err := utils.GasCalculationFromClient(ctx, client, SuggestedGasPriceFn)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	bump := func(v *big.Int, floor *big.Int) *big.Int {
+		bumped := new(big.Int).Mul(v, big.NewInt(100+percent))
+		bumped.Div(bumped, big.NewInt(100))
+		if bumped.Cmp(v) <= 0 {
+			bumped.Add(v, big.NewInt(1))
+		}
+		if bumped.Cmp(floor) < 0 {
+			bumped.Set(floor)
+		}
+		return bumped
+	}
+	newFee := bump(fee, suggested.Fee)
+	newTip := bump(tip, suggested.Tip)
+	if p.MaxGasPrice != nil && newFee.Cmp(p.MaxGasPrice) > 0 {
+		newFee = new(big.Int).Set(p.MaxGasPrice)
+	}
+	if newTip.Cmp(newFee) > 0 {
+		newTip = new(big.Int).Set(newFee)
+	}
+	return newFee, newTip, newFee.Cmp(fee) > 0, nil
+}
+
+// replaceTx creates a transaction of the same type and nonce as tx with the given content and fees.
+func replaceTx(tx *types.Transaction, to common.Address, value *big.Int, gas uint64, data []byte, fee, tip *big.Int) (*types.Transaction, error) {
+	switch tx.Type() {
+	case types.LegacyTxType:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			To:       &to,
+			Value:    value,
+			Gas:      gas,
+			GasPrice: fee,
+			Data:     data,
+		}), nil
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			To:         &to,
+			Value:      value,
+			Gas:        gas,
+			GasPrice:   fee,
+			Data:       data,
+			AccessList: tx.AccessList(),
+		}), nil
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			To:         &to,
+			Value:      value,
+			Gas:        gas,
+			GasFeeCap:  fee,
+			GasTipCap:  tip,
+			Data:       data,
+			AccessList: tx.AccessList(),
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported transaction type %v", tx.Type())
+}
+
+// Escalate replaces tx, which was sent from pKey and not included in time, according
+// to policy until one of the sent transactions is included.
+func Escalate(client utils.Backend, pKey string, tx *types.Transaction, policy EscalationPolicy) (EscalationResult, error) {
+	ctx := context.Background()
+	privateKey, err := crypto.HexToECDSA(pKey)
+	if err != nil {
+		return EscalationResult{Outcome: Failed}, fmt.Errorf("failed to load private key: %w", err)
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return EscalationResult{Outcome: Failed}, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	signer := types.NewLondonSigner(chainID)
+
+	sent := []*types.Transaction{tx}
+	cancelIndex := -1
+	result := func(i int, receipt *types.Receipt) EscalationResult {
+		res := EscalationResult{Tx: sent[i]}
+		switch {
+		case receipt.Status == types.ReceiptStatusFailed:
+			res.Outcome = Failed
+		case i == 0:
+			res.Outcome = IncludedOriginal
+		case i == cancelIndex:
+			res.Outcome = Cancelled
+		default:
+			res.Outcome = IncludedBump
+			res.Bump = i
+		}
+		log.Printf("Nonce [%d] resolved: %v (%v)", tx.Nonce(), res, sent[i].Hash().Hex())
+		return res
+	}
+	replace := func(to common.Address, value *big.Int, gas uint64, data []byte) (bool, error) {
+		last := sent[len(sent)-1]
+		fee, tip, ok, err := policy.bumpFees(ctx, client, last.GasFeeCap(), last.GasTipCap())
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			log.Printf("Can not bump fees of nonce [%d] above the maximum gas price %v", tx.Nonce(), policy.MaxGasPrice)
+			return false, nil
+		}
+		replacement, err := replaceTx(tx, to, value, gas, data, fee, tip)
+		if err != nil {
+			return false, err
+		}
+		signedTx, err := types.SignTx(replacement, signer, privateKey)
+		if err != nil {
+			return false, fmt.Errorf("failed to sign transaction: %w", err)
+		}
+		err = sendSigned(client, signedTx)
+		if err != nil {
+			log.Printf("Replacement for nonce [%d] rejected: %v", tx.Nonce(), err)
+			return true, nil
+		}
+		sent = append(sent, signedTx)
+		return true, nil
+	}
+
+	for step := 1; step <= policy.Steps; step++ {
+		log.Printf("Bumping fees of nonce [%d], step %d/%d", tx.Nonce(), step, policy.Steps)
+		ok, err := replace(*tx.To(), tx.Value(), tx.Gas(), tx.Data())
+		if err != nil {
+			return EscalationResult{Outcome: Failed}, err
+		}
+		if !ok {
+			break
+		}
+		i, receipt, err := waitForAnyReceipt(client, sent, policy.StepTimeout)
+		if err != nil {
+			return EscalationResult{Outcome: Failed}, err
+		}
+		if receipt != nil {
+			return result(i, receipt), nil
+		}
+	}
+
+	log.Printf("Cancelling nonce [%d]", tx.Nonce())
+	before := len(sent)
+	_, err = replace(common.Address{}, big.NewInt(0), transferGasLimit, nil)
+	if err != nil {
+		return EscalationResult{Outcome: Failed}, err
+	}
+	if len(sent) > before {
+		cancelIndex = len(sent) - 1
+	}
+	i, receipt, err := waitForAnyReceipt(client, sent, policy.StepTimeout)
+	if err != nil {
+		return EscalationResult{Outcome: Failed}, err
+	}
+	if receipt != nil {
+		return result(i, receipt), nil
+	}
+
+	nonce, err := client.NonceAt(ctx, crypto.PubkeyToAddress(privateKey.PublicKey), nil)
+	if err != nil {
+		return EscalationResult{Outcome: Failed}, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	if nonce > tx.Nonce() {
+		log.Printf("Nonce [%d] was used by an unknown transaction", tx.Nonce())
+	} else {
+		log.Printf("Nonce [%d] is still pending after %d transactions", tx.Nonce(), len(sent))
+	}
+	return EscalationResult{Outcome: Failed}, nil
+}
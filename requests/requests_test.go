@@ -0,0 +1,226 @@
+package requests
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"gotest.tools/assert"
+)
+
+var _ utils.Backend = (simulated.Client)(nil)
+
+func createSimulatedBackend(t *testing.T) (*simulated.Backend, string) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	assert.NilError(t, err)
+	funding := new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: funding},
+	})
+	t.Cleanup(func() { sim.Close() })
+	return sim, hex.EncodeToString(crypto.FromECDSA(key))
+}
+
+func TestSendLegacyTxAndWaitForReceipt(t *testing.T) {
+	sim, pKey := createSimulatedBackend(t)
+	client := sim.Client()
+
+	signedTx, err := SendLegacyTx(client, pKey)
+	assert.NilError(t, err)
+	assert.Equal(t, signedTx.Type(), uint8(types.LegacyTxType))
+	sim.Commit()
+
+	receipt, err := WaitForReceipt(client, signedTx.Hash().Hex(), 5*time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, receipt.Status, types.ReceiptStatusSuccessful)
+}
+
+func TestWaitForReceiptReverted(t *testing.T) {
+	sim, pKey := createSimulatedBackend(t)
+	client := sim.Client()
+	privateKey, err := crypto.HexToECDSA(pKey)
+	assert.NilError(t, err)
+	chainID, err := client.ChainID(context.Background())
+	assert.NilError(t, err)
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	assert.NilError(t, err)
+	// a deployment, whose init code is the invalid opcode
+	tx, err := types.SignNewTx(privateKey, types.LatestSignerForChainID(chainID), &types.LegacyTx{Gas: 100000, GasPrice: gasPrice, Data: []byte{0xfe}})
+	assert.NilError(t, err)
+	assert.NilError(t, client.SendTransaction(context.Background(), tx))
+	sim.Commit()
+
+	receipt, err := WaitForReceipt(client, tx.Hash().Hex(), 5*time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, receipt.Status, types.ReceiptStatusFailed)
+}
+
+func TestWaitForReceiptTimeout(t *testing.T) {
+	sim, _ := createSimulatedBackend(t)
+	sim.Commit()
+
+	receipt, err := WaitForReceipt(sim.Client(), common.Hash{0x1}.Hex(), 100*time.Millisecond)
+	assert.NilError(t, err)
+	assert.Assert(t, receipt == nil)
+}
+
+func TestCancelTx(t *testing.T) {
+	sim, pKey := createSimulatedBackend(t)
+	client := sim.Client()
+	privateKey, err := crypto.HexToECDSA(pKey)
+	assert.NilError(t, err)
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	err = CancelTx(client, pKey, 0)
+	assert.NilError(t, err)
+	sim.Commit()
+
+	nonce, err := client.NonceAt(context.Background(), address, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(1))
+}
+
+func TestTxBuilderTypes(t *testing.T) {
+	sim, pKey := createSimulatedBackend(t)
+	client := sim.Client()
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	for _, name := range []string{"legacy", "access-list", "dynamic-fee"} {
+		txType, err := ParseTxType(name)
+		assert.NilError(t, err)
+		builder := NewTxBuilder(txType)
+		builder.To = &recipient
+		builder.Value = big.NewInt(5)
+		builder.Data = []byte{0x1, 0x2}
+		builder.GasPriceFn = utils.DefaultGasPriceFn
+
+		signedTx, err := builder.Send(client, pKey)
+		assert.NilError(t, err)
+		sim.Commit()
+
+		assert.Equal(t, signedTx.Type(), txType, name)
+		assert.Equal(t, *signedTx.To(), recipient, name)
+		assert.Assert(t, signedTx.Gas() > uint64(21000), "gas limit of %v tx with calldata was not estimated", name)
+		receipt, err := client.TransactionReceipt(context.Background(), signedTx.Hash())
+		assert.NilError(t, err)
+		assert.Equal(t, receipt.Status, types.ReceiptStatusSuccessful, name)
+	}
+	balance, err := client.BalanceAt(context.Background(), recipient, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, balance.Int64(), int64(15))
+}
+
+func TestParseTxConfig(t *testing.T) {
+	_, err := ParseTxType("blob")
+	assert.ErrorContains(t, err, "unknown transaction type")
+	txType, err := ParseTxType("")
+	assert.NilError(t, err)
+	assert.Equal(t, txType, uint8(types.LegacyTxType))
+
+	_, err = ParseGasStrategy("cheap")
+	assert.ErrorContains(t, err, "unknown gas strategy")
+	for _, name := range []string{"", "suggested", "default", "high-priority", "min-tip"} {
+		fn, err := ParseGasStrategy(name)
+		assert.NilError(t, err)
+		assert.Assert(t, fn != nil)
+	}
+}
+
+// sendStuckTx sends a transaction with a gas price below the base fee, which stays
+// in the pool until it is replaced.
+func sendStuckTx(t *testing.T, client simulated.Client, pKey string, txType uint8) *types.Transaction {
+	t.Helper()
+	privateKey, err := crypto.HexToECDSA(pKey)
+	assert.NilError(t, err)
+	builder := NewTxBuilder(txType)
+	builder.GasPriceFn = func(_ *big.Int, _ *big.Int, _ int, _ int) (utils.GasFeeCap, utils.GasTipCap) {
+		return big.NewInt(1), big.NewInt(1)
+	}
+	signedTx, err := builder.Sign(context.Background(), client, privateKey, 0)
+	assert.NilError(t, err)
+	assert.NilError(t, client.SendTransaction(context.Background(), signedTx))
+	return signedTx
+}
+
+// commitContinuously seals a block every 50ms until the test ends.
+func commitContinuously(t *testing.T, sim *simulated.Backend) {
+	t.Helper()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(50 * time.Millisecond):
+				sim.Commit()
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+func setReceiptPollInterval(t *testing.T, interval time.Duration) {
+	previous := receiptPollInterval
+	receiptPollInterval = interval
+	t.Cleanup(func() { receiptPollInterval = previous })
+}
+
+func TestEscalateIncludesBump(t *testing.T) {
+	setReceiptPollInterval(t, 50*time.Millisecond)
+	for _, txType := range []uint8{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType} {
+		sim, pKey := createSimulatedBackend(t)
+		stuck := sendStuckTx(t, sim.Client(), pKey, txType)
+		commitContinuously(t, sim)
+
+		result, err := Escalate(sim.Client(), pKey, stuck, DefaultEscalationPolicy(time.Second))
+		assert.NilError(t, err)
+		assert.Equal(t, result.Outcome, IncludedBump)
+		assert.Equal(t, result.Bump, 1)
+		assert.Equal(t, result.String(), "included bump 1")
+		assert.Equal(t, result.Tx.Type(), txType)
+		assert.Equal(t, result.Tx.Nonce(), stuck.Nonce())
+		assert.DeepEqual(t, result.Tx.To(), stuck.To())
+	}
+}
+
+func TestEscalateCancels(t *testing.T) {
+	setReceiptPollInterval(t, 50*time.Millisecond)
+	sim, pKey := createSimulatedBackend(t)
+	stuck := sendStuckTx(t, sim.Client(), pKey, types.DynamicFeeTxType)
+	commitContinuously(t, sim)
+
+	policy := DefaultEscalationPolicy(time.Second)
+	policy.Steps = 0
+	result, err := Escalate(sim.Client(), pKey, stuck, policy)
+	assert.NilError(t, err)
+	assert.Equal(t, result.Outcome, Cancelled)
+	assert.Equal(t, *result.Tx.To(), common.Address{})
+	assert.Equal(t, result.Tx.Value().Int64(), int64(0))
+}
+
+func TestEscalateRespectsMaxGasPrice(t *testing.T) {
+	setReceiptPollInterval(t, 50*time.Millisecond)
+	sim, pKey := createSimulatedBackend(t)
+	stuck := sendStuckTx(t, sim.Client(), pKey, types.LegacyTxType)
+	commitContinuously(t, sim)
+
+	policy := DefaultEscalationPolicy(200 * time.Millisecond)
+	policy.MaxGasPrice = big.NewInt(2)
+	result, err := Escalate(sim.Client(), pKey, stuck, policy)
+	assert.NilError(t, err)
+	assert.Equal(t, result.Outcome, Failed)
+	assert.Assert(t, result.Tx == nil)
+}
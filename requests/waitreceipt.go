@@ -2,22 +2,19 @@ package requests
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shutter-network/nethermind-tests/utils"
 	"log"
 	"time"
 )
 
-func WaitForReceipt(clientURL string, txHash string, timeout time.Duration) (bool, error) {
-	client, err := ethclient.Dial(clientURL)
-	if err != nil {
-		return false, fmt.Errorf("failed to connect to client: %w", err)
-	}
+var receiptPollInterval = 1 * time.Second
 
+// WaitForReceipt returns the receipt of the transaction with txHash, also if it reverted.
+// The receipt is nil, if the transaction was not mined within timeout.
+func WaitForReceipt(client utils.Backend, txHash string, timeout time.Duration) (*types.Receipt, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -26,21 +23,50 @@ func WaitForReceipt(clientURL string, txHash string, timeout time.Duration) (boo
 		if err == nil {
 			if receipt.Status == types.ReceiptStatusFailed {
 				log.Printf("Transaction failed: %s", txHash)
-				return false, nil
+			} else {
+				log.Printf("Transaction succeeded: %s", txHash)
 			}
-			log.Printf("Transaction succeeded: %s", txHash)
-			return true, nil
+			return receipt, nil
 		}
 
-		if !errors.Is(err, ethereum.NotFound) {
-			return false, fmt.Errorf("receipt retrieval failed: %w", err)
+		if !utils.IsReceiptPending(err) {
+			return nil, fmt.Errorf("receipt retrieval failed: %w", err)
 		}
 
 		select {
 		case <-ctx.Done():
 			log.Printf("Timeout waiting for transaction receipt: %s", txHash)
-			return false, nil
-		case <-time.After(1 * time.Second):
+			return nil, nil
+		case <-time.After(receiptPollInterval):
+			// Wait before retrying
+		}
+	}
+}
+
+// waitForAnyReceipt waits for the receipt of one of txs. It returns a nil receipt, if
+// none of them was included within timeout.
+func waitForAnyReceipt(client utils.Backend, txs []*types.Transaction, timeout time.Duration) (int, *types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		for i, tx := range txs {
+			receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+			if err == nil {
+				return i, receipt, nil
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			if !utils.IsReceiptPending(err) {
+				return -1, nil, fmt.Errorf("receipt retrieval failed: %w", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return -1, nil, nil
+		case <-time.After(receiptPollInterval):
 			// Wait before retrying
 		}
 	}
@@ -0,0 +1,83 @@
+package simulator
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// assembler is a minimal EVM assembler with support for jump labels.
+// It is only meant for the small runtime stubs in contracts.go.
+type assembler struct {
+	code   []byte
+	labels map[string]int
+	refs   map[int]string
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		labels: make(map[string]int),
+		refs:   make(map[int]string),
+	}
+}
+
+func (a *assembler) op(ops ...vm.OpCode) *assembler {
+	for _, op := range ops {
+		a.code = append(a.code, byte(op))
+	}
+	return a
+}
+
+// push emits the shortest PUSH instruction for v.
+func (a *assembler) push(v uint64) *assembler {
+	return a.pushBytes(new(big.Int).SetUint64(v).Bytes())
+}
+
+func (a *assembler) pushBytes(b []byte) *assembler {
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	if len(b) > 32 {
+		panic(fmt.Sprintf("can not push %d bytes", len(b)))
+	}
+	a.code = append(a.code, byte(vm.PUSH1)+byte(len(b)-1))
+	a.code = append(a.code, b...)
+	return a
+}
+
+// pushLabel emits a PUSH2 of the position of label, which is resolved in bytes().
+func (a *assembler) pushLabel(label string) *assembler {
+	a.code = append(a.code, byte(vm.PUSH2))
+	a.refs[len(a.code)] = label
+	a.code = append(a.code, 0, 0)
+	return a
+}
+
+func (a *assembler) jump(label string) *assembler {
+	return a.pushLabel(label).op(vm.JUMP)
+}
+
+func (a *assembler) jumpi(label string) *assembler {
+	return a.pushLabel(label).op(vm.JUMPI)
+}
+
+// label marks the current position as jump destination.
+func (a *assembler) label(label string) *assembler {
+	a.labels[label] = len(a.code)
+	return a.op(vm.JUMPDEST)
+}
+
+func (a *assembler) bytes() []byte {
+	code := make([]byte, len(a.code))
+	copy(code, a.code)
+	for pos, label := range a.refs {
+		target, ok := a.labels[label]
+		if !ok {
+			panic(fmt.Sprintf("undefined label %v", label))
+		}
+		code[pos] = byte(target >> 8)
+		code[pos+1] = byte(target)
+	}
+	return code
+}
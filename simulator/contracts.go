@@ -0,0 +1,212 @@
+package simulator
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	keybroadcastcontract "github.com/shutter-network/contracts/v2/bindings/keybroadcastcontract"
+	keypersetmanager "github.com/shutter-network/contracts/v2/bindings/keypersetmanager"
+	sequencerBindings "github.com/shutter-network/contracts/v2/bindings/sequencer"
+)
+
+// The generated bindings in shutter-network/contracts come without bytecode, so the
+// simulator installs hand assembled runtime stubs instead. They implement the parts of
+// the contract ABIs, that are used by this repository, with the same calldata and event
+// encoding as the solidity contracts. Access control is reduced to a single admin.
+
+// slot offset for the keyper set contract addresses in the keyper set manager stub
+const keyperSetAddressSlot = 128
+
+type methods struct {
+	abi *abi.ABI
+}
+
+func loadABI(metaData interface{ GetAbi() (*abi.ABI, error) }) methods {
+	parsed, err := metaData.GetAbi()
+	if err != nil {
+		panic(err)
+	}
+	return methods{abi: parsed}
+}
+
+func (m methods) selector(name string) []byte {
+	return m.abi.Methods[name].ID
+}
+
+func (m methods) topic(name string) []byte {
+	return m.abi.Events[name].ID.Bytes()
+}
+
+// dispatch jumps to the label of the called method or reverts. The selector is left
+// on the stack.
+func dispatch(a *assembler, m methods, names ...string) {
+	a.push(0).op(vm.CALLDATALOAD).push(0xe0).op(vm.SHR)
+	for _, name := range names {
+		a.op(vm.DUP1).pushBytes(m.selector(name)).op(vm.EQ).jumpi(name)
+	}
+	a.jump("revert")
+}
+
+func revert(a *assembler) {
+	a.label("revert").push(0).op(vm.DUP1, vm.REVERT)
+}
+
+func requireAdmin(a *assembler, admin common.Address) {
+	a.op(vm.CALLER).pushBytes(admin.Bytes()).op(vm.EQ, vm.ISZERO).jumpi("revert")
+}
+
+// returnWord returns the top of the stack as single abi encoded word.
+func returnWord(a *assembler) {
+	a.push(0).op(vm.MSTORE).push(0x20).push(0).op(vm.RETURN)
+}
+
+// sequencerCode emits TransactionSubmitted for every submitEncryptedTransaction call
+// and keeps a transaction counter per eon in storage slot `eon`.
+func sequencerCode() []byte {
+	m := loadABI(sequencerBindings.SequencerMetaData)
+	a := newAssembler()
+	dispatch(a, m, "submitEncryptedTransaction", "getTxCountForEon")
+
+	a.label("submitEncryptedTransaction").op(vm.POP)
+	// eon, txIndex
+	a.push(0x04).op(vm.CALLDATALOAD)
+	a.op(vm.DUP1).push(0x00).op(vm.MSTORE)
+	a.op(vm.DUP1, vm.SLOAD)
+	a.op(vm.DUP1).push(0x20).op(vm.MSTORE)
+	a.push(1).op(vm.ADD, vm.SWAP1, vm.SSTORE)
+	// identityPrefix, sender, offset of encryptedTransaction
+	a.push(0x24).op(vm.CALLDATALOAD).push(0x40).op(vm.MSTORE)
+	a.op(vm.CALLER).push(0x60).op(vm.MSTORE)
+	a.push(0xc0).push(0x80).op(vm.MSTORE)
+	// gasLimit, which has to be paid for at the current base fee
+	a.push(0x64).op(vm.CALLDATALOAD)
+	a.op(vm.DUP1).push(0xa0).op(vm.MSTORE)
+	a.op(vm.BASEFEE, vm.MUL, vm.CALLVALUE, vm.LT).jumpi("revert")
+	// length and content of encryptedTransaction
+	a.push(0x84).op(vm.CALLDATASIZE, vm.SUB)
+	a.op(vm.DUP1).push(0x84).push(0xc0).op(vm.CALLDATACOPY)
+	a.push(0xc0).op(vm.ADD)
+	a.pushBytes(m.topic("TransactionSubmitted")).op(vm.SWAP1).push(0).op(vm.LOG1, vm.STOP)
+
+	a.label("getTxCountForEon").op(vm.POP)
+	a.push(0x04).op(vm.CALLDATALOAD, vm.SLOAD)
+	returnWord(a)
+
+	revert(a)
+	return a.bytes()
+}
+
+// keyperSetManagerCode stores the number of keyper sets in slot 0, the activation block
+// of keyper set i in slot 1+i and its contract address in slot (1<<128)+i.
+func keyperSetManagerCode(admin common.Address) []byte {
+	m := loadABI(keypersetmanager.KeypersetmanagerMetaData)
+	a := newAssembler()
+	dispatch(a, m,
+		"getNumKeyperSets",
+		"getKeyperSetIndexByBlock",
+		"getKeyperSetActivationBlock",
+		"getKeyperSetAddress",
+		"addKeyperSet",
+	)
+
+	a.label("getNumKeyperSets").op(vm.POP)
+	a.push(0).op(vm.SLOAD)
+	returnWord(a)
+
+	a.label("getKeyperSetIndexByBlock").op(vm.POP)
+	a.push(0x04).op(vm.CALLDATALOAD)
+	a.push(0).op(vm.SLOAD)
+	// stack: blockNumber, i; checks keyper set i-1 for i = n..1
+	a.label("indexLoop")
+	a.op(vm.DUP1, vm.ISZERO).jumpi("revert")
+	a.op(vm.DUP1, vm.SLOAD, vm.DUP3, vm.LT, vm.ISZERO).jumpi("indexFound")
+	a.push(1).op(vm.SWAP1, vm.SUB)
+	a.jump("indexLoop")
+	a.label("indexFound")
+	a.push(1).op(vm.SWAP1, vm.SUB)
+	returnWord(a)
+
+	a.label("getKeyperSetActivationBlock").op(vm.POP)
+	a.push(0x04).op(vm.CALLDATALOAD)
+	a.op(vm.DUP1).push(0).op(vm.SLOAD, vm.GT, vm.ISZERO).jumpi("revert")
+	a.push(1).op(vm.ADD, vm.SLOAD)
+	returnWord(a)
+
+	a.label("getKeyperSetAddress").op(vm.POP)
+	a.push(0x04).op(vm.CALLDATALOAD)
+	a.op(vm.DUP1).push(0).op(vm.SLOAD, vm.GT, vm.ISZERO).jumpi("revert")
+	a.push(1).push(keyperSetAddressSlot).op(vm.SHL, vm.ADD, vm.SLOAD)
+	returnWord(a)
+
+	a.label("addKeyperSet").op(vm.POP)
+	requireAdmin(a, admin)
+	a.push(0).op(vm.SLOAD)
+	a.push(0x04).op(vm.CALLDATALOAD, vm.DUP2).push(1).op(vm.ADD, vm.SSTORE)
+	a.push(0x24).op(vm.CALLDATALOAD, vm.DUP2).push(1).push(keyperSetAddressSlot).op(vm.SHL, vm.ADD, vm.SSTORE)
+	a.op(vm.DUP1).push(1).op(vm.ADD).push(0).op(vm.SSTORE)
+	// KeyperSetAdded(activationBlock, keyperSetContract, members = [], threshold = 1, eon)
+	a.push(0x04).op(vm.CALLDATALOAD).push(0x00).op(vm.MSTORE)
+	a.push(0x24).op(vm.CALLDATALOAD).push(0x20).op(vm.MSTORE)
+	a.push(0xa0).push(0x40).op(vm.MSTORE)
+	a.push(1).push(0x60).op(vm.MSTORE)
+	a.push(0x80).op(vm.MSTORE)
+	a.push(0).push(0xa0).op(vm.MSTORE)
+	a.pushBytes(m.topic("KeyperSetAdded")).push(0xc0).push(0).op(vm.LOG1, vm.STOP)
+
+	revert(a)
+	return a.bytes()
+}
+
+// keyBroadcastContractCode stores the length of the key for an eon in slot eon<<128
+// and the key itself in the following slots.
+func keyBroadcastContractCode(admin common.Address) []byte {
+	m := loadABI(keybroadcastcontract.KeybroadcastcontractMetaData)
+	a := newAssembler()
+	dispatch(a, m, "getEonKey", "broadcastEonKey")
+
+	a.label("getEonKey").op(vm.POP)
+	a.push(0x04).op(vm.CALLDATALOAD).push(128).op(vm.SHL)
+	a.push(0x20).push(0).op(vm.MSTORE)
+	a.op(vm.DUP1, vm.SLOAD, vm.DUP1).push(0x20).op(vm.MSTORE)
+	a.push(31).op(vm.ADD).push(5).op(vm.SHR)
+	a.push(0)
+	// stack: base, words, j
+	a.label("getLoop")
+	a.op(vm.DUP2, vm.DUP2, vm.LT, vm.ISZERO).jumpi("getDone")
+	a.op(vm.DUP1, vm.DUP4, vm.ADD).push(1).op(vm.ADD, vm.SLOAD)
+	a.op(vm.DUP2).push(5).op(vm.SHL).push(0x40).op(vm.ADD, vm.MSTORE)
+	a.push(1).op(vm.ADD)
+	a.jump("getLoop")
+	a.label("getDone")
+	a.op(vm.POP).push(5).op(vm.SHL).push(0x40).op(vm.ADD)
+	a.push(0).op(vm.RETURN)
+
+	a.label("broadcastEonKey").op(vm.POP)
+	requireAdmin(a, admin)
+	a.push(0x04).op(vm.CALLDATALOAD).push(128).op(vm.SHL)
+	a.op(vm.DUP1, vm.SLOAD).jumpi("revert")
+	a.push(0x44).op(vm.CALLDATALOAD)
+	a.op(vm.DUP1, vm.ISZERO).jumpi("revert")
+	a.op(vm.DUP1, vm.DUP3, vm.SSTORE)
+	a.push(31).op(vm.ADD).push(5).op(vm.SHR)
+	a.push(0)
+	// stack: base, words, j
+	a.label("storeLoop")
+	a.op(vm.DUP2, vm.DUP2, vm.LT, vm.ISZERO).jumpi("storeDone")
+	a.op(vm.DUP1).push(5).op(vm.SHL).push(0x64).op(vm.ADD, vm.CALLDATALOAD)
+	a.op(vm.DUP2, vm.DUP5, vm.ADD).push(1).op(vm.ADD, vm.SSTORE)
+	a.push(1).op(vm.ADD)
+	a.jump("storeLoop")
+	a.label("storeDone")
+	a.op(vm.POP, vm.POP, vm.POP)
+	// EonKeyBroadcast(eon, key)
+	a.push(0x04).op(vm.CALLDATALOAD).push(0x00).op(vm.MSTORE)
+	a.push(0x40).push(0x20).op(vm.MSTORE)
+	a.push(0x44).op(vm.CALLDATASIZE, vm.SUB)
+	a.op(vm.DUP1).push(0x44).push(0x40).op(vm.CALLDATACOPY)
+	a.push(0x40).op(vm.ADD)
+	a.pushBytes(m.topic("EonKeyBroadcast")).op(vm.SWAP1).push(0).op(vm.LOG1, vm.STOP)
+
+	revert(a)
+	return a.bytes()
+}
@@ -0,0 +1,294 @@
+// Package simulator runs an in-process shutter system on top of go-ethereum's
+// simulated backend: the shutter contracts, a single keyper that releases decryption
+// keys for every submitted identity and a block builder that includes the decrypted
+// transactions in the block following their submission.
+package simulator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	keybroadcastcontract "github.com/shutter-network/contracts/v2/bindings/keybroadcastcontract"
+	keypersetmanager "github.com/shutter-network/contracts/v2/bindings/keypersetmanager"
+	sequencerBindings "github.com/shutter-network/contracts/v2/bindings/sequencer"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"github.com/shutter-network/shutter/shlib/shcrypto"
+)
+
+// DefaultEncryptedGasLimit is the maximum gas, that decrypted transactions may use per block.
+const DefaultEncryptedGasLimit = uint64(1_000_000)
+
+var (
+	SequencerContractAddress        = common.HexToAddress("0x5e0000000000000000000000000000000000000a")
+	KeyperSetManagerContractAddress = common.HexToAddress("0x5e0000000000000000000000000000000000000b")
+	KeyBroadcastContractAddress     = common.HexToAddress("0x5e0000000000000000000000000000000000000c")
+)
+
+type Simulator struct {
+	backend           *simulated.Backend
+	client            simulated.Client
+	admin             *utils.Account
+	keys              map[uint64]*shcrypto.TestKeyGen
+	pending           []*sequencerBindings.SequencerTransactionSubmitted
+	lastProcessed     uint64
+	EncryptedGasLimit uint64
+	Contracts         utils.Contracts
+	mu                sync.Mutex
+	stop              chan struct{}
+	done              chan struct{}
+}
+
+// New creates a simulated chain with the given genesis allocation, installs the
+// shutter contracts and broadcasts the key for eon 0.
+func New(alloc types.GenesisAlloc) (*Simulator, error) {
+	adminKey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	adminAddress := crypto.PubkeyToAddress(adminKey.PublicKey)
+	genesis := types.GenesisAlloc{
+		adminAddress:                    {Balance: new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))},
+		SequencerContractAddress:        {Code: sequencerCode(), Balance: big.NewInt(0)},
+		KeyperSetManagerContractAddress: {Code: keyperSetManagerCode(adminAddress), Balance: big.NewInt(0)},
+		KeyBroadcastContractAddress:     {Code: keyBroadcastContractCode(adminAddress), Balance: big.NewInt(0)},
+	}
+	for address, account := range alloc {
+		genesis[address] = account
+	}
+	backend := simulated.NewBackend(genesis)
+	sim := &Simulator{
+		backend:           backend,
+		client:            backend.Client(),
+		keys:              make(map[uint64]*shcrypto.TestKeyGen),
+		EncryptedGasLimit: DefaultEncryptedGasLimit,
+	}
+	chainID, err := sim.client.ChainID(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	admin, err := utils.AccountFromPrivateKey(adminKey, types.LatestSignerForChainID(chainID))
+	if err != nil {
+		return nil, err
+	}
+	admin.Nonces = utils.NewNonceManager(sim.client)
+	sim.admin = &admin
+
+	sim.Contracts.SequencerContractAddress = SequencerContractAddress
+	sim.Contracts.Sequencer, err = sequencerBindings.NewSequencer(SequencerContractAddress, sim.client)
+	if err != nil {
+		return nil, err
+	}
+	sim.Contracts.KeyperSetManager, err = keypersetmanager.NewKeypersetmanager(KeyperSetManagerContractAddress, sim.client)
+	if err != nil {
+		return nil, err
+	}
+	sim.Contracts.KeyBroadcastContract, err = keybroadcastcontract.NewKeybroadcastcontract(KeyBroadcastContractAddress, sim.client)
+	if err != nil {
+		return nil, err
+	}
+	_, err = sim.AddEon(1)
+	if err != nil {
+		return nil, err
+	}
+	sim.Commit()
+	return sim, nil
+}
+
+// Client returns a client for the simulated chain.
+func (sim *Simulator) Client() utils.Backend {
+	return sim.client
+}
+
+// AddEon generates a new eon key pair, registers a keyper set that activates at
+// activationBlock and broadcasts the eon key. The transactions are part of the next block.
+func (sim *Simulator) AddEon(activationBlock uint64) (uint64, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	keyGen, err := shcrypto.NewTestKeyGen()
+	if err != nil {
+		return 0, err
+	}
+	eon, err := sim.Contracts.KeyperSetManager.GetNumKeyperSets(&bind.CallOpts{Pending: true})
+	if err != nil {
+		return 0, err
+	}
+	opts, err := sim.admin.Opts()
+	if err != nil {
+		return 0, err
+	}
+	_, err = sim.Contracts.KeyperSetManager.AddKeyperSet(opts, activationBlock, sim.admin.Address)
+	if err != nil {
+		return 0, fmt.Errorf("could not add keyper set %v", err)
+	}
+	opts, err = sim.admin.Opts()
+	if err != nil {
+		return 0, err
+	}
+	_, err = sim.Contracts.KeyBroadcastContract.BroadcastEonKey(opts, eon, keyGen.EonPublicKey.Marshal())
+	if err != nil {
+		return 0, fmt.Errorf("could not broadcast eon key %v", err)
+	}
+	sim.keys[eon] = keyGen
+	log.Printf("simulator: eon %v activates at block %v\n", eon, activationBlock)
+	return eon, nil
+}
+
+// DecryptionKey returns the epoch secret key for the identity derived from
+// identityPrefix and sender.
+func (sim *Simulator) DecryptionKey(eon uint64, identityPrefix shcrypto.Block, sender common.Address) (*shcrypto.EpochSecretKey, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.epochSecretKey(eon, identityPrefix, sender)
+}
+
+func (sim *Simulator) epochSecretKey(eon uint64, identityPrefix shcrypto.Block, sender common.Address) (*shcrypto.EpochSecretKey, error) {
+	keyGen, ok := sim.keys[eon]
+	if !ok {
+		return nil, fmt.Errorf("unknown eon %v", eon)
+	}
+	return keyGen.ComputeEpochSecretKey(utils.ComputeIdentity(identityPrefix[:], sender))
+}
+
+// Commit collects the transactions submitted to the sequencer since the last call,
+// sends the decrypted transactions to the pool and seals the next block.
+// Submissions exceeding the encrypted gas limit are carried over to the next block.
+func (sim *Simulator) Commit() common.Hash {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	err := sim.collectSubmissions()
+	if err != nil {
+		log.Println("simulator: could not collect submissions", err)
+	}
+	sim.releaseDecryptedTransactions()
+	return sim.backend.Commit()
+}
+
+func (sim *Simulator) collectSubmissions() error {
+	head, err := sim.client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	if head <= sim.lastProcessed {
+		return nil
+	}
+	it, err := sim.Contracts.Sequencer.FilterTransactionSubmitted(&bind.FilterOpts{
+		Start: sim.lastProcessed + 1,
+		End:   &head,
+	})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		sim.pending = append(sim.pending, it.Event)
+	}
+	if it.Error() != nil {
+		return it.Error()
+	}
+	sim.lastProcessed = head
+	return nil
+}
+
+func (sim *Simulator) releaseDecryptedTransactions() {
+	var gasUsed uint64
+	for len(sim.pending) > 0 {
+		ev := sim.pending[0]
+		if gasUsed+ev.GasLimit.Uint64() > sim.EncryptedGasLimit && gasUsed > 0 {
+			break
+		}
+		sim.pending = sim.pending[1:]
+		if ev.GasLimit.Uint64() > sim.EncryptedGasLimit {
+			log.Printf("simulator: dropping submission %v of eon %v: gas limit %v too high\n", ev.TxIndex, ev.Eon, ev.GasLimit)
+			continue
+		}
+		gasUsed += ev.GasLimit.Uint64()
+		tx, err := sim.decrypt(ev)
+		if err != nil {
+			log.Printf("simulator: dropping submission %v of eon %v: %v\n", ev.TxIndex, ev.Eon, err)
+			continue
+		}
+		err = sim.client.SendTransaction(context.Background(), tx)
+		if err != nil {
+			log.Printf("simulator: decrypted tx %v rejected: %v\n", tx.Hash().Hex(), err)
+		}
+	}
+}
+
+func (sim *Simulator) decrypt(ev *sequencerBindings.SequencerTransactionSubmitted) (*types.Transaction, error) {
+	key, err := sim.epochSecretKey(ev.Eon, ev.IdentityPrefix, ev.Sender)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := new(shcrypto.EncryptedMessage)
+	err = encrypted.Unmarshal(ev.EncryptedTransaction)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal encrypted transaction %v", err)
+	}
+	decrypted, err := encrypted.Decrypt(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %v", err)
+	}
+	tx := new(types.Transaction)
+	err = tx.UnmarshalBinary(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode transaction %v", err)
+	}
+	if tx.Gas() > ev.GasLimit.Uint64() {
+		return nil, fmt.Errorf("transaction gas %v exceeds submitted gas limit %v", tx.Gas(), ev.GasLimit)
+	}
+	return tx, nil
+}
+
+// Start seals a new block every period until Stop is called.
+func (sim *Simulator) Start(period time.Duration) {
+	sim.stop = make(chan struct{})
+	sim.done = make(chan struct{})
+	go func() {
+		defer close(sim.done)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sim.stop:
+				return
+			case <-ticker.C:
+				sim.Commit()
+			}
+		}
+	}()
+}
+
+func (sim *Simulator) Stop() {
+	if sim.stop == nil {
+		return
+	}
+	close(sim.stop)
+	<-sim.done
+	sim.stop = nil
+}
+
+// Close stops block production and shuts down the simulated chain.
+func (sim *Simulator) Close() error {
+	sim.Stop()
+	return sim.backend.Close()
+}
+
+// FundedKey creates a new private key with balance for the genesis allocation.
+func FundedKey(alloc types.GenesisAlloc, balance *big.Int) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	alloc[crypto.PubkeyToAddress(key.PublicKey)] = types.Account{Balance: balance}
+	return key, nil
+}
@@ -0,0 +1,198 @@
+package simulator
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shutter-network/nethermind-tests/utils"
+	"github.com/shutter-network/shutter/shlib/shcrypto"
+	"gotest.tools/assert"
+)
+
+const keyperSetChangeLookAhead = 2
+
+// createSimulator returns a running simulator and two funded accounts,
+// the first for submitting to the sequencer, the second for the inner transactions.
+func createSimulator(t *testing.T) (*Simulator, *utils.Account, *utils.Account) {
+	t.Helper()
+	alloc := types.GenesisAlloc{}
+	submitKey, err := FundedKey(alloc, big.NewInt(1e18))
+	assert.NilError(t, err)
+	transactKey, err := FundedKey(alloc, big.NewInt(1e18))
+	assert.NilError(t, err)
+	sim, err := New(alloc)
+	assert.NilError(t, err)
+	t.Cleanup(func() { sim.Close() })
+	chainID, err := sim.Client().ChainID(context.Background())
+	assert.NilError(t, err)
+	submitter, err := utils.AccountFromPrivateKey(submitKey, types.LatestSignerForChainID(chainID))
+	assert.NilError(t, err)
+	transacter, err := utils.AccountFromPrivateKey(transactKey, types.LatestSignerForChainID(chainID))
+	assert.NilError(t, err)
+	nonces := utils.NewNonceManager(sim.Client())
+	submitter.Nonces = nonces
+	transacter.Nonces = nonces
+	return sim, &submitter, &transacter
+}
+
+func submit(t *testing.T, sim *Simulator, submitter, account *utils.Account, gasLimit uint64) (*types.Transaction, *types.Transaction) {
+	t.Helper()
+	client := sim.Client()
+	ctx := context.Background()
+	chainID, err := client.ChainID(ctx)
+	assert.NilError(t, err)
+	gas, err := utils.GasCalculationFromClient(ctx, client, utils.DefaultGasPriceFn)
+	assert.NilError(t, err)
+	nonce, err := account.NextNonce()
+	assert.NilError(t, err)
+	innerTx, err := account.Sign(account.Address, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasFeeCap: gas.Fee,
+		GasTipCap: gas.Tip,
+		Gas:       gasLimit,
+		To:        &account.Address,
+		Value:     big.NewInt(1),
+	}))
+	assert.NilError(t, err)
+	eon, eonKey, err := utils.GetEonKey(ctx, client, sim.Contracts.KeyperSetManager, sim.Contracts.KeyBroadcastContract, keyperSetChangeLookAhead)
+	assert.NilError(t, err)
+	prefix, err := shcrypto.RandomSigma(cryptorand.Reader)
+	assert.NilError(t, err)
+	sigma, err := shcrypto.RandomSigma(cryptorand.Reader)
+	assert.NilError(t, err)
+	buff, err := innerTx.MarshalBinary()
+	assert.NilError(t, err)
+	encrypted := shcrypto.Encrypt(buff, eonKey, utils.ComputeIdentity(prefix[:], submitter.Address), sigma)
+
+	opts, err := submitter.Opts()
+	assert.NilError(t, err)
+	opts.Value = new(big.Int).Sub(innerTx.Cost(), innerTx.Value())
+	outerTx, err := sim.Contracts.Sequencer.SubmitEncryptedTransaction(opts, eon, prefix, encrypted.Marshal(), new(big.Int).SetUint64(innerTx.Gas()))
+	assert.NilError(t, err)
+	return outerTx, innerTx
+}
+
+func receiptBlock(t *testing.T, sim *Simulator, tx *types.Transaction) uint64 {
+	t.Helper()
+	receipt, err := sim.Client().TransactionReceipt(context.Background(), tx.Hash())
+	assert.NilError(t, err)
+	assert.Equal(t, receipt.Status, types.ReceiptStatusSuccessful)
+	return receipt.BlockNumber.Uint64()
+}
+
+func TestEonKey(t *testing.T) {
+	sim, _, _ := createSimulator(t)
+	eon, eonKey, err := utils.GetEonKey(context.Background(), sim.Client(), sim.Contracts.KeyperSetManager, sim.Contracts.KeyBroadcastContract, keyperSetChangeLookAhead)
+	assert.NilError(t, err)
+	assert.Equal(t, eon, uint64(0))
+	assert.Assert(t, eonKey.Equal(sim.keys[0].EonPublicKey))
+}
+
+func TestEonKeyService(t *testing.T) {
+	sim, _, _ := createSimulator(t)
+	client := sim.Client()
+	service, err := utils.NewEonKeyService(client, sim.Contracts.KeyperSetManager, sim.Contracts.KeyBroadcastContract, keyperSetChangeLookAhead)
+	assert.NilError(t, err)
+	defer service.Close()
+
+	head, err := client.BlockNumber(context.Background())
+	assert.NilError(t, err)
+	eon, eonKey, err := service.EonKeyForBlock(head)
+	assert.NilError(t, err)
+	assert.Equal(t, eon, uint64(0))
+	assert.Assert(t, eonKey.Equal(sim.keys[0].EonPublicKey))
+
+	activationBlock := head + 10
+	_, err = sim.AddEon(activationBlock)
+	assert.NilError(t, err)
+	sim.Commit()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(service.History()) < 2 || service.History()[1].Key == nil {
+		assert.Assert(t, time.Now().Before(deadline), "eon events were not received")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	history := service.History()
+	assert.Equal(t, history[1].ActivationBlock, activationBlock)
+	assert.Equal(t, history[1].KeyperSet, sim.admin.Address)
+	eon, _, err = service.EonKeyForBlock(activationBlock - keyperSetChangeLookAhead - 1)
+	assert.NilError(t, err)
+	assert.Equal(t, eon, uint64(0))
+	eon, eonKey, err = service.EonKeyForBlock(activationBlock - keyperSetChangeLookAhead)
+	assert.NilError(t, err)
+	assert.Equal(t, eon, uint64(1))
+	assert.Assert(t, eonKey.Equal(sim.keys[1].EonPublicKey))
+}
+
+func TestDecryptedTxIncludedInNextBlock(t *testing.T) {
+	sim, submitter, account := createSimulator(t)
+	outerTx, innerTx := submit(t, sim, submitter, account, 21000)
+	sim.Commit()
+	sim.Commit()
+
+	sequenced := receiptBlock(t, sim, outerTx)
+	included := receiptBlock(t, sim, innerTx)
+	assert.Equal(t, included, sequenced+1)
+}
+
+func TestEncryptedGasLimitDefersSubmissions(t *testing.T) {
+	sim, submitter, account := createSimulator(t)
+	_, first := submit(t, sim, submitter, account, 21000)
+	_, second := submit(t, sim, submitter, account, DefaultEncryptedGasLimit-21000+1)
+	sim.Commit()
+	sim.Commit()
+	sim.Commit()
+
+	assert.Equal(t, receiptBlock(t, sim, second), receiptBlock(t, sim, first)+1)
+}
+
+func TestWrongIdentityIsNotDecrypted(t *testing.T) {
+	sim, submitter, _ := createSimulator(t)
+	key, err := crypto.GenerateKey()
+	assert.NilError(t, err)
+	other := crypto.PubkeyToAddress(key.PublicKey)
+	prefix := utils.PrefixFromBlockNumber(1)
+	rightKey, err := sim.DecryptionKey(0, prefix, submitter.Address)
+	assert.NilError(t, err)
+	wrongKey, err := sim.DecryptionKey(0, prefix, other)
+	assert.NilError(t, err)
+	assert.Assert(t, !rightKey.Equal(wrongKey))
+}
+
+func TestAddEon(t *testing.T) {
+	sim, _, _ := createSimulator(t)
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+	eon, err := sim.AddEon(head + 5)
+	assert.NilError(t, err)
+	assert.Equal(t, eon, uint64(1))
+	sim.Commit()
+
+	current, err := sim.Contracts.KeyperSetManager.GetKeyperSetIndexByBlock(nil, head+4)
+	assert.NilError(t, err)
+	assert.Equal(t, current, uint64(0))
+	next, err := sim.Contracts.KeyperSetManager.GetKeyperSetIndexByBlock(nil, head+5)
+	assert.NilError(t, err)
+	assert.Equal(t, next, uint64(1))
+	activation, err := sim.Contracts.KeyperSetManager.GetKeyperSetActivationBlock(nil, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, activation, head+5)
+}
+
+func TestStart(t *testing.T) {
+	sim, _, _ := createSimulator(t)
+	head, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+	sim.Start(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	sim.Stop()
+	next, err := sim.Client().BlockNumber(context.Background())
+	assert.NilError(t, err)
+	assert.Assert(t, next > head)
+}
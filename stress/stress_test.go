@@ -2,6 +2,7 @@ package stress
 
 import (
 	"context"
+	"crypto/ecdsa"
 	cryptorand "crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"math/big"
 	"os"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,54 +21,108 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	sequencerBindings "github.com/shutter-network/contracts/v2/bindings/sequencer"
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/simulator"
 	"github.com/shutter-network/nethermind-tests/utils"
 	"github.com/shutter-network/shutter/shlib/shcrypto"
 	"gotest.tools/assert"
 )
 
-func skipCI(t *testing.T) {
-	if os.Getenv("CI") != "" {
-		t.Skip("Skipping testing in CI environment")
+// network is the profile selected by CONFIG_FILE and NETWORK, overridden by the
+// STRESS_TEST_* variables
+var network = sync.OnceValues(func() (config.Profile, error) {
+	file, err := config.LoadFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return config.Profile{}, err
+	}
+	profile, err := file.Profile(os.Getenv("NETWORK"))
+	if err != nil {
+		return config.Profile{}, err
+	}
+	return profile.WithEnv(config.StressEnv), nil
+})
+
+// the in-process shutter simulator is used, whenever no rpc endpoint is configured
+func useSimulator() bool {
+	profile, err := network()
+	return err == nil && profile.RPCURL == ""
+}
+
+func requireRPC(t *testing.T) {
+	if useSimulator() {
+		t.Skip("Skipping testing without an rpc url in the network profile or STRESS_TEST_RPC_URL")
 	}
 }
 
 const KeyperSetChangeLookAhead = 2
 
-func createSetup(fundNewAccount bool) (utils.StressSetup, error) {
+const simulatorBlockPeriod = 200 * time.Millisecond
+const simulatorInclusionWaitTimeout = 10 * time.Second
+
+func createSetup(t *testing.T, fundNewAccount bool) (utils.StressSetup, error) {
 	setup := new(utils.StressSetup)
-	RpcUrl, err := utils.ReadStringFromEnv("STRESS_TEST_RPC_URL")
+	var submitPrivateKey *ecdsa.PrivateKey
+	var contracts utils.Contracts
+	profile, err := network()
 	if err != nil {
 		return *setup, err
 	}
-	client, err := ethclient.Dial(RpcUrl)
-	if err != nil {
-		return *setup, fmt.Errorf("could not create client %v", err)
-	}
+	if useSimulator() {
+		alloc := types.GenesisAlloc{}
+		funding := big.NewInt(0).Mul(big.NewInt(100), big.NewInt(1e18))
+		key, err := simulator.FundedKey(alloc, funding)
+		if err != nil {
+			return *setup, err
+		}
+		submitPrivateKey = key
+		sim, err := simulator.New(alloc)
+		if err != nil {
+			return *setup, fmt.Errorf("could not create simulator %v", err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		sim.Start(simulatorBlockPeriod)
+		setup.Client = sim.Client()
+		contracts = sim.Contracts
+	} else {
+		err = profile.Require(config.StressEnv, "privateKey",
+			"contracts.keyperSetManager", "contracts.keyBroadcast", "contracts.sequencer")
+		if err != nil {
+			return *setup, err
+		}
+		client, err := ethclient.Dial(profile.RPCURL)
+		if err != nil {
+			return *setup, fmt.Errorf("could not create client %v", err)
+		}
+		setup.Client = client
 
-	setup.Client = client
+		submitPrivateKey, err = crypto.HexToECDSA(profile.PrivateKey)
+		if err != nil {
+			return *setup, err
+		}
+	}
 
-	chainID, err := client.NetworkID(context.Background())
+	chainID, err := setup.Client.ChainID(context.Background())
 	if err != nil {
 		return *setup, fmt.Errorf("could not query chainId %v", err)
 	}
+	if !useSimulator() {
+		err = profile.CheckChainID(chainID)
+		if err != nil {
+			return *setup, err
+		}
+		profile = profile.ForChain(chainID)
+	}
 	setup.ChainID = chainID
 
 	signerForChain := types.LatestSignerForChainID(chainID)
 	setup.SignerForChain = signerForChain
 
-	submitKeyHex, err := utils.ReadStringFromEnv("STRESS_TEST_PK")
-	if err != nil {
-		return *setup, err
-	}
-	submitPrivateKey, err := crypto.HexToECDSA(submitKeyHex)
-	if err != nil {
-		return *setup, err
-	}
-
 	submitAccount, err := utils.AccountFromPrivateKey(submitPrivateKey, signerForChain)
 	if err != nil {
 		return *setup, err
 	}
+	nonces := utils.NewNonceManager(setup.Client)
+	submitAccount.Nonces = nonces
 	setup.SubmitAccount = &submitAccount
 
 	// TODO: allow multiple transacting accounts in StressEnvironment.TransactAccounts
@@ -79,11 +135,14 @@ func createSetup(fundNewAccount bool) (utils.StressSetup, error) {
 	if err != nil {
 		return *setup, err
 	}
+	transactAccount.Nonces = nonces
 
 	setup.TransactAccount = &transactAccount
-	err = utils.StoreAccount(transactAccount)
-	if err != nil {
-		return *setup, err
+	if !useSimulator() {
+		err = utils.StoreAccount(transactAccount)
+		if err != nil {
+			return *setup, err
+		}
 	}
 	if fundNewAccount {
 		err = fund(*setup)
@@ -92,29 +151,23 @@ func createSetup(fundNewAccount bool) (utils.StressSetup, error) {
 		}
 		log.Println("Funding complete")
 	}
-	KeyperSetManagerContractAddress, err := utils.ReadStringFromEnv("STRESS_TEST_KEYPER_SET_MANAGER_CONTRACT_ADDRESS")
-	if err != nil {
-		return *setup, err
-	}
-
-	KeyBroadcastContractAddress, err := utils.ReadStringFromEnv("STRESS_TEST_KEY_BROADCAST_CONTRACT_ADDRESS")
-	if err != nil {
-		return *setup, err
-	}
-
-	SequencerContractAddress, err := utils.ReadStringFromEnv("STRESS_TEST_SEQUENCER_CONTRACT_ADDRESS")
-	if err != nil {
-		return *setup, err
-	}
-
-	contracts, err := utils.SetupContracts(client, KeyBroadcastContractAddress, SequencerContractAddress, KeyperSetManagerContractAddress, chainID)
-	if err != nil {
-		return *setup, err
+	if !useSimulator() {
+		contracts, err = utils.SetupContracts(setup.Client, profile.Contracts.KeyBroadcast, profile.Contracts.Sequencer,
+			profile.Contracts.KeyperSetManager, profile.Contracts.DepositContract, chainID)
+		if err != nil {
+			return *setup, err
+		}
 	}
 	setup.KeyBroadcastContract = *contracts.KeyBroadcastContract
 	setup.KeyperSetManager = *contracts.KeyperSetManager
 	setup.Sequencer = *contracts.Sequencer
 	setup.SequencerContractAddress = contracts.SequencerContractAddress
+	eonKeys, err := utils.NewEonKeyService(setup.Client, contracts.KeyperSetManager, contracts.KeyBroadcastContract, KeyperSetChangeLookAhead)
+	if err != nil {
+		return *setup, fmt.Errorf("could not load eon keys %v", err)
+	}
+	t.Cleanup(eonKeys.Close)
+	setup.EonKeys = eonKeys
 
 	return *setup, nil
 }
@@ -199,25 +252,24 @@ func createStressEnvironment(ctx context.Context, setup utils.StressSetup) (util
 	if err != nil {
 		return environment, fmt.Errorf("could not get eonKey %v", err)
 	}
-	submitterNonce, err := setup.Client.PendingNonceAt(context.Background(), setup.SubmitAccount.Address)
-	log.Println("Current submitter nonce is", submitterNonce)
+	if useSimulator() {
+		environment.InclusionWaitTimeout = simulatorInclusionWaitTimeout
+	}
+	err = setup.SubmitAccount.ResyncNonce()
 	if err != nil {
 		return environment, fmt.Errorf("could not query starting nonce %v", err)
 	}
-	setup.SubmitAccount.Nonce = big.NewInt(int64(submitterNonce))
-
-	transactNonce, err := setup.Client.PendingNonceAt(context.Background(), setup.TransactAccount.Address)
+	err = setup.TransactAccount.ResyncNonce()
 	if err != nil {
 		return environment, fmt.Errorf("could not query starting nonce %v", err)
 	}
-	setup.TransactAccount.Nonce = big.NewInt(int64(transactNonce))
 
 	log.Println("eon is ", eon)
 	return environment, nil
 }
 
 func getEonKey(ctx context.Context, setup utils.StressSetup) (uint64, *shcrypto.EonPublicKey, error) {
-	return utils.GetEonKey(ctx, setup.Client, &setup.KeyperSetManager, &setup.KeyBroadcastContract, KeyperSetChangeLookAhead)
+	return setup.EonKeys.CurrentEonKey(ctx)
 }
 
 func createIdentityPrefix() (shcrypto.Block, error) {
@@ -228,7 +280,7 @@ func createIdentityPrefix() (shcrypto.Block, error) {
 	return identityPrefix, nil
 }
 
-func encrypt(ctx context.Context, tx types.Transaction, env *utils.StressEnvironment, submitter common.Address, i int) (*shcrypto.EncryptedMessage, shcrypto.Block, error) {
+func encrypt(ctx context.Context, tx *types.Transaction, env *utils.StressEnvironment, submitter common.Address, i int) (*shcrypto.EncryptedMessage, shcrypto.Block, error) {
 
 	sigma, err := shcrypto.RandomSigma(cryptorand.Reader)
 	if err != nil {
@@ -268,7 +320,7 @@ func encrypt(ctx context.Context, tx types.Transaction, env *utils.StressEnviron
 	return encryptedTx, identityPrefix, nil
 }
 
-func submitEncryptedTx(ctx context.Context, setup utils.StressSetup, env *utils.StressEnvironment, tx types.Transaction, i int) (*types.Transaction, error) {
+func submitEncryptedTx(ctx context.Context, setup utils.StressSetup, env *utils.StressEnvironment, tx *types.Transaction, i int) (*types.Transaction, error) {
 
 	opts := env.SubmitterOpts
 	log.Println("submit nonce", opts.Nonce)
@@ -295,8 +347,8 @@ func transact(setup *utils.StressSetup, env *utils.StressEnvironment, count int)
 
 	toAddress := setup.SubmitAccount.Address
 	var data []byte
-	var submissions []types.Transaction
-	var innerTxs []types.Transaction
+	var submissions []*types.Transaction
+	var innerTxs []*types.Transaction
 
 	suggestedGasTipCap, err := setup.Client.SuggestGasTipCap(context.Background())
 	if err != nil {
@@ -321,8 +373,10 @@ func transact(setup *utils.StressSetup, env *utils.StressEnvironment, count int)
 	for i := 0; i < count; i++ {
 		gasFeeCap, suggestedGasTipCap := env.TransactGasPriceFn(suggestedGasTipCap, suggestedGasPrice, i, count)
 		gasLimit := env.TransactGasLimitFn(data, &toAddress, i, count)
-		innerNonceP := setup.TransactAccount.UseNonce()
-		innerNonce := innerNonceP.Uint64()
+		innerNonce, err := setup.TransactAccount.NextNonce()
+		if err != nil {
+			return err
+		}
 		log.Printf("inner nonce: %v", innerNonce)
 		tx := types.NewTx(
 			&types.DynamicFeeTx{
@@ -341,20 +395,23 @@ func transact(setup *utils.StressSetup, env *utils.StressEnvironment, count int)
 		if err != nil {
 			return err
 		}
-		innerTxs = append(innerTxs, *signedTx)
+		innerTxs = append(innerTxs, signedTx)
 		log.Println("used nonce", signedTx.Nonce())
 	}
 	for i := range innerTxs {
 		signedTx := innerTxs[i]
-		submitNonce := setup.SubmitAccount.UseNonce()
-		env.SubmitterOpts.Nonce = submitNonce
+		submitNonce, err := setup.SubmitAccount.NextNonce()
+		if err != nil {
+			return err
+		}
+		env.SubmitterOpts.Nonce = new(big.Int).SetUint64(submitNonce)
 		submitTx, err := submitEncryptedTx(context.Background(), *setup, env, signedTx, i)
 		if err != nil {
 			return err
 		}
-		submissions = append(submissions, *submitTx)
+		submissions = append(submissions, submitTx)
 		if env.WaitOnEverySubmit {
-			_, err = utils.WaitForTxTimeout(*submitTx, "submission", env.SubmissionWaitTimeout, setup.Client)
+			_, err = utils.WaitForTxTimeout(submitTx, "submission", env.SubmissionWaitTimeout, setup.Client)
 			if err != nil {
 				return err
 			}
@@ -385,8 +442,7 @@ func transact(setup *utils.StressSetup, env *utils.StressEnvironment, count int)
 
 // send a single transaction
 func TestStressSingle(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -400,8 +456,7 @@ func TestStressSingle(t *testing.T) {
 
 // send two transactions but wait for each submission to the sequencer possible
 func TestStressDualWait(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -417,8 +472,7 @@ func TestStressDualWait(t *testing.T) {
 
 // send two transactions as quickly as possible
 func TestStressDualNoWait(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -433,8 +487,7 @@ func TestStressDualNoWait(t *testing.T) {
 
 // send two transactions in the same block by the same sender with the same identityPrefix
 func TestStressDualDuplicatePrefix(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -457,8 +510,7 @@ func TestStressDualDuplicatePrefix(t *testing.T) {
 
 // send many transactions as quickly as possible.
 func TestStressManyNoWait(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -473,8 +525,7 @@ func TestStressManyNoWait(t *testing.T) {
 
 // test that tx using together more than ENCYRPTED_GAS_LIMIT end up in different blocks
 func TestStressExceedEncryptedGasLimit(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -505,8 +556,7 @@ func TestStressExceedEncryptedGasLimit(t *testing.T) {
 
 // test nested shutter transactions
 func TestInception(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -549,7 +599,7 @@ func TestInception(t *testing.T) {
 		log.Fatal(err)
 	}
 
-	encryptedInnerTx, innerIdentityPrefix, err := encrypt(ctx, *signedInnerTx, &env, setup.TransactAccount.Address, 1)
+	encryptedInnerTx, innerIdentityPrefix, err := encrypt(ctx, signedInnerTx, &env, setup.TransactAccount.Address, 1)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -602,7 +652,7 @@ func TestInception(t *testing.T) {
 		log.Fatal(err)
 	}
 
-	middleTxEncryptedMsg, middleIdentityPrefix, err := encrypt(ctx, *signedMiddleTx, &env, setup.SubmitAccount.Address, 1)
+	middleTxEncryptedMsg, middleIdentityPrefix, err := encrypt(ctx, signedMiddleTx, &env, setup.SubmitAccount.Address, 1)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -617,17 +667,17 @@ func TestInception(t *testing.T) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	submitReceipt, err := utils.WaitForTxTimeout(*submitTx, "outer tx", env.SubmissionWaitTimeout, setup.Client)
+	submitReceipt, err := utils.WaitForTxTimeout(submitTx, "outer tx", env.SubmissionWaitTimeout, setup.Client)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Println(hex.EncodeToString(middleIdentityPrefix[:]))
-	middleReceipt, err := utils.WaitForTxTimeout(*signedMiddleTx, "middle tx", env.InclusionWaitTimeout, setup.Client)
+	middleReceipt, err := utils.WaitForTxTimeout(signedMiddleTx, "middle tx", env.InclusionWaitTimeout, setup.Client)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Println(hex.EncodeToString(innerIdentityPrefix[:]))
-	innerReceipt, err := utils.WaitForTxTimeout(*signedInnerTx, "inner tx", env.InclusionWaitTimeout, setup.Client)
+	innerReceipt, err := utils.WaitForTxTimeout(signedInnerTx, "inner tx", env.InclusionWaitTimeout, setup.Client)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -635,8 +685,7 @@ func TestInception(t *testing.T) {
 }
 
 func TestIncorrectIdentitySuffix(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(true)
+	setup, err := createSetup(t, true)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -652,8 +701,8 @@ func TestIncorrectIdentitySuffix(t *testing.T) {
 
 // not really a test, but useful to collect from previously funded test accounts
 func TestEmptyAccounts(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(false)
+	requireRPC(t)
+	setup, err := createSetup(t, false)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -687,8 +736,8 @@ func TestEmptyAccounts(t *testing.T) {
 
 // not really a test, but useful to fix the submit account's nonce, if an earlier test failed
 func TestFixNonce(t *testing.T) {
-	skipCI(t)
-	setup, err := createSetup(false)
+	requireRPC(t)
+	setup, err := createSetup(t, false)
 	if err != nil {
 		log.Fatal("could not create setup", err)
 	}
@@ -0,0 +1,74 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Group runs the goroutines, that a worker starts. A panic in one of them is recovered
+// and cancels the context of the group, so that the worker can return it as its error
+// and is restarted, instead of taking down all workers.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewGroup returns a group, whose context is derived from ctx.
+func NewGroup(ctx context.Context) *Group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Context is done, when a goroutine of the group panicked or the group was cancelled.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a new goroutine. On a nil Group, a panic of fn is not recovered.
+func (g *Group) Go(fn func()) {
+	if g == nil {
+		go fn()
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				g.mu.Lock()
+				if g.err == nil {
+					g.err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+				}
+				g.mu.Unlock()
+				g.cancel()
+			}
+		}()
+		fn()
+	}()
+}
+
+// Err returns the first recovered panic, nil if there was none.
+func (g *Group) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Cancel cancels the context of the group.
+func (g *Group) Cancel() {
+	g.cancel()
+}
+
+// Wait blocks until all goroutines of the group returned. It does nothing on a nil Group.
+func (g *Group) Wait() {
+	if g == nil {
+		return
+	}
+	g.wg.Wait()
+}
@@ -0,0 +1,188 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Worker runs a mode until ctx is done. Returning nil means, that the mode is finished
+// and must not be restarted.
+type Worker func(ctx context.Context) error
+
+// Policy decides how often and how fast a failed worker is restarted.
+type Policy struct {
+	// restarts after the first run, a negative value restarts without limit
+	MaxRestarts int
+	// delay before the first restart, it doubles with every further restart
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxRestarts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+	}
+}
+
+// backoff returns the delay before restart number restart (counting from 0).
+func (p Policy) backoff(restart int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 0; i < restart && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+type State int
+
+const (
+	Running State = iota + 1
+	BackingOff
+	Finished
+	Stopped
+	Failed
+)
+
+func (s State) String() string {
+	if s < Running || s > Failed {
+		return "Unknown"
+	}
+	return [...]string{"Running", "BackingOff", "Finished", "Stopped", "Failed"}[s-1]
+}
+
+// Health is the state of a supervised worker.
+type Health struct {
+	Name      string
+	State     State
+	Restarts  int
+	LastError string
+	// when the worker was started the last time
+	StartedAt time.Time
+}
+
+func (h Health) String() string {
+	s := fmt.Sprintf("%v: %v, %v restarts", h.Name, h.State, h.Restarts)
+	if h.LastError != "" {
+		s += ", last error: " + h.LastError
+	}
+	return s
+}
+
+// Supervisor runs every worker in its own goroutine. A panic in a worker is recovered
+// and handled like an error, so that it does not take down the other workers. Goroutines
+// started by a worker itself have to be run in a Group to be recovered.
+type Supervisor struct {
+	mu     sync.Mutex
+	health map[string]*Health
+	wg     sync.WaitGroup
+}
+
+func New() *Supervisor {
+	return &Supervisor{health: make(map[string]*Health)}
+}
+
+// Go starts supervising run as name. A failed run is restarted according to policy
+// until ctx is done.
+func (s *Supervisor) Go(ctx context.Context, name string, policy Policy, run Worker) {
+	s.mu.Lock()
+	s.health[name] = &Health{Name: name}
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(ctx, name, policy, run)
+	}()
+}
+
+func (s *Supervisor) supervise(ctx context.Context, name string, policy Policy, run Worker) {
+	for restarts := 0; ; restarts++ {
+		s.update(name, func(h *Health) {
+			h.State = Running
+			h.Restarts = restarts
+			h.StartedAt = time.Now()
+		})
+		err := runRecovered(ctx, run)
+		switch {
+		case ctx.Err() != nil:
+			failedShutdown := err != nil && !errors.Is(err, context.Canceled)
+			s.update(name, func(h *Health) {
+				h.State = Stopped
+				if failedShutdown {
+					h.LastError = err.Error()
+				}
+			})
+			if failedShutdown {
+				log.Printf("%v stopped with error: %v", name, err)
+			}
+			return
+		case err == nil:
+			s.update(name, func(h *Health) { h.State = Finished })
+			return
+		}
+		log.Printf("%v failed: %v", name, err)
+		if policy.MaxRestarts >= 0 && restarts >= policy.MaxRestarts {
+			s.update(name, func(h *Health) {
+				h.State = Failed
+				h.LastError = err.Error()
+			})
+			log.Printf("%v failed %v times, giving up", name, restarts+1)
+			return
+		}
+		delay := policy.backoff(restarts)
+		s.update(name, func(h *Health) {
+			h.State = BackingOff
+			h.LastError = err.Error()
+		})
+		log.Printf("restarting %v in %v", name, delay)
+		select {
+		case <-ctx.Done():
+			s.update(name, func(h *Health) { h.State = Stopped })
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runRecovered runs run and returns a recovered panic as error.
+func runRecovered(ctx context.Context, run Worker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return run(ctx)
+}
+
+func (s *Supervisor) update(name string, fn func(h *Health)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.health[name])
+}
+
+// Health returns the state of all workers, ordered by name.
+func (s *Supervisor) Health() []Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health := make([]Health, 0, len(s.health))
+	for _, h := range s.health {
+		health = append(health, *h)
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+	return health
+}
+
+// Wait blocks until all workers are finished, stopped or failed.
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
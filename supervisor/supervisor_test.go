@@ -0,0 +1,121 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+var fastPolicy = Policy{MaxRestarts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}
+
+func TestRestartsPanickingWorker(t *testing.T) {
+	s := New()
+	var runs atomic.Int32
+	s.Go(context.Background(), "flaky", fastPolicy, func(ctx context.Context) error {
+		if runs.Add(1) < 3 {
+			panic("flaky rpc")
+		}
+		return nil
+	})
+	var otherDone atomic.Bool
+	s.Go(context.Background(), "other", fastPolicy, func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		otherDone.Store(true)
+		return nil
+	})
+	s.Wait()
+
+	assert.Equal(t, runs.Load(), int32(3))
+	assert.Assert(t, otherDone.Load())
+	health := s.Health()
+	assert.Equal(t, len(health), 2)
+	assert.Equal(t, health[0].Name, "flaky")
+	assert.Equal(t, health[0].State, Finished)
+	assert.Equal(t, health[0].Restarts, 2)
+	assert.Assert(t, strings.HasPrefix(health[0].LastError, "panic: flaky rpc"))
+	assert.Equal(t, health[1].State, Finished)
+}
+
+func TestGivesUpAfterMaxRestarts(t *testing.T) {
+	s := New()
+	var runs atomic.Int32
+	s.Go(context.Background(), "broken", fastPolicy, func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("broken")
+	})
+	s.Wait()
+
+	assert.Equal(t, runs.Load(), int32(fastPolicy.MaxRestarts+1))
+	health := s.Health()
+	assert.Equal(t, health[0].State, Failed)
+	assert.Equal(t, health[0].LastError, "broken")
+}
+
+func TestStopsOnCancel(t *testing.T) {
+	s := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	s.Go(ctx, "long", DefaultPolicy(), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	assert.Equal(t, s.Health()[0].State, Running)
+	cancel()
+	s.Wait()
+	assert.Equal(t, s.Health()[0].State, Stopped)
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, policy.backoff(0), time.Second)
+	assert.Equal(t, policy.backoff(1), 2*time.Second)
+	assert.Equal(t, policy.backoff(2), 4*time.Second)
+	assert.Equal(t, policy.backoff(3), 5*time.Second)
+	assert.Equal(t, policy.backoff(40), 5*time.Second)
+}
+
+func TestRestartsWorkerWithPanickingGoroutine(t *testing.T) {
+	s := New()
+	var runs atomic.Int32
+	s.Go(context.Background(), "helpers", fastPolicy, func(ctx context.Context) error {
+		group := NewGroup(ctx)
+		defer group.Cancel()
+		first := runs.Add(1) == 1
+		group.Go(func() {
+			if first {
+				panic("nil map")
+			}
+		})
+		group.Wait()
+		return group.Err()
+	})
+	s.Wait()
+
+	assert.Equal(t, runs.Load(), int32(2))
+	health := s.Health()
+	assert.Equal(t, health[0].State, Finished)
+	assert.Equal(t, health[0].Restarts, 1)
+	assert.Assert(t, strings.HasPrefix(health[0].LastError, "panic: nil map"))
+}
+
+func TestGroup(t *testing.T) {
+	group := NewGroup(context.Background())
+	group.Go(func() { panic("first") })
+	<-group.Context().Done()
+	group.Go(func() { panic("second") })
+	group.Wait()
+	assert.Assert(t, strings.HasPrefix(group.Err().Error(), "panic: first"))
+
+	var disabled *Group
+	done := make(chan struct{})
+	disabled.Go(func() { close(done) })
+	<-done
+	disabled.Wait()
+}
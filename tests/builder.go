@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shutter-network/nethermind-tests/config"
+	"github.com/shutter-network/nethermind-tests/requests"
+)
+
+// TxBuilderFromConfig creates the builder for the transactions of the chiado, gnosis
+// and send-wait modes.
+func TxBuilderFromConfig(cfg config.Config) (requests.TxBuilder, error) {
+	txType, err := requests.ParseTxType(cfg.TxType)
+	if err != nil {
+		return requests.TxBuilder{}, err
+	}
+	builder := requests.NewTxBuilder(txType)
+	builder.GasPriceFn, err = requests.ParseGasStrategy(cfg.TxGasStrategy)
+	if err != nil {
+		return builder, err
+	}
+	if cfg.TxTo != "" {
+		if !common.IsHexAddress(cfg.TxTo) {
+			return builder, fmt.Errorf("invalid recipient %v", cfg.TxTo)
+		}
+		to := common.HexToAddress(cfg.TxTo)
+		builder.To = &to
+	}
+	if cfg.TxValue != nil {
+		builder.Value = cfg.TxValue
+	}
+	builder.Data = cfg.TxData
+	builder.GasLimit = cfg.TxGasLimit
+	return builder, nil
+}
@@ -1,34 +1,55 @@
 package tests
 
 import (
-	"github.com/shutter-network/nethermind-tests/config"
-	"github.com/shutter-network/nethermind-tests/requests"
+	"context"
+	"fmt"
 	"log"
 	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shutter-network/nethermind-tests/config"
 )
 
-func RunChiadoTransactions(cfg config.Config) {
+// RunChiadoTransactions sends a transaction to chiado every interval until ctx is done.
+func RunChiadoTransactions(ctx context.Context, cfg config.Config) error {
 	interval := cfg.ChiadoSendInterval
 	log.Printf("Running Chiado transactions at an interval of [%d] seconds", interval)
-	tick := time.NewTicker(interval)
-
-	for range tick.C {
-		_, err := requests.SendLegacyTx(cfg.ChiadoURL, cfg.PrivateKey)
-		if err != nil {
-			log.Fatalf("Failed to send transaction %s", err)
-		}
-	}
+	return runIntervalTransactions(ctx, cfg.ChiadoURL, interval, cfg)
 }
 
-func RunGnosisTransactions(cfg config.Config) {
+// RunGnosisTransactions sends a transaction to gnosis every interval until ctx is done.
+func RunGnosisTransactions(ctx context.Context, cfg config.Config) error {
 	interval := cfg.GnosisSendInterval
 	log.Printf("Running Gnosis transactions at an interval of [%d] seconds", interval)
+	return runIntervalTransactions(ctx, cfg.GnosisURL, interval, cfg)
+}
+
+func runIntervalTransactions(ctx context.Context, url string, interval time.Duration, cfg config.Config) error {
+	builder, err := TxBuilderFromConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid transaction config: %w", err)
+	}
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the Ethereum client: %w", err)
+	}
+	defer client.Close()
 	tick := time.NewTicker(interval)
+	defer tick.Stop()
 
-	for range tick.C {
-		_, err := requests.SendLegacyTx(cfg.GnosisURL, cfg.PrivateKey)
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopped after sending %d transactions", sent)
+			return nil
+		case <-tick.C:
+		}
+		_, err := builder.Send(client, cfg.PrivateKey)
 		if err != nil {
-			log.Fatalf("Failed to send transaction %s", err)
+			log.Printf("Stopped after sending %d transactions", sent)
+			return fmt.Errorf("failed to send transaction: %w", err)
 		}
+		sent++
 	}
 }
@@ -2,76 +2,90 @@ package tests
 
 import (
 	"context"
-	"github.com/ethereum/go-ethereum/crypto"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/shutter-network/nethermind-tests/config"
 	"github.com/shutter-network/nethermind-tests/requests"
-	"log"
-	"time"
+	"github.com/shutter-network/nethermind-tests/utils"
 )
 
-func SendAndCheckTransaction(cfg config.Config) bool {
-	signedTx, err := requests.SendLegacyTx(cfg.NodeURL, cfg.PrivateKey)
-	if err != nil {
-		log.Fatalf("Failed to send transaction %s", err)
+// EscalationPolicyFromConfig returns the replace-by-fee policy of the send-wait mode.
+// Every step waits for the configured receipt timeout.
+func EscalationPolicyFromConfig(cfg config.Config) requests.EscalationPolicy {
+	return requests.EscalationPolicy{
+		Steps:       cfg.EscalationSteps,
+		BumpPercent: int64(cfg.EscalationBumpPercent),
+		MaxGasPrice: cfg.EscalationMaxGasPrice,
+		StepTimeout: cfg.Timeout,
 	}
+}
 
-	nonce := signedTx.Nonce()
-	result, err := requests.WaitForReceipt(cfg.NodeURL, signedTx.Hash().Hex(), cfg.Timeout)
+func SendAndCheckTransaction(client utils.Backend, builder requests.TxBuilder, policy requests.EscalationPolicy, cfg config.Config) (requests.EscalationResult, error) {
+	signedTx, err := builder.Send(client, cfg.PrivateKey)
 	if err != nil {
-		log.Fatalf("Wait receipt failed with error %s", err)
+		return requests.EscalationResult{}, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
-	if result == false { // we didn't receive the transaction within the timeout
-		err := requests.CancelTx(cfg, nonce)
-		if err != nil {
-			log.Printf("Cancelling transaction failed with error: %s. "+
-				"Checking if transaction got confirmed in the meantime.", err)
-
-			client, err := ethclient.Dial(cfg.NodeURL)
-			if err != nil {
-				log.Fatalf("Failed to connect to the Ethereum client: %v", err)
-			}
-
-			privateKey, err := crypto.HexToECDSA(cfg.PrivateKey)
-			if err != nil {
-				log.Fatalf("Failed to load private key: %v", err)
-			}
-
-			fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
-			log.Println("Sending transaction from: " + fromAddress.String())
-
-			pendingNonce, err := client.PendingNonceAt(context.Background(), fromAddress)
-			if err != nil {
-				log.Fatalf("Failed to get pending nonce: %v", err)
-			}
-
-			if pendingNonce == nonce+1 {
-				log.Printf("Transaction confirmed in the meantime. "+
-					"Pending nonce [%d] == nonce [%d] + 1", pendingNonce, nonce)
-				return false
-			}
-
-			log.Fatalf("Failed to send cancel transaction for a non confirmed transaction %s", err)
+	receipt, err := requests.WaitForReceipt(client, signedTx.Hash().Hex(), cfg.Timeout)
+	if err != nil {
+		return requests.EscalationResult{Tx: signedTx}, fmt.Errorf("wait receipt failed: %w", err)
+	}
+	if receipt != nil {
+		// a reverted transaction used its nonce, so it must not be replaced
+		if receipt.Status == types.ReceiptStatusFailed {
+			return requests.EscalationResult{Outcome: requests.Failed, Tx: signedTx}, nil
 		}
-		return false
+		return requests.EscalationResult{Outcome: requests.IncludedOriginal, Tx: signedTx}, nil
+	}
+
+	// we didn't receive the transaction within the timeout
+	escalation, err := requests.Escalate(client, cfg.PrivateKey, signedTx, policy)
+	if err != nil {
+		log.Printf("Escalating transaction %s failed with error: %s", signedTx.Hash().Hex(), err)
 	}
-	return true
+	return escalation, nil
 }
 
-func RunSendAndWaitTest(cfg config.Config) {
+// RunSendAndWaitTest sends transactions one after the other for the configured test
+// duration or until ctx is done, and logs the outcomes. The report is also logged, when
+// a transaction could not be sent.
+func RunSendAndWaitTest(ctx context.Context, cfg config.Config) error {
 	endTime := time.Now().Add(cfg.TestDuration)
 	successCount := 0
 	failCount := 0
+	outcomes := make(map[string]int)
 
 	log.Printf("Running Send And Wait transactions")
 	log.Printf("Test Duration [%s]", cfg.TestDuration)
 	log.Printf("Wait Timeout [%s]", cfg.Timeout)
 	log.Printf("Node URL %s", cfg.NodeURL)
+	log.Printf("Transaction type [%s]", cfg.TxType)
 
-	for time.Now().Before(endTime) {
-		success := SendAndCheckTransaction(cfg)
-		if success {
+	builder, err := TxBuilderFromConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid transaction config: %w", err)
+	}
+	policy := EscalationPolicyFromConfig(cfg)
+
+	client, err := ethclient.Dial(cfg.NodeURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the Ethereum client: %w", err)
+	}
+	defer client.Close()
+
+	for time.Now().Before(endTime) && ctx.Err() == nil {
+		var result requests.EscalationResult
+		result, err = SendAndCheckTransaction(client, builder, policy, cfg)
+		if err != nil {
+			break
+		}
+		outcomes[result.String()]++
+		if result.Outcome == requests.IncludedOriginal {
 			successCount++
 		} else {
 			failCount++
@@ -80,10 +94,23 @@ func RunSendAndWaitTest(cfg config.Config) {
 
 	// Calculate execution percentage
 	totalAttempts := successCount + failCount
+	if totalAttempts == 0 {
+		log.Printf("No transactions were checked")
+		return err
+	}
 	successPercentage := (float64(successCount) / float64(totalAttempts)) * 100
 	failurePercentage := (float64(failCount) / float64(totalAttempts)) * 100
 
-	log.Printf("Test Duration: %s, Wait Timeout: %s,  Successes: %d, Failures: %d, Success Percentage: %.2f%%, Failure Percentage: %.2f%%",
-		cfg.TestDuration, cfg.Timeout, successCount, failCount, successPercentage, failurePercentage)
+	log.Printf("Transaction Type: %s, Test Duration: %s, Wait Timeout: %s,  Successes: %d, Failures: %d, Success Percentage: %.2f%%, Failure Percentage: %.2f%%",
+		cfg.TxType, cfg.TestDuration, cfg.Timeout, successCount, failCount, successPercentage, failurePercentage)
 
+	names := make([]string, 0, len(outcomes))
+	for name := range outcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("Outcome [%s]: %d (%.2f%%)", name, outcomes[name], float64(outcomes[name])/float64(totalAttempts)*100)
+	}
+	return err
 }
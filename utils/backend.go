@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// Backend is the subset of the ethereum client API that the test modes rely on.
+// It is satisfied by *ethclient.Client as well as by the client of go-ethereum's
+// simulated backend (ethclient/simulated), which allows running the same code
+// paths without a live RPC endpoint.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ethereum.BlockNumberReader
+	ethereum.ChainIDReader
+	ethereum.ChainReader
+	ethereum.ChainStateReader
+}
+
+// IsReceiptPending reports whether err only means that a receipt is not available yet.
+// Geth based nodes answer with "transaction indexing is in progress" instead of
+// NotFound, while their transaction index is still being built.
+func IsReceiptPending(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "transaction indexing is in progress")
+}
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	keybroadcastcontract "github.com/shutter-network/contracts/v2/bindings/keybroadcastcontract"
+	keypersetmanager "github.com/shutter-network/contracts/v2/bindings/keypersetmanager"
+	"github.com/shutter-network/shutter/shlib/shcrypto"
+)
+
+// time to wait, before dropped event subscriptions are renewed
+var eonEventsReconnectDelay = time.Second
+
+// Eon describes a keyper set and the eon key it broadcast.
+type Eon struct {
+	Index           uint64
+	ActivationBlock uint64
+	KeyperSet       common.Address
+	// nil, until the key was broadcast
+	Key *shcrypto.EonPublicKey
+}
+
+// EonKeyService keeps the keyper sets and eon keys in memory. They are loaded once and
+// updated from the KeyperSetAdded and EonKeyBroadcast events afterwards, so that no
+// contract calls are needed to encrypt a transaction.
+type EonKeyService struct {
+	client           Backend
+	keyperSetManager *keypersetmanager.Keypersetmanager
+	keyBroadcast     *keybroadcastcontract.Keybroadcastcontract
+	lookAhead        uint64
+
+	mu   sync.RWMutex
+	eons []Eon
+	// keys, that were broadcast before the KeyperSetAdded event of their eon was seen
+	earlyKeys map[uint64]*shcrypto.EonPublicKey
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewEonKeyService loads all keyper sets and their eon keys and starts following the
+// events of both contracts. A transaction for block n is encrypted for the keyper set,
+// that is active at block n+lookAhead.
+func NewEonKeyService(
+	client Backend,
+	keyperSetManager *keypersetmanager.Keypersetmanager,
+	keyBroadcastContract *keybroadcastcontract.Keybroadcastcontract,
+	lookAhead int,
+) (*EonKeyService, error) {
+	s := &EonKeyService{
+		client:           client,
+		keyperSetManager: keyperSetManager,
+		keyBroadcast:     keyBroadcastContract,
+		lookAhead:        uint64(lookAhead),
+		earlyKeys:        make(map[uint64]*shcrypto.EonPublicKey),
+		done:             make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := s.subscribe(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("could not subscribe to eon events %v", err)
+	}
+	err = s.load(ctx)
+	if err != nil {
+		sub.unsubscribe()
+		cancel()
+		return nil, err
+	}
+	s.cancel = cancel
+	go s.run(ctx, sub)
+	return s, nil
+}
+
+// load reads all keyper sets and eon keys from the contracts.
+func (s *EonKeyService) load(ctx context.Context) error {
+	opts := &bind.CallOpts{Context: ctx}
+	num, err := s.keyperSetManager.GetNumKeyperSets(opts)
+	if err != nil {
+		return fmt.Errorf("could not get number of keyper sets %v", err)
+	}
+	eons := make([]Eon, num)
+	for i := uint64(0); i < num; i++ {
+		eons[i].Index = i
+		eons[i].ActivationBlock, err = s.keyperSetManager.GetKeyperSetActivationBlock(opts, i)
+		if err != nil {
+			return fmt.Errorf("could not get activation block of keyper set %v %v", i, err)
+		}
+		eons[i].KeyperSet, err = s.keyperSetManager.GetKeyperSetAddress(opts, i)
+		if err != nil {
+			return fmt.Errorf("could not get address of keyper set %v %v", i, err)
+		}
+		eonKeyBytes, err := s.keyBroadcast.GetEonKey(opts, i)
+		if err != nil {
+			return fmt.Errorf("could not get eonKeyBytes %v", err)
+		}
+		eons[i].Key = unmarshalEonKey(i, eonKeyBytes)
+	}
+	s.mu.Lock()
+	s.eons = eons
+	for eon := range s.earlyKeys {
+		if eon < num {
+			delete(s.earlyKeys, eon)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func unmarshalEonKey(eon uint64, eonKeyBytes []byte) *shcrypto.EonPublicKey {
+	if len(eonKeyBytes) == 0 {
+		return nil
+	}
+	eonKey := &shcrypto.EonPublicKey{}
+	if err := eonKey.Unmarshal(eonKeyBytes); err != nil {
+		log.Printf("could not unmarshal key of eon %v: %v\n", eon, err)
+		return nil
+	}
+	return eonKey
+}
+
+type eonSubscription struct {
+	keyperSets   chan *keypersetmanager.KeypersetmanagerKeyperSetAdded
+	keys         chan *keybroadcastcontract.KeybroadcastcontractEonKeyBroadcast
+	keyperSetSub event.Subscription
+	keySub       event.Subscription
+}
+
+func (sub *eonSubscription) unsubscribe() {
+	sub.keyperSetSub.Unsubscribe()
+	sub.keySub.Unsubscribe()
+}
+
+func (s *EonKeyService) subscribe(ctx context.Context) (*eonSubscription, error) {
+	opts := &bind.WatchOpts{Context: ctx}
+	sub := &eonSubscription{
+		keyperSets: make(chan *keypersetmanager.KeypersetmanagerKeyperSetAdded),
+		keys:       make(chan *keybroadcastcontract.KeybroadcastcontractEonKeyBroadcast),
+	}
+	var err error
+	sub.keyperSetSub, err = s.keyperSetManager.WatchKeyperSetAdded(opts, sub.keyperSets)
+	if err != nil {
+		return nil, err
+	}
+	sub.keySub, err = s.keyBroadcast.WatchEonKeyBroadcast(opts, sub.keys)
+	if err != nil {
+		sub.keyperSetSub.Unsubscribe()
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *EonKeyService) run(ctx context.Context, sub *eonSubscription) {
+	defer close(s.done)
+	for {
+		err := s.follow(ctx, sub)
+		sub.unsubscribe()
+		for ctx.Err() == nil && err != nil {
+			log.Println("error when watching eon events:", err, "- reconnecting")
+			select {
+			case <-ctx.Done():
+			case <-time.After(eonEventsReconnectDelay):
+			}
+			sub, err = s.resubscribe(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// resubscribe renews the subscriptions and reloads the eons to pick up the events,
+// that were missed in between.
+func (s *EonKeyService) resubscribe(ctx context.Context) (*eonSubscription, error) {
+	sub, err := s.subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.load(ctx)
+	if err != nil {
+		sub.unsubscribe()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// follow applies the events of both contracts until one of the subscriptions fails.
+func (s *EonKeyService) follow(ctx context.Context, sub *eonSubscription) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-sub.keyperSets:
+			err := s.addKeyperSet(ctx, ev)
+			if err != nil {
+				return err
+			}
+		case ev := <-sub.keys:
+			s.setKey(ev.Eon, ev.Key)
+		case err := <-sub.keyperSetSub.Err():
+			return err
+		case err := <-sub.keySub.Err():
+			return err
+		}
+	}
+}
+
+func (s *EonKeyService) addKeyperSet(ctx context.Context, ev *keypersetmanager.KeypersetmanagerKeyperSetAdded) error {
+	log.Printf("keyper set %v added for eon %v, activates at block %v\n", ev.KeyperSetContract.Hex(), ev.Eon, ev.ActivationBlock)
+	s.mu.Lock()
+	known := uint64(len(s.eons))
+	if ev.Eon == known {
+		s.eons = append(s.eons, Eon{
+			Index:           ev.Eon,
+			ActivationBlock: ev.ActivationBlock,
+			KeyperSet:       ev.KeyperSetContract,
+			Key:             s.earlyKeys[ev.Eon],
+		})
+		delete(s.earlyKeys, ev.Eon)
+	}
+	s.mu.Unlock()
+	if ev.Eon > known {
+		// an event was missed
+		return s.load(ctx)
+	}
+	return nil
+}
+
+func (s *EonKeyService) setKey(eon uint64, eonKeyBytes []byte) {
+	log.Printf("key for eon %v broadcast\n", eon)
+	key := unmarshalEonKey(eon, eonKeyBytes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if eon < uint64(len(s.eons)) {
+		s.eons[eon].Key = key
+	} else {
+		s.earlyKeys[eon] = key
+	}
+}
+
+// EonKeyForBlock returns the eon and its key for a transaction targeting blockNumber.
+func (s *EonKeyService) EonKeyForBlock(blockNumber uint64) (uint64, *shcrypto.EonPublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	activeAt := blockNumber + s.lookAhead
+	for i := len(s.eons) - 1; i >= 0; i-- {
+		eon := s.eons[i]
+		if eon.ActivationBlock > activeAt {
+			continue
+		}
+		if eon.Key == nil {
+			return 0, nil, fmt.Errorf("key of eon %v was not broadcast yet", eon.Index)
+		}
+		return eon.Index, eon.Key, nil
+	}
+	return 0, nil, fmt.Errorf("no keyper set active at block %v", activeAt)
+}
+
+// CurrentEonKey returns the eon and its key for a transaction targeting the latest block.
+func (s *EonKeyService) CurrentEonKey(ctx context.Context) (uint64, *shcrypto.EonPublicKey, error) {
+	blockNumber, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not query blockNumber %v", err)
+	}
+	return s.EonKeyForBlock(blockNumber)
+}
+
+// History returns all known eons in ascending order.
+func (s *EonKeyService) History() []Eon {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Eon{}, s.eons...)
+}
+
+// Close stops following the contract events.
+func (s *EonKeyService) Close() {
+	s.cancel()
+	<-s.done
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// time to wait, before a dropped head subscription is renewed
+var headReconnectDelay = time.Second
+
+// number of recent heads, whose hashes are remembered to detect duplicates and reorgs
+const recentHeads = 64
+
+var (
+	dispatchersMu sync.Mutex
+	dispatchers   = make(map[Backend]*HeadDispatcher)
+)
+
+// HeadDispatcher shares a single new head subscription of a client between all
+// goroutines, that wait for new blocks or receipts. The subscription is only held, while
+// there are listeners. When it drops, it is renewed and the heads, that were missed in
+// between, are dispatched from the chain.
+type HeadDispatcher struct {
+	client Backend
+
+	mu        sync.Mutex
+	listeners int
+	cancel    context.CancelFunc
+	nextID    int
+	heads     map[int]chan *types.Header
+	waiters   map[common.Hash][]chan *types.Receipt
+	last      uint64
+	recent    map[uint64]common.Hash
+	// heads, whose receipts could not be looked up, they are retried with the next head
+	unresolved []*types.Header
+}
+
+func NewHeadDispatcher(client Backend) *HeadDispatcher {
+	return &HeadDispatcher{
+		client:  client,
+		heads:   make(map[int]chan *types.Header),
+		waiters: make(map[common.Hash][]chan *types.Receipt),
+		recent:  make(map[uint64]common.Hash),
+	}
+}
+
+// HeadsFor returns the dispatcher shared by all users of client.
+func HeadsFor(client Backend) *HeadDispatcher {
+	dispatchersMu.Lock()
+	defer dispatchersMu.Unlock()
+	d, ok := dispatchers[client]
+	if !ok {
+		d = NewHeadDispatcher(client)
+		dispatchers[client] = d
+	}
+	return d
+}
+
+// ForgetHeads drops the dispatcher of client, before the client is closed.
+func ForgetHeads(client Backend) {
+	dispatchersMu.Lock()
+	defer dispatchersMu.Unlock()
+	delete(dispatchers, client)
+}
+
+// acquire must be called with d.mu held. It subscribes, when the first listener is added.
+func (d *HeadDispatcher) acquire() {
+	d.listeners++
+	if d.listeners > 1 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	go d.run(ctx)
+}
+
+// release must be called with d.mu held. It unsubscribes, when the last listener is removed.
+func (d *HeadDispatcher) release() {
+	d.listeners--
+	if d.listeners > 0 {
+		return
+	}
+	d.cancel()
+	d.last = 0
+	d.recent = make(map[uint64]common.Hash)
+	d.unresolved = nil
+}
+
+// SubscribeHeads returns a channel receiving every new head and a function to stop
+// receiving them. Heads are dropped, if the channel is not read fast enough.
+func (d *HeadDispatcher) SubscribeHeads() (<-chan *types.Header, func()) {
+	ch := make(chan *types.Header, recentHeads)
+	d.mu.Lock()
+	id := d.nextID
+	d.nextID++
+	d.heads[id] = ch
+	d.acquire()
+	d.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.heads, id)
+			d.release()
+			d.mu.Unlock()
+		})
+	}
+}
+
+// WaitForReceipt returns the receipt of the transaction with hash, as soon as it was
+// included in a block.
+func (d *HeadDispatcher) WaitForReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	ch := make(chan *types.Receipt, 1)
+	d.mu.Lock()
+	d.waiters[hash] = append(d.waiters[hash], ch)
+	d.acquire()
+	d.mu.Unlock()
+	defer d.removeWaiter(hash, ch)
+
+	// the transaction might have been included before we started waiting
+	receipt, err := d.client.TransactionReceipt(ctx, hash)
+	if err == nil && receipt != nil {
+		return receipt, nil
+	}
+	if err != nil && !IsReceiptPending(err) {
+		log.Println("err when checking tx", hash.Hex(), err)
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case receipt = <-ch:
+		return receipt, nil
+	}
+}
+
+func (d *HeadDispatcher) removeWaiter(hash common.Hash, ch chan *types.Receipt) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	waiters := d.waiters[hash]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(d.waiters, hash)
+	} else {
+		d.waiters[hash] = waiters
+	}
+	d.release()
+}
+
+func (d *HeadDispatcher) run(ctx context.Context) {
+	for {
+		err := d.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("error when watching heads:", err, "- reconnecting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(headReconnectDelay):
+		}
+	}
+}
+
+// follow subscribes to new heads and dispatches them until the subscription fails.
+func (d *HeadDispatcher) follow(ctx context.Context) error {
+	newHeads := make(chan *types.Header, recentHeads)
+	sub, err := d.client.SubscribeNewHead(ctx, newHeads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	err = d.backfill(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case head := <-newHeads:
+			err = d.dispatchUpTo(ctx, head)
+			if err != nil {
+				return err
+			}
+		case err := <-sub.Err():
+			return err
+		}
+	}
+}
+
+// backfill dispatches the heads, that were mined while there was no subscription.
+func (d *HeadDispatcher) backfill(ctx context.Context) error {
+	d.mu.Lock()
+	last := d.last
+	d.mu.Unlock()
+	if last == 0 {
+		return nil
+	}
+	current, err := d.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	return d.dispatchUpTo(ctx, current)
+}
+
+// dispatchUpTo dispatches head and all heads between the last dispatched one and head.
+func (d *HeadDispatcher) dispatchUpTo(ctx context.Context, head *types.Header) error {
+	d.mu.Lock()
+	last := d.last
+	d.mu.Unlock()
+	number := head.Number.Uint64()
+	if last != 0 && number > last+1 {
+		log.Printf("backfilling heads %v to %v\n", last+1, number-1)
+		for n := last + 1; n < number; n++ {
+			missed, err := d.client.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+			if err != nil {
+				return err
+			}
+			d.dispatch(ctx, missed)
+		}
+	}
+	d.dispatch(ctx, head)
+	return nil
+}
+
+func (d *HeadDispatcher) dispatch(ctx context.Context, head *types.Header) {
+	number := head.Number.Uint64()
+	d.mu.Lock()
+	if ctx.Err() != nil {
+		// the subscription was released in the meantime
+		d.mu.Unlock()
+		return
+	}
+	if hash, ok := d.recent[number]; ok && hash == head.Hash() {
+		// already dispatched, e.g. by a backfill
+		d.mu.Unlock()
+		return
+	}
+	if number > d.last {
+		d.last = number
+	}
+	d.recent[number] = head.Hash()
+	delete(d.recent, number-recentHeads)
+	for _, ch := range d.heads {
+		select {
+		case ch <- head:
+		default:
+			log.Println("dropping head", number, "for slow listener")
+		}
+	}
+	waiting := len(d.waiters) > 0
+	heads := append(d.unresolved, head)
+	d.unresolved = nil
+	d.mu.Unlock()
+	if !waiting {
+		return
+	}
+	var unresolved []*types.Header
+	for _, h := range heads {
+		if !d.notifyWaiters(ctx, h) {
+			unresolved = append(unresolved, h)
+		}
+	}
+	// blocks, that can not be looked up for so long, were most likely reorged out
+	if len(unresolved) > recentHeads {
+		unresolved = unresolved[len(unresolved)-recentHeads:]
+	}
+	d.mu.Lock()
+	d.unresolved = append(unresolved, d.unresolved...)
+	d.mu.Unlock()
+}
+
+// notifyWaiters fetches the receipts of all awaited transactions in the block of head
+// with a single block lookup. It returns false, if a lookup failed and the block has to
+// be checked again.
+func (d *HeadDispatcher) notifyWaiters(ctx context.Context, head *types.Header) bool {
+	block, err := d.client.BlockByHash(ctx, head.Hash())
+	if err != nil {
+		log.Println("err when fetching block", head.Number, err)
+		return false
+	}
+	resolved := true
+	for _, tx := range block.Transactions() {
+		d.mu.Lock()
+		waiters := append([]chan *types.Receipt{}, d.waiters[tx.Hash()]...)
+		d.mu.Unlock()
+		if len(waiters) == 0 {
+			continue
+		}
+		receipt, err := d.client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			log.Println("err when checking tx", tx.Hash().Hex(), err)
+			resolved = false
+			continue
+		}
+		for _, ch := range waiters {
+			select {
+			case ch <- receipt:
+			default:
+			}
+		}
+	}
+	return resolved
+}
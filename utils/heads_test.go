@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"gotest.tools/assert"
+)
+
+// droppableBackend counts the head subscriptions and allows to drop the current one.
+type droppableBackend struct {
+	Backend
+	mu            sync.Mutex
+	subscriptions int
+	current       *droppableSubscription
+}
+
+type droppableSubscription struct {
+	ethereum.Subscription
+	err chan error
+}
+
+func (s *droppableSubscription) Err() <-chan error {
+	return s.err
+}
+
+func (b *droppableBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	sub, err := b.Backend.SubscribeNewHead(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions++
+	b.current = &droppableSubscription{Subscription: sub, err: make(chan error, 1)}
+	return b.current, nil
+}
+
+func (b *droppableBackend) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current.Unsubscribe()
+	b.current.err <- errors.New("connection lost")
+}
+
+func (b *droppableBackend) subscriptionCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscriptions
+}
+
+func receiveHead(t *testing.T, heads <-chan *types.Header) uint64 {
+	t.Helper()
+	select {
+	case head := <-heads:
+		return head.Number.Uint64()
+	case <-time.After(5 * time.Second):
+		t.Fatal("no head received")
+	}
+	return 0
+}
+
+func TestHeadDispatcherSharesSubscription(t *testing.T) {
+	sim, account := createNonceTestAccount(t)
+	backend := &droppableBackend{Backend: sim.Client()}
+	dispatcher := NewHeadDispatcher(backend)
+	heads, unsubscribe := dispatcher.SubscribeHeads()
+	defer unsubscribe()
+
+	var txs []*types.Transaction
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		txs = append(txs, sendWithNonce(t, backend, account, nonce))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	receipts := make([]*types.Receipt, len(txs))
+	var wg sync.WaitGroup
+	for i, tx := range txs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			receipt, err := dispatcher.WaitForReceipt(ctx, tx.Hash())
+			assert.NilError(t, err)
+			receipts[i] = receipt
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	sim.Commit()
+	wg.Wait()
+
+	assert.Equal(t, receiveHead(t, heads), uint64(1))
+	for i, receipt := range receipts {
+		assert.Equal(t, receipt.TxHash, txs[i].Hash())
+		assert.Equal(t, receipt.BlockNumber.Uint64(), uint64(1))
+	}
+	assert.Equal(t, backend.subscriptionCount(), 1)
+
+	// a transaction, that was included before, is found without a new head
+	receipt, err := dispatcher.WaitForReceipt(ctx, txs[0].Hash())
+	assert.NilError(t, err)
+	assert.Equal(t, receipt.TxHash, txs[0].Hash())
+}
+
+func TestHeadDispatcherBackfill(t *testing.T) {
+	reconnectDelay := headReconnectDelay
+	headReconnectDelay = 200 * time.Millisecond
+	defer func() { headReconnectDelay = reconnectDelay }()
+
+	sim := simulated.NewBackend(types.GenesisAlloc{})
+	defer sim.Close()
+	backend := &droppableBackend{Backend: sim.Client()}
+	dispatcher := NewHeadDispatcher(backend)
+	heads, unsubscribe := dispatcher.SubscribeHeads()
+	defer unsubscribe()
+	// give the dispatcher time to subscribe
+	time.Sleep(100 * time.Millisecond)
+
+	sim.Commit()
+	assert.Equal(t, receiveHead(t, heads), uint64(1))
+
+	backend.drop()
+	sim.Commit()
+	sim.Commit()
+	assert.Equal(t, receiveHead(t, heads), uint64(2))
+	assert.Equal(t, receiveHead(t, heads), uint64(3))
+	sim.Commit()
+	assert.Equal(t, receiveHead(t, heads), uint64(4))
+	assert.Equal(t, backend.subscriptionCount(), 2)
+
+	select {
+	case head := <-heads:
+		t.Fatalf("unexpected head %v", head.Number)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// flakyBackend fails the next receipt lookups.
+type flakyBackend struct {
+	Backend
+	mu       sync.Mutex
+	failures int
+}
+
+func (b *flakyBackend) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		return nil, errors.New("connection reset")
+	}
+	return b.Backend.TransactionReceipt(ctx, hash)
+}
+
+func TestHeadDispatcherRetriesFailedLookups(t *testing.T) {
+	sim, account := createNonceTestAccount(t)
+	// the check before waiting and the lookup for the first head fail
+	backend := &flakyBackend{Backend: sim.Client(), failures: 2}
+	dispatcher := NewHeadDispatcher(backend)
+	tx := sendWithNonce(t, backend, account, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	receipts := make(chan *types.Receipt, 1)
+	go func() {
+		receipt, err := dispatcher.WaitForReceipt(ctx, tx.Hash())
+		assert.Check(t, err)
+		receipts <- receipt
+	}()
+	time.Sleep(100 * time.Millisecond)
+	sim.Commit()
+
+	select {
+	case <-receipts:
+		t.Fatal("the lookup of the receipt should have failed")
+	case <-time.After(200 * time.Millisecond):
+	}
+	// the block of the transaction is checked again with the next head
+	sim.Commit()
+	select {
+	case receipt := <-receipts:
+		assert.Equal(t, receipt.TxHash, tx.Hash())
+		assert.Equal(t, receipt.BlockNumber.Uint64(), uint64(1))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no receipt received")
+	}
+}
@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var errNoNonceManager = errors.New("account has no nonce manager")
+
+// NonceManager hands out the nonces for a set of accounts. Allocation is serialised per
+// address, so that accounts can be shared between goroutines. The first allocation for
+// an address and every Resync read the nonces from the node. Nonces, that were allocated
+// but whose transactions were never sent, can be released and are handed out again,
+// before new nonces are allocated.
+type NonceManager struct {
+	client   Backend
+	mu       sync.Mutex
+	accounts map[common.Address]*nonceState
+}
+
+type nonceState struct {
+	mu     sync.Mutex
+	synced bool
+	next   uint64
+	// allocated nonces, that were not seen mined at the last resync
+	pending map[uint64]bool
+	// released nonces below next, in ascending order
+	gaps []uint64
+}
+
+func NewNonceManager(client Backend) *NonceManager {
+	return &NonceManager{
+		client:   client,
+		accounts: make(map[common.Address]*nonceState),
+	}
+}
+
+func (m *NonceManager) state(address common.Address) *nonceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.accounts[address]
+	if !ok {
+		s = &nonceState{pending: make(map[uint64]bool)}
+		m.accounts[address] = s
+	}
+	return s
+}
+
+// Next allocates a nonce for address. Released nonces are reused first.
+func (m *NonceManager) Next(ctx context.Context, address common.Address) (uint64, error) {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.synced {
+		err := m.resync(ctx, address, s)
+		if err != nil {
+			return 0, err
+		}
+	}
+	var nonce uint64
+	if len(s.gaps) > 0 {
+		nonce = s.gaps[0]
+		s.gaps = s.gaps[1:]
+	} else {
+		nonce = s.next
+		s.next++
+	}
+	s.pending[nonce] = true
+	return nonce, nil
+}
+
+// Release gives back an allocated nonce, whose transaction was not sent. Without
+// reusing it, all later transactions of the account would be stuck behind the gap.
+func (m *NonceManager) Release(address common.Address, nonce uint64) {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending[nonce] {
+		return
+	}
+	delete(s.pending, nonce)
+	s.addGap(nonce)
+	s.trimGaps()
+}
+
+// Reserve marks nonce of address as allocated, e.g. for a transaction, that is still in
+// flight after a restart. Later allocations come after it, also when the node does not
+// know the transaction.
+func (m *NonceManager) Reserve(address common.Address, nonce uint64) {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[nonce] = true
+	s.next = max(s.next, nonce+1)
+	i := sort.Search(len(s.gaps), func(i int) bool { return s.gaps[i] >= nonce })
+	if i < len(s.gaps) && s.gaps[i] == nonce {
+		s.gaps = append(s.gaps[:i], s.gaps[i+1:]...)
+	}
+}
+
+// trimGaps hands the gaps at the end back, they are not gaps, just unused nonces.
+func (s *nonceState) trimGaps() {
+	for len(s.gaps) > 0 && s.gaps[len(s.gaps)-1] == s.next-1 {
+		s.gaps = s.gaps[:len(s.gaps)-1]
+		s.next--
+	}
+}
+
+func (s *nonceState) addGap(nonce uint64) {
+	i := sort.Search(len(s.gaps), func(i int) bool { return s.gaps[i] >= nonce })
+	if i < len(s.gaps) && s.gaps[i] == nonce {
+		return
+	}
+	s.gaps = append(s.gaps, 0)
+	copy(s.gaps[i+1:], s.gaps[i:])
+	s.gaps[i] = nonce
+}
+
+// Resync reads the mined and the pending nonce of address from the node. It should be
+// called, when the node rejected a transaction because of its nonce.
+func (m *NonceManager) Resync(ctx context.Context, address common.Address) error {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return m.resync(ctx, address, s)
+}
+
+func (m *NonceManager) resync(ctx context.Context, address common.Address, s *nonceState) error {
+	mined, err := m.client.NonceAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("could not query nonce of %v: %w", address.Hex(), err)
+	}
+	poolNonce, err := m.client.PendingNonceAt(ctx, address)
+	if err != nil {
+		return fmt.Errorf("could not query pending nonce of %v: %w", address.Hex(), err)
+	}
+	for nonce := range s.pending {
+		if nonce < mined {
+			delete(s.pending, nonce)
+		}
+	}
+	gaps := s.gaps[:0]
+	for _, nonce := range s.gaps {
+		if nonce >= mined {
+			gaps = append(gaps, nonce)
+		}
+	}
+	s.gaps = gaps
+	if !s.synced || poolNonce >= s.next {
+		// the node knows all nonces allocated so far, some of them were used
+		// outside of this manager. Reserved nonces are kept, before the first sync.
+		s.next = max(poolNonce, mined, s.next)
+		s.gaps = s.gaps[:0]
+	} else {
+		// the node dropped transactions with allocated nonces, they are reissued
+		for nonce := range s.pending {
+			if nonce >= max(poolNonce, mined) {
+				delete(s.pending, nonce)
+				s.addGap(nonce)
+			}
+		}
+		s.trimGaps()
+	}
+	if s.synced {
+		log.Printf("resynced nonce of %v: mined %v, pool %v, next %v, gaps %v\n", address.Hex(), mined, poolNonce, s.next, s.gaps)
+	}
+	s.synced = true
+	return nil
+}
+
+// SyncMined only moves the nonces of address forward to its mined nonce. Unlike Resync, it
+// never reissues allocated nonces, that the pool does not know. It is the one to use for
+// accounts, whose transactions are encrypted and only reach the node, when they are included.
+func (m *NonceManager) SyncMined(ctx context.Context, address common.Address) error {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mined, err := m.client.NonceAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("could not query nonce of %v: %w", address.Hex(), err)
+	}
+	for nonce := range s.pending {
+		if nonce < mined {
+			delete(s.pending, nonce)
+		}
+	}
+	gaps := s.gaps[:0]
+	for _, nonce := range s.gaps {
+		if nonce >= mined {
+			gaps = append(gaps, nonce)
+		}
+	}
+	s.gaps = gaps
+	s.next = max(s.next, mined)
+	s.synced = true
+	log.Printf("synced mined nonce of %v: mined %v, next %v, gaps %v\n", address.Hex(), mined, s.next, s.gaps)
+	return nil
+}
+
+// Pending returns the allocated nonces of address, that were not mined at the last resync.
+func (m *NonceManager) Pending(address common.Address) []uint64 {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []uint64
+	for nonce := range s.pending {
+		result = append(result, nonce)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Gaps returns the released nonces of address, that were not handed out again.
+func (m *NonceManager) Gaps(address common.Address) []uint64 {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64{}, s.gaps...)
+}
+
+// FillGaps sends a transfer of 1 wei from account to itself for every released nonce,
+// so that the transactions with higher nonces can be mined.
+func (m *NonceManager) FillGaps(ctx context.Context, account *Account) ([]*types.Transaction, error) {
+	var txs []*types.Transaction
+	gasPrice, err := m.client.SuggestGasPrice(ctx)
+	if err != nil {
+		return txs, err
+	}
+	gasPrice = new(big.Int).Add(gasPrice, gasPrice)
+	for {
+		nonce, ok := m.takeGap(account.Address)
+		if !ok {
+			return txs, nil
+		}
+		tx := types.NewTransaction(nonce, account.Address, big.NewInt(1), 21000, gasPrice, nil)
+		signedTx, err := account.Sign(account.Address, tx)
+		if err != nil {
+			m.Release(account.Address, nonce)
+			return txs, err
+		}
+		err = m.client.SendTransaction(ctx, signedTx)
+		if err != nil {
+			m.Release(account.Address, nonce)
+			return txs, err
+		}
+		log.Println("sent gap filling tx", signedTx.Hash().Hex(), "with nonce", nonce)
+		txs = append(txs, signedTx)
+	}
+}
+
+// takeGap allocates the lowest released nonce of address. It returns false, if there
+// is none, e.g. because another goroutine took it in the meantime.
+func (m *NonceManager) takeGap(address common.Address) (uint64, bool) {
+	s := m.state(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.gaps) == 0 {
+		return 0, false
+	}
+	nonce := s.gaps[0]
+	s.gaps = s.gaps[1:]
+	s.pending[nonce] = true
+	return nonce, true
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"gotest.tools/assert"
+)
+
+func createNonceTestAccount(t *testing.T) (*simulated.Backend, *Account) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	assert.NilError(t, err)
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(1e18)},
+	})
+	t.Cleanup(func() { sim.Close() })
+	chainID, err := sim.Client().ChainID(context.Background())
+	assert.NilError(t, err)
+	account, err := AccountFromPrivateKey(key, types.LatestSignerForChainID(chainID))
+	assert.NilError(t, err)
+	account.Nonces = NewNonceManager(sim.Client())
+	return sim, &account
+}
+
+func sendWithNonce(t *testing.T, client Backend, account *Account, nonce uint64) *types.Transaction {
+	t.Helper()
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	assert.NilError(t, err)
+	tx, err := account.Sign(account.Address, types.NewTransaction(nonce, account.Address, big.NewInt(1), 21000, gasPrice, nil))
+	assert.NilError(t, err)
+	assert.NilError(t, client.SendTransaction(context.Background(), tx))
+	return tx
+}
+
+func TestNonceManagerConcurrentAllocation(t *testing.T) {
+	_, account := createNonceTestAccount(t)
+
+	var mu sync.Mutex
+	var nonces []uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := account.NextNonce()
+			assert.NilError(t, err)
+			mu.Lock()
+			nonces = append(nonces, nonce)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	for i, nonce := range nonces {
+		assert.Equal(t, nonce, uint64(i))
+	}
+	assert.Equal(t, len(account.Nonces.Pending(account.Address)), 50)
+}
+
+func TestNonceManagerRelease(t *testing.T) {
+	_, account := createNonceTestAccount(t)
+	for i := 0; i < 3; i++ {
+		_, err := account.NextNonce()
+		assert.NilError(t, err)
+	}
+
+	account.ReleaseNonce(1)
+	assert.DeepEqual(t, account.Nonces.Gaps(account.Address), []uint64{1})
+	nonce, err := account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(1))
+
+	// releasing the highest nonce does not leave a gap
+	account.ReleaseNonce(2)
+	assert.Equal(t, len(account.Nonces.Gaps(account.Address)), 0)
+	nonce, err = account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(2))
+
+	// nonces, that were not allocated, are ignored
+	account.ReleaseNonce(7)
+	nonce, err = account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(3))
+}
+
+func TestNonceManagerResync(t *testing.T) {
+	sim, account := createNonceTestAccount(t)
+	client := sim.Client()
+
+	nonce, err := account.NextNonce()
+	assert.NilError(t, err)
+	sendWithNonce(t, client, account, nonce)
+	// the account is used outside of the manager
+	sendWithNonce(t, client, account, nonce+1)
+	sim.Commit()
+
+	assert.NilError(t, account.ResyncNonce())
+	assert.Equal(t, len(account.Nonces.Pending(account.Address)), 0)
+	nonce, err = account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(2))
+
+	// released nonces, that were used by someone else, are no gaps anymore
+	account.ReleaseNonce(nonce)
+	lost, err := account.NextNonce()
+	assert.NilError(t, err)
+	_, err = account.NextNonce()
+	assert.NilError(t, err)
+	account.ReleaseNonce(lost)
+	assert.DeepEqual(t, account.Nonces.Gaps(account.Address), []uint64{lost})
+	sendWithNonce(t, client, account, lost)
+	sendWithNonce(t, client, account, lost+1)
+	sim.Commit()
+	assert.NilError(t, account.ResyncNonce())
+	assert.Equal(t, len(account.Nonces.Gaps(account.Address)), 0)
+	nonce, err = account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, lost+2)
+}
+
+func TestNonceManagerResyncDroppedTxs(t *testing.T) {
+	sim, account := createNonceTestAccount(t)
+	client := sim.Client()
+
+	var nonces []uint64
+	for i := 0; i < 3; i++ {
+		nonce, err := account.NextNonce()
+		assert.NilError(t, err)
+		nonces = append(nonces, nonce)
+	}
+	sendWithNonce(t, client, account, nonces[0])
+	sim.Commit()
+	sendWithNonce(t, client, account, nonces[1])
+	sendWithNonce(t, client, account, nonces[2])
+	// the node drops the pooled transactions
+	sim.Rollback()
+
+	assert.NilError(t, account.ResyncNonce())
+	assert.Equal(t, len(account.Nonces.Pending(account.Address)), 0)
+	assert.Equal(t, len(account.Nonces.Gaps(account.Address)), 0)
+	nonce, err := account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, nonces[1], "the dropped nonces are reissued")
+}
+
+func TestNonceManagerSyncMined(t *testing.T) {
+	sim, account := createNonceTestAccount(t)
+	client := sim.Client()
+
+	mined, err := account.NextNonce()
+	assert.NilError(t, err)
+	sendWithNonce(t, client, account, mined)
+	sim.Commit()
+	// an encrypted transaction, the node does not know it
+	encrypted, err := account.NextNonce()
+	assert.NilError(t, err)
+
+	assert.NilError(t, account.SyncMinedNonce())
+	assert.DeepEqual(t, account.Nonces.Pending(account.Address), []uint64{encrypted})
+	assert.Equal(t, len(account.Nonces.Gaps(account.Address)), 0)
+	nonce, err := account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, encrypted+1, "the nonce of the encrypted transaction is not handed out again")
+
+	// nonces used outside of the manager move it forward
+	sendWithNonce(t, client, account, encrypted)
+	sendWithNonce(t, client, account, encrypted+1)
+	sendWithNonce(t, client, account, encrypted+2)
+	sim.Commit()
+	assert.NilError(t, account.SyncMinedNonce())
+	assert.Equal(t, len(account.Nonces.Pending(account.Address)), 0)
+	nonce, err = account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, encrypted+3)
+}
+
+func TestNonceManagerReserve(t *testing.T) {
+	_, account := createNonceTestAccount(t)
+
+	// reserved before the first sync, the node does not know the nonces
+	account.ReserveNonce(1)
+	account.ReserveNonce(3)
+	nonce, err := account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(4))
+	assert.DeepEqual(t, account.Nonces.Pending(account.Address), []uint64{1, 3, 4})
+
+	// a reserved gap is not handed out again
+	account.ReleaseNonce(3)
+	assert.DeepEqual(t, account.Nonces.Gaps(account.Address), []uint64{3})
+	account.ReserveNonce(3)
+	assert.Equal(t, len(account.Nonces.Gaps(account.Address)), 0)
+	nonce, err = account.NextNonce()
+	assert.NilError(t, err)
+	assert.Equal(t, nonce, uint64(5))
+}
+
+func TestNonceManagerFillGaps(t *testing.T) {
+	sim, account := createNonceTestAccount(t)
+	client := sim.Client()
+
+	var nonces []uint64
+	for i := 0; i < 3; i++ {
+		nonce, err := account.NextNonce()
+		assert.NilError(t, err)
+		nonces = append(nonces, nonce)
+	}
+	sendWithNonce(t, client, account, nonces[0])
+	sendWithNonce(t, client, account, nonces[2])
+	account.ReleaseNonce(nonces[1])
+	sim.Commit()
+	mined, err := client.NonceAt(context.Background(), account.Address, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, mined, uint64(1), "the gap blocks nonce 2")
+
+	txs, err := account.Nonces.FillGaps(context.Background(), account)
+	assert.NilError(t, err)
+	assert.Equal(t, len(txs), 1)
+	assert.Equal(t, txs[0].Nonce(), nonces[1])
+	sim.Commit()
+	mined, err = client.NonceAt(context.Background(), account.Address, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, mined, uint64(3))
+}
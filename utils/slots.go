@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrFutureSlot is returned for slots, that did not start before the current head.
+var ErrFutureSlot = errors.New("slot is after the current head")
+
+// SlotClock converts between the slots of a beacon chain and time.
+type SlotClock struct {
+	Genesis       time.Time
+	SlotDuration  time.Duration
+	SlotsPerEpoch uint64
+}
+
+func NewSlotClock(genesisTimestamp, secondsPerSlot, slotsPerEpoch uint64) (SlotClock, error) {
+	if secondsPerSlot == 0 {
+		return SlotClock{}, fmt.Errorf("the slot duration is not configured")
+	}
+	return SlotClock{
+		Genesis:       time.Unix(int64(genesisTimestamp), 0),
+		SlotDuration:  time.Duration(secondsPerSlot) * time.Second,
+		SlotsPerEpoch: slotsPerEpoch,
+	}, nil
+}
+
+// SlotAt returns the slot, that t falls into. Times before genesis are in slot 0.
+func (c SlotClock) SlotAt(t time.Time) int64 {
+	if t.Before(c.Genesis) {
+		return 0
+	}
+	return int64(t.Sub(c.Genesis) / c.SlotDuration)
+}
+
+// SlotStart returns the time, when slot starts. It is the timestamp of the block of slot.
+func (c SlotClock) SlotStart(slot int64) time.Time {
+	return c.Genesis.Add(time.Duration(slot) * c.SlotDuration)
+}
+
+// SlotDeadline returns the time, when slot ends and the next one starts.
+func (c SlotClock) SlotDeadline(slot int64) time.Time {
+	return c.SlotStart(slot + 1)
+}
+
+// NextSlot returns the first slot, that starts after t.
+func (c SlotClock) NextSlot(t time.Time) int64 {
+	return c.SlotAt(t) + 1
+}
+
+// Epoch returns the epoch of slot, or 0 if the slots per epoch are unknown.
+func (c SlotClock) Epoch(slot int64) int64 {
+	if c.SlotsPerEpoch == 0 {
+		return 0
+	}
+	return slot / int64(c.SlotsPerEpoch)
+}
+
+// HeaderReader is the part of a client, that the SlotService needs.
+type HeaderReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// SlotService maps blocks to the slots they were proposed in and back. Every block has the
+// start of its slot as timestamp, so a slot without block was missed. The slots of the
+// blocks, that were looked up or observed, are cached.
+type SlotService struct {
+	Clock  SlotClock
+	client HeaderReader
+
+	mu      sync.Mutex
+	byBlock map[uint64]int64
+	bySlot  map[int64]uint64
+}
+
+func NewSlotService(client HeaderReader, clock SlotClock) *SlotService {
+	return &SlotService{
+		Clock:   clock,
+		client:  client,
+		byBlock: make(map[uint64]int64),
+		bySlot:  make(map[int64]uint64),
+	}
+}
+
+// Observe caches the slot of header, e.g. of a new head, and returns it.
+func (s *SlotService) Observe(header *types.Header) int64 {
+	slot := s.Clock.SlotAt(time.Unix(int64(header.Time), 0))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byBlock[header.Number.Uint64()] = slot
+	s.bySlot[slot] = header.Number.Uint64()
+	return slot
+}
+
+func (s *SlotService) header(ctx context.Context, number *big.Int) (*types.Header, int64, error) {
+	header, err := s.client.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, 0, err
+	}
+	return header, s.Observe(header), nil
+}
+
+// Head returns the current head and its slot.
+func (s *SlotService) Head(ctx context.Context) (*types.Header, int64, error) {
+	return s.header(ctx, nil)
+}
+
+// SlotOfBlock returns the slot of block number.
+func (s *SlotService) SlotOfBlock(ctx context.Context, number uint64) (int64, error) {
+	s.mu.Lock()
+	slot, ok := s.byBlock[number]
+	s.mu.Unlock()
+	if ok {
+		return slot, nil
+	}
+	_, slot, err := s.header(ctx, new(big.Int).SetUint64(number))
+	return slot, err
+}
+
+// BlockOfSlot returns the number of the block proposed in slot. It returns false, if the
+// slot was missed, and ErrFutureSlot, if the slot is after the current head.
+func (s *SlotService) BlockOfSlot(ctx context.Context, slot int64) (uint64, bool, error) {
+	s.mu.Lock()
+	number, ok := s.bySlot[slot]
+	s.mu.Unlock()
+	if ok {
+		return number, true, nil
+	}
+	head, headSlot, err := s.header(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if slot > headSlot {
+		return 0, false, ErrFutureSlot
+	}
+	first, slotOfFirst, err := s.firstBlockFrom(ctx, slot, head.Number.Uint64(), headSlot)
+	if err != nil {
+		return 0, false, err
+	}
+	return first, slotOfFirst == slot, nil
+}
+
+// MissedSlots returns the slots in [from, to], that have no block. to must not be after
+// the current head.
+func (s *SlotService) MissedSlots(ctx context.Context, from, to int64) ([]int64, error) {
+	head, headSlot, err := s.header(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if to > headSlot {
+		return nil, ErrFutureSlot
+	}
+	number, slot, err := s.firstBlockFrom(ctx, from, head.Number.Uint64(), headSlot)
+	if err != nil {
+		return nil, err
+	}
+	var missed []int64
+	for expected := from; expected <= to; expected++ {
+		if slot > expected {
+			missed = append(missed, expected)
+			continue
+		}
+		// slot == expected, continue with the block of the next slot
+		if expected == to {
+			break
+		}
+		number++
+		slot, err = s.SlotOfBlock(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missed, nil
+}
+
+// firstBlockFrom returns the first block, that was proposed in slot or later, and its slot.
+// As there is at most one block per slot, it is not further back from head than the slots.
+func (s *SlotService) firstBlockFrom(ctx context.Context, slot int64, head uint64, headSlot int64) (uint64, int64, error) {
+	low := uint64(0)
+	if distance := uint64(headSlot - slot); distance < head {
+		low = head - distance
+	}
+	high := head
+	for low < high {
+		middle := low + (high-low)/2
+		middleSlot, err := s.SlotOfBlock(ctx, middle)
+		if err != nil {
+			return 0, 0, err
+		}
+		if middleSlot < slot {
+			low = middle + 1
+		} else {
+			high = middle
+		}
+	}
+	found, err := s.SlotOfBlock(ctx, low)
+	return low, found, err
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"gotest.tools/assert"
+)
+
+// fakeHeaders is a chain with a block in every slot but the missed ones.
+type fakeHeaders struct {
+	headers []*types.Header
+	lookups int
+}
+
+func newFakeHeaders(clock SlotClock, firstSlot, lastSlot int64, missed ...int64) *fakeHeaders {
+	skip := make(map[int64]bool)
+	for _, slot := range missed {
+		skip[slot] = true
+	}
+	f := &fakeHeaders{}
+	for slot := firstSlot; slot <= lastSlot; slot++ {
+		if skip[slot] {
+			continue
+		}
+		f.headers = append(f.headers, &types.Header{
+			Number: big.NewInt(int64(len(f.headers))),
+			Time:   uint64(clock.SlotStart(slot).Unix()),
+		})
+	}
+	return f
+}
+
+func (f *fakeHeaders) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	f.lookups++
+	if number == nil {
+		return f.headers[len(f.headers)-1], nil
+	}
+	if number.Uint64() >= uint64(len(f.headers)) {
+		return nil, fmt.Errorf("unknown block %v", number)
+	}
+	return f.headers[number.Uint64()], nil
+}
+
+func TestSlotClock(t *testing.T) {
+	clock, err := NewSlotClock(1000, 5, 16)
+	assert.NilError(t, err)
+	assert.Equal(t, clock.SlotAt(time.Unix(1000, 0)), int64(0))
+	assert.Equal(t, clock.SlotAt(time.Unix(1004, 999)), int64(0))
+	assert.Equal(t, clock.SlotAt(time.Unix(1005, 0)), int64(1))
+	assert.Equal(t, clock.SlotAt(time.Unix(10, 0)), int64(0))
+	assert.Equal(t, clock.SlotStart(3), time.Unix(1015, 0))
+	assert.Equal(t, clock.SlotDeadline(3), time.Unix(1020, 0))
+	assert.Equal(t, clock.NextSlot(time.Unix(1016, 0)), int64(4))
+	assert.Equal(t, clock.Epoch(15), int64(0))
+	assert.Equal(t, clock.Epoch(16), int64(1))
+
+	_, err = NewSlotClock(1000, 0, 16)
+	assert.ErrorContains(t, err, "slot duration")
+}
+
+func TestSlotService(t *testing.T) {
+	clock, err := NewSlotClock(1000, 5, 16)
+	assert.NilError(t, err)
+	// block n is in slot 100+n up to the missed slots 103 and 107, 108
+	headers := newFakeHeaders(clock, 100, 120, 103, 107, 108)
+	slots := NewSlotService(headers, clock)
+	ctx := context.Background()
+
+	slot, err := slots.SlotOfBlock(ctx, 4)
+	assert.NilError(t, err)
+	assert.Equal(t, slot, int64(105))
+
+	number, found, err := slots.BlockOfSlot(ctx, 109)
+	assert.NilError(t, err)
+	assert.Assert(t, found)
+	assert.Equal(t, number, uint64(6))
+
+	_, found, err = slots.BlockOfSlot(ctx, 103)
+	assert.NilError(t, err)
+	assert.Assert(t, !found)
+
+	_, _, err = slots.BlockOfSlot(ctx, 121)
+	assert.Assert(t, errors.Is(err, ErrFutureSlot))
+
+	missed, err := slots.MissedSlots(ctx, 100, 120)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, missed, []int64{103, 107, 108})
+	missed, err = slots.MissedSlots(ctx, 107, 109)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, missed, []int64{107, 108})
+
+	// the blocks are cached
+	lookups := headers.lookups
+	number, found, err = slots.BlockOfSlot(ctx, 115)
+	assert.NilError(t, err)
+	assert.Assert(t, found)
+	assert.Equal(t, number, uint64(12))
+	assert.Equal(t, headers.lookups, lookups)
+}
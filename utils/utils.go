@@ -16,23 +16,19 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	keybroadcastcontract "github.com/shutter-network/contracts/v2/bindings/keybroadcastcontract"
 	keypersetmanager "github.com/shutter-network/contracts/v2/bindings/keypersetmanager"
 	sequencerBindings "github.com/shutter-network/contracts/v2/bindings/sequencer"
+	"github.com/shutter-network/nethermind-tests/config"
 	"github.com/shutter-network/rolling-shutter/rolling-shutter/medley/identitypreimage"
 	"github.com/shutter-network/shutter/shlib/shcrypto"
 	"golang.org/x/exp/maps"
 )
 
-const GnosisGenesisTimestamp = 1665396300
-const ChiadoGenesisTimestamp = 0
-
 func EnableExtLoggingFile() {
 	logFile, err := os.OpenFile(fmt.Sprintf("./logs/%s.log", time.Now().Format(time.RFC3339)), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
@@ -47,29 +43,64 @@ type Account struct {
 	Address    common.Address
 	privateKey *ecdsa.PrivateKey
 	Sign       bind.SignerFn
-	Nonce      *big.Int
+	// allocates the nonces of the account, shared by all copies of the account
+	Nonces *NonceManager
 }
 
-func (acc *Account) Opts() *bind.TransactOpts {
+func (acc *Account) Opts() (*bind.TransactOpts, error) {
 	opts := bind.TransactOpts{}
-	nonce := acc.UseNonce()
-	opts.Nonce = nonce
+	nonce, err := acc.NextNonce()
+	if err != nil {
+		return nil, err
+	}
+	opts.Nonce = new(big.Int).SetUint64(nonce)
 	opts.From = acc.Address
 	opts.Signer = acc.Sign
-	return &opts
+	return &opts, nil
+}
+
+// NextNonce allocates the next nonce of the account from its nonce manager.
+func (acc *Account) NextNonce() (uint64, error) {
+	if acc.Nonces == nil {
+		return 0, errNoNonceManager
+	}
+	return acc.Nonces.Next(context.Background(), acc.Address)
+}
+
+// ReleaseNonce gives back a nonce, whose transaction could not be sent.
+func (acc *Account) ReleaseNonce(nonce uint64) {
+	if acc.Nonces != nil {
+		acc.Nonces.Release(acc.Address, nonce)
+	}
 }
 
-// Returns the currently stored account nonce and increases the stored value
-func (acc *Account) UseNonce() *big.Int {
-	one := big.NewInt(1)
-	result := acc.Nonce
-	acc.Nonce = big.NewInt(0).Add(result, one)
-	return result
+// ReserveNonce marks a nonce of the account as allocated, that was allocated before a restart.
+func (acc *Account) ReserveNonce(nonce uint64) {
+	if acc.Nonces != nil {
+		acc.Nonces.Reserve(acc.Address, nonce)
+	}
+}
+
+// ResyncNonce reads the nonce of the account from the node again.
+func (acc *Account) ResyncNonce() error {
+	if acc.Nonces == nil {
+		return errNoNonceManager
+	}
+	return acc.Nonces.Resync(context.Background(), acc.Address)
+}
+
+// SyncMinedNonce moves the nonce of the account forward to the mined one, without reissuing
+// the nonces of its encrypted transactions.
+func (acc *Account) SyncMinedNonce() error {
+	if acc.Nonces == nil {
+		return errNoNonceManager
+	}
+	return acc.Nonces.SyncMined(context.Background(), acc.Address)
 }
 
 // contains all the setup required to interact with the chain
 type StressSetup struct {
-	Client                   *ethclient.Client
+	Client                   Backend
 	SignerForChain           types.Signer
 	ChainID                  *big.Int
 	SubmitAccount            *Account
@@ -78,6 +109,7 @@ type StressSetup struct {
 	SequencerContractAddress common.Address
 	KeyperSetManager         keypersetmanager.Keypersetmanager
 	KeyBroadcastContract     keybroadcastcontract.Keybroadcastcontract
+	EonKeys                  *EonKeyService
 }
 
 // contains the context for the current stress test to create transactions
@@ -109,7 +141,7 @@ type GasLimitFn func(data []byte, toAddress *common.Address, i int, count int) u
 type GasPriceFn func(suggestedGasTipCap *big.Int, suggestedGasPrice *big.Int, i int, count int) (GasFeeCap, GasTipCap)
 
 // applies the DefaultGasPriceFn to the client suggested gas
-func GasCalculationFromClient(ctx context.Context, client *ethclient.Client, gasPriceFn GasPriceFn) (GasCalculation, error) {
+func GasCalculationFromClient(ctx context.Context, client Backend, gasPriceFn GasPriceFn) (GasCalculation, error) {
 	result := GasCalculation{}
 	gasTipCap, err := client.SuggestGasTipCap(ctx)
 	if err != nil {
@@ -169,44 +201,21 @@ func MinGasTipUpdateFn(suggestedGasTipCap *big.Int, suggestedGasPrice *big.Int,
 
 type ConstraintFn func(inclusions []*types.Receipt) error
 
-// this waits for tx by only polling, when a new block is available
-func WaitForTxSubscribe(ctx context.Context, tx types.Transaction, description string, client *ethclient.Client) (*types.Receipt, error) {
+// WaitForTxSubscribe waits for the receipt of tx using the head subscription shared by
+// all users of client.
+func WaitForTxSubscribe(ctx context.Context, tx *types.Transaction, description string, client Backend) (*types.Receipt, error) {
 	log.Println("waiting for "+description+" ", tx.Hash().Hex())
-	var receipt *types.Receipt
-	newHeads := make(chan *types.Header)
-	sub, err := client.SubscribeNewHead(ctx, newHeads)
+	receipt, err := HeadsFor(client).WaitForReceipt(ctx, tx.Hash())
 	if err != nil {
 		return receipt, err
 	}
-	defer sub.Unsubscribe()
-	for {
-		select {
-		case <-ctx.Done():
-			return receipt, ctx.Err()
-		case _ = <-newHeads:
-			receipt, err = client.TransactionReceipt(ctx, tx.Hash())
-			if err == ethereum.NotFound {
-				continue
-			}
-			if err != nil {
-				log.Println("err when checking tx", tx.Hash().Hex(), err)
-				continue
-			}
-			if receipt != nil {
-				log.Println(description, "status", receipt.Status, "block", receipt.BlockNumber)
-				return receipt, nil
-			}
-
-		case err := <-sub.Err():
-			log.Println("error when watching heads:", err)
-			return receipt, err
-		}
-	}
+	log.Println(description, "status", receipt.Status, "block", receipt.BlockNumber)
+	return receipt, nil
 }
 
-func WaitForTxCtx(ctx context.Context, tx types.Transaction, description string, client *ethclient.Client) (*types.Receipt, error) {
+func WaitForTxCtx(ctx context.Context, tx *types.Transaction, description string, client Backend) (*types.Receipt, error) {
 	log.Println("waiting for "+description+" ", tx.Hash().Hex())
-	receipt, err := bind.WaitMined(ctx, client, &tx)
+	receipt, err := bind.WaitMined(ctx, client, tx)
 	if err != nil {
 		return nil, fmt.Errorf("error on WaitMined %s", err)
 	}
@@ -217,11 +226,11 @@ func WaitForTxCtx(ctx context.Context, tx types.Transaction, description string,
 	return receipt, nil
 }
 
-func WaitForTxTimeout(tx types.Transaction, description string, timeout time.Duration, client *ethclient.Client) (*types.Receipt, error) {
+func WaitForTxTimeout(tx *types.Transaction, description string, timeout time.Duration, client Backend) (*types.Receipt, error) {
 	log.Println("waiting for "+description+" ", tx.Hash().Hex())
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	receipt, err := bind.WaitMined(ctx, client, &tx)
+	receipt, err := bind.WaitMined(ctx, client, tx)
 	if err != nil {
 		return nil, fmt.Errorf("error on WaitMined %s", err)
 	}
@@ -261,7 +270,6 @@ func AccountFromPrivateKey(privateKey *ecdsa.PrivateKey, signerForChain types.Si
 		}
 		return tx.WithSignature(signerForChain, signature)
 	}
-	account.Nonce = big.NewInt(0)
 	return account, nil
 }
 
@@ -326,7 +334,7 @@ func ReadPks(r io.Reader) ([]*ecdsa.PrivateKey, error) {
 	return result, scanner.Err()
 }
 
-func FixNonce(client *ethclient.Client, account Account) error {
+func FixNonce(client Backend, account Account) error {
 	value := big.NewInt(1) // 1 wei
 	gasLimit := uint64(21000)
 
@@ -342,7 +350,7 @@ func FixNonce(client *ethclient.Client, account Account) error {
 		return err
 	}
 	log.Println("PendingNonce", pendingNonce)
-	var txs []types.Transaction
+	var txs []*types.Transaction
 	for i := uint64(0); i < pendingNonce-headNonce; i++ {
 		headNonce, err := client.NonceAt(context.Background(), account.Address, nil)
 		if err != nil {
@@ -365,12 +373,12 @@ func FixNonce(client *ethclient.Client, account Account) error {
 			log.Println("error on send", err)
 		}
 		log.Println("sent nonce fix tx", signedTx.Hash().Hex(), "to", account.Address)
-		txs = append(txs, *signedTx)
+		txs = append(txs, signedTx)
 	}
 
 	log.Println("waiting for tx")
 	for _, signedTx := range txs {
-		_, err = bind.WaitMined(context.Background(), client, &signedTx)
+		_, err = bind.WaitMined(context.Background(), client, signedTx)
 		if err != nil {
 			log.Println("error on wait", err)
 		}
@@ -383,7 +391,7 @@ func FixNonce(client *ethclient.Client, account Account) error {
 	return err
 }
 
-func Drain(ctx context.Context, account Account, balance uint64, target common.Address, client *ethclient.Client) {
+func Drain(ctx context.Context, account Account, balance uint64, target common.Address, client Backend) {
 	gasPrice, err := client.SuggestGasPrice(ctx)
 	if err != nil {
 		log.Println("could not query gasPrice")
@@ -442,22 +450,19 @@ type Contracts struct {
 	depositContractAddress   common.Address
 }
 
-// GetDepositContractAddressByChainID returns the deposit contract address for the given chain ID
-// Chain IDs: Gnosis = 100, Chiado = 10200
+// GetDepositContractAddressByChainID returns the deposit contract address of the known
+// preset for the given chain ID. Other chains configure it in their network profile.
 func GetDepositContractAddressByChainID(chainID *big.Int) (common.Address, error) {
-	var address common.Address
-	switch chainID.Uint64() {
-	case 100: // Gnosis Chain
-		address = common.HexToAddress("0x0B98057eA310F4d31F2a452B414647007d1645d9")
-	case 10200: // Chiado
-		address = common.HexToAddress("0xb97036A26259B7147018913bD58a774cf91acf25")
-	default:
-		return address, fmt.Errorf("unsupported chain ID: %v", chainID)
+	preset, ok := config.KnownPresets.Lookup(chainID)
+	if !ok || preset.Contracts.DepositContract == "" {
+		return common.Address{}, fmt.Errorf("unsupported chain ID: %v", chainID)
 	}
-	return address, nil
+	return common.HexToAddress(preset.Contracts.DepositContract), nil
 }
 
-func SetupContracts(client *ethclient.Client, KeyBroadcastContractAddress, SequencerContractAddress, KeyperSetManagerContractAddress string, chainID *big.Int) (Contracts, error) {
+// SetupContracts binds the shutter contracts. The deposit contract is looked up by chainID,
+// if DepositContractAddress is empty.
+func SetupContracts(client Backend, KeyBroadcastContractAddress, SequencerContractAddress, KeyperSetManagerContractAddress, DepositContractAddress string, chainID *big.Int) (Contracts, error) {
 	var setup Contracts
 	keyperSetManagerContract, err := keypersetmanager.NewKeypersetmanager(common.HexToAddress(KeyperSetManagerContractAddress), client)
 	if err != nil {
@@ -479,9 +484,12 @@ func SetupContracts(client *ethclient.Client, KeyBroadcastContractAddress, Seque
 	}
 
 	setup.Sequencer = sequencerContract
-	depositContractAddress, err := GetDepositContractAddressByChainID(chainID)
-	if err != nil {
-		return setup, fmt.Errorf("can not get deposit contract address: %v", err)
+	depositContractAddress := common.HexToAddress(DepositContractAddress)
+	if DepositContractAddress == "" {
+		depositContractAddress, err = GetDepositContractAddressByChainID(chainID)
+		if err != nil {
+			return setup, fmt.Errorf("can not get deposit contract address: %v", err)
+		}
 	}
 	depositContract, err := NewDepositcontract(depositContractAddress, client)
 	if err != nil {
@@ -493,7 +501,7 @@ func SetupContracts(client *ethclient.Client, KeyBroadcastContractAddress, Seque
 
 func GetEonKey(
 	ctx context.Context,
-	client *ethclient.Client,
+	client Backend,
 	keyperSetManager *keypersetmanager.Keypersetmanager,
 	keyBroadcastContract *keybroadcastcontract.Keybroadcastcontract,
 	KeyperSetChangeLookAhead int) (uint64, *shcrypto.EonPublicKey, error) {
@@ -547,15 +555,3 @@ func Difference(a, b []int64) []int64 {
 	}
 	return diff
 }
-
-func CollectBlockRangeFromArgs() (uint64, uint64) {
-	start, err := strconv.Atoi(os.Args[2])
-	if err != nil {
-		log.Fatalf("not a valid block-number %v", os.Args[2])
-	}
-	end, err := strconv.Atoi(os.Args[3])
-	if err != nil {
-		log.Fatalf("not a valid block-number %v", os.Args[2])
-	}
-	return uint64(start), uint64(end)
-}
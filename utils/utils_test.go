@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"gotest.tools/assert"
+)
+
+func TestWaitForTxSubscribe(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NilError(t, err)
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(1e18)},
+	})
+	defer sim.Close()
+	client := sim.Client()
+
+	chainID, err := client.ChainID(context.Background())
+	assert.NilError(t, err)
+	account, err := AccountFromPrivateKey(key, types.LatestSignerForChainID(chainID))
+	assert.NilError(t, err)
+	gas, err := GasCalculationFromClient(context.Background(), client, DefaultGasPriceFn)
+	assert.NilError(t, err)
+	tx, err := account.Sign(account.Address, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     0,
+		GasFeeCap: gas.Fee,
+		GasTipCap: gas.Tip,
+		Gas:       21000,
+		To:        &account.Address,
+		Value:     big.NewInt(1),
+	}))
+	assert.NilError(t, err)
+	assert.NilError(t, client.SendTransaction(context.Background(), tx))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		sim.Commit()
+	}()
+	receipt, err := WaitForTxSubscribe(ctx, tx, "test tx", client)
+	assert.NilError(t, err)
+	assert.Equal(t, receipt.Status, types.ReceiptStatusSuccessful)
+}